@@ -54,33 +54,13 @@ var RequireAuthMiddleware = &Middleware{
 	},
 }
 
-var (
-	// 🚨 SECURITY: These maps define route names that anonymous users can access. They MUST NOT leak any sensitive
-	// data or allow unprivileged users to perform undesired actions.
-	anonymousAccessibleAPIRoutes = map[string]struct{}{
-		router.RobotsTxt:         {},
-		router.Favicon:           {},
-		router.Logout:            {},
-		router.SignUp:            {},
-		router.SiteInit:          {},
-		router.SignIn:            {},
-		router.SignOut:           {},
-		router.ResetPasswordInit: {},
-		router.ResetPasswordCode: {},
-	}
-	anonymousAccessibleUIRoutes = map[string]struct{}{
-		uirouter.RouteSignIn:        {},
-		uirouter.RouteSignUp:        {},
-		uirouter.RoutePasswordReset: {},
-	}
-	// Some routes return non-standard HTTP responses when a user is not
-	// signed in.
-	anonymousUIStatusCode = map[string]int{
-		// This route lives in the app, but should act like the API since most
-		// clients are extensions.
-		uirouter.RouteRaw: http.StatusUnauthorized,
-	}
-)
+// Some routes return non-standard HTTP responses when a user is not
+// signed in.
+var anonymousUIStatusCode = map[string]int{
+	// This route lives in the app, but should act like the API since most
+	// clients are extensions.
+	uirouter.RouteRaw: http.StatusUnauthorized,
+}
 
 func matchedRouteName(req *http.Request, router *mux.Router) string {
 	var m mux.RouteMatch
@@ -128,11 +108,9 @@ func AllowAnonymousRequest(req *http.Request) bool {
 	if apiRouteName == router.UI {
 		// Test against UI router. (Some of its handlers inject private data into the title or meta tags.)
 		uiRouteName := matchedRouteName(req, uirouter.Router)
-		_, ok := anonymousAccessibleUIRoutes[uiRouteName]
-		return ok
+		return uirouter.RouteMetadata.Get(uiRouteName).Auth == router.AuthPublic
 	}
-	_, ok := anonymousAccessibleAPIRoutes[apiRouteName]
-	return ok
+	return router.RouteMetadata.Get(apiRouteName).Auth == router.AuthPublic
 }
 
 func anonymousStatusCode(req *http.Request, defaultCode int) int {
@@ -20,3 +20,35 @@ func SourcegraphDotComMode() bool {
 func MockSourcegraphDotComMode(value bool) {
 	sourcegraphDotComMode = value
 }
+
+var tenantHost = env.Get("TENANT_HOST", "", "host whose subdomains are served as separate tenants (e.g. example.com to serve acme.example.com); tenants are not used if empty")
+
+// TenantHost is the host whose subdomains are tenants (solely by checking the
+// TENANT_HOST env var), or "" if the server is not multi-tenant.
+func TenantHost() string {
+	return tenantHost
+}
+
+var externalBaseURL = env.Get("EXTERNAL_BASE_URL", "", "scheme and host (e.g. https://sourcegraph.example.com) of absolute URLs to the app in emails, webhooks and API responses")
+
+// ExternalBaseURL is the base of absolute URLs to the app (solely by checking
+// the EXTERNAL_BASE_URL env var), or "" if it is not configured.
+func ExternalBaseURL() string {
+	return externalBaseURL
+}
+
+var assetHost = env.Get("ASSET_HOST", "", "host (e.g. cdn.example.com) serving the app's static assets, such as a CDN pulling them from the app; asset URLs are relative if empty")
+
+// AssetHost is the host serving static assets (solely by checking the
+// ASSET_HOST env var), or "" if assets are served by the app itself.
+func AssetHost() string {
+	return assetHost
+}
+
+var basePath = env.Get("BASE_PATH", "", "path prefix (e.g. /sourcegraph) the app is served under, such as behind a reverse proxy at a subpath; the app is served at the root if empty")
+
+// BasePath is the path prefix the app is served under (solely by checking the
+// BASE_PATH env var), or "" if it is served at the root.
+func BasePath() string {
+	return basePath
+}
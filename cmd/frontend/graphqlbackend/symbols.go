@@ -214,7 +214,7 @@ func toSymbolResolver(symbol protocol.Symbol, baseURI *gituri.URI, lang string,
 		language: lang,
 		uri:      baseURI.WithFilePath(symbol.Path),
 	}
-	symbolRange := symbolRange(symbol)
+	symbolRange := symbol.LSPRange()
 	resolver.location = &locationResolver{
 		resource: &GitTreeEntryResolver{
 			commit: commitResolver,
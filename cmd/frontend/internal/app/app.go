@@ -27,6 +27,14 @@ func NewHandler() http.Handler {
 
 	r := router.Router()
 
+	// Fail fast if a route can't build its own URL or is shadowed by another
+	// route, rather than when a request first hits it.
+	if err := router.Validate(r, nil); err != nil {
+		panic(err)
+	}
+
+	r.Use(router.RouteMetadata.DeprecationMiddleware)
+
 	m := http.NewServeMux()
 
 	m.Handle("/", r)
@@ -39,7 +47,7 @@ func NewHandler() http.Handler {
 
 	// Redirects
 	r.Get(router.OldToolsRedirect).Handler(trace.TraceRoute(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/beta", http.StatusMovedPermanently)
+		http.Redirect(w, r, router.BasePath()+"/beta", http.StatusMovedPermanently)
 	})))
 
 	r.Get(router.GopherconLiveBlog).Handler(trace.TraceRoute(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,79 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/envvar"
+)
+
+// URLBuilder builds absolute URLs to the routes of a router.
+type URLBuilder struct {
+	router *mux.Router
+	base   *url.URL
+}
+
+// NewURLBuilder returns a URLBuilder for the routes of r, with the scheme and
+// host of base (such as "https://sourcegraph.example.com"). It returns an
+// error if base is not an http or https URL without a path, query or
+// fragment.
+func NewURLBuilder(r *mux.Router, base string) (*URLBuilder, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %q: %s", base, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", base)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: no host", base)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return nil, fmt.Errorf("invalid base URL %q: must only have a scheme and host", base)
+	}
+	return &URLBuilder{router: r, base: &url.URL{Scheme: u.Scheme, Host: u.Host}}, nil
+}
+
+// URLTo returns the absolute URL of the named route, with the given route vars
+// (as alternating name/value pairs). It panics if the route does not exist.
+func (b *URLBuilder) URLTo(routeName string, params ...string) *url.URL {
+	route := b.router.Get(routeName)
+	if route == nil {
+		panic("no route named " + routeName)
+	}
+	u, err := RouteURLPath(route, params...)
+	if err != nil {
+		panic(err)
+	}
+	u.Scheme, u.Host = b.base.Scheme, b.base.Host
+	return u
+}
+
+// externalURLs builds absolute URLs with the EXTERNAL_BASE_URL base. It is nil
+// if EXTERNAL_BASE_URL is not set.
+var externalURLs = func() *URLBuilder {
+	base := envvar.ExternalBaseURL()
+	if base == "" {
+		return nil
+	}
+	b, err := NewURLBuilder(router, base)
+	if err != nil {
+		panic("EXTERNAL_BASE_URL: " + err.Error())
+	}
+	return b
+}()
+
+// AbsoluteURLTo returns the absolute URL of the named route on the
+// EXTERNAL_BASE_URL, with the given route vars (as alternating name/value
+// pairs). It panics if the route does not exist or EXTERNAL_BASE_URL is not
+// set. As with URLTo, the URL of an asset route is on the asset host if one
+// is configured, with the scheme of EXTERNAL_BASE_URL.
+func AbsoluteURLTo(routeName string, params ...string) *url.URL {
+	if externalURLs == nil {
+		panic("EXTERNAL_BASE_URL is not set")
+	}
+	u := externalURLs.URLTo(routeName, params...)
+	onAssetHost(u, routeName)
+	return u
+}
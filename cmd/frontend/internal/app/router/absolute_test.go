@@ -0,0 +1,38 @@
+package router
+
+import "testing"
+
+func TestURLBuilder(t *testing.T) {
+	b, err := NewURLBuilder(Router(), "https://sourcegraph.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.URLTo(RepoBadge, "Repo", "github.com/gorilla/mux").String(), "https://sourcegraph.example.com/github.com/gorilla/mux/-/badge.svg"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Tenant routers build URLs on the base host rather than a tenant's.
+	b, err = NewURLBuilder(newRouter("example.com", ""), "http://localhost:3080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.URLTo(SignIn).String(), "http://localhost:3080/-/sign-in"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNewURLBuilder_invalid(t *testing.T) {
+	for _, base := range []string{
+		"sourcegraph.example.com",
+		"ftp://sourcegraph.example.com",
+		"https://",
+		"https://sourcegraph.example.com/app",
+		"https://sourcegraph.example.com?x=1",
+		"https://user@sourcegraph.example.com",
+		"https://sourcegraph.example.com:port",
+	} {
+		if _, err := NewURLBuilder(Router(), base); err == nil {
+			t.Errorf("expected error for base %q", base)
+		}
+	}
+}
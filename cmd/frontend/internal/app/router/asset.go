@@ -0,0 +1,21 @@
+package router
+
+import (
+	"net/url"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/envvar"
+)
+
+// assetHost is the host serving the routes marked Asset (the ASSET_HOST env
+// var), or "" if the app serves them itself. The asset host is expected to
+// pull them from the app like a CDN, so the asset routes still match requests
+// to the app's own host.
+var assetHost = envvar.AssetHost()
+
+// onAssetHost moves u, a URL to the named route, to the asset host if the
+// route is an asset route and an asset host is configured.
+func onAssetHost(u *url.URL, routeName string) {
+	if assetHost != "" && RouteMetadata.Get(routeName).Asset {
+		u.Host = assetHost
+	}
+}
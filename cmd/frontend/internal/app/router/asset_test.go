@@ -0,0 +1,43 @@
+package router
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestURLTo_assetHost(t *testing.T) {
+	if got, want := URLTo(Favicon).String(), "/favicon.ico"; got != want {
+		t.Errorf("without asset host: got %q, want %q", got, want)
+	}
+
+	orig := assetHost
+	assetHost = "cdn.example.com"
+	defer func() { assetHost = orig }()
+
+	if got, want := URLTo(Favicon).String(), "//cdn.example.com/favicon.ico"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := URLTo(SignIn).String(), "/-/sign-in"; got != want {
+		t.Errorf("non-asset route: got %q, want %q", got, want)
+	}
+
+	origURLs := externalURLs
+	externalURLs, _ = NewURLBuilder(router, "https://sourcegraph.example.com")
+	defer func() { externalURLs = origURLs }()
+	if got, want := AbsoluteURLTo(RegistryExtensionBundle, "RegistryExtensionReleaseFilename", "1-x.js").String(), "https://cdn.example.com/-/static/extension/1-x.js"; got != want {
+		t.Errorf("absolute: got %q, want %q", got, want)
+	}
+	if got, want := AbsoluteURLTo(SignIn).String(), "https://sourcegraph.example.com/-/sign-in"; got != want {
+		t.Errorf("absolute non-asset route: got %q, want %q", got, want)
+	}
+
+	// The asset host pulls assets from the app, so they are still served on
+	// the app's host.
+	req := httptest.NewRequest("GET", "http://sourcegraph.example.com/favicon.ico", nil)
+	var match mux.RouteMatch
+	if !Router().Match(req, &match) || match.Route.GetName() != Favicon {
+		t.Errorf("expected request to the app's host to match route %q", Favicon)
+	}
+}
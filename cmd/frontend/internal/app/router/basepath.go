@@ -0,0 +1,57 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/envvar"
+)
+
+// basePath is the path prefix the app is served under (the BASE_PATH env var,
+// such as "/sourcegraph"), or "" if it is served at the root.
+var basePath = cleanBasePath(envvar.BasePath())
+
+// cleanBasePath returns the base path p without a trailing slash. It panics if
+// p is not empty and doesn't start with a slash.
+func cleanBasePath(p string) string {
+	p = strings.TrimRight(p, "/")
+	if p != "" && !strings.HasPrefix(p, "/") {
+		panic(`BASE_PATH must start with "/"`)
+	}
+	return p
+}
+
+// BasePath returns the path prefix the app is served under, or "" if it is
+// served at the root. The paths of all routes, and so the URLs built by URLTo,
+// start with it.
+func BasePath() string {
+	return basePath
+}
+
+// WithBasePath returns a subrouter of r whose routes only match paths under
+// the base path, or r itself if the app is served at the root. Routes added to
+// it are named in r, so that r.Get builds URLs with the base path. Routers
+// matching the full request path (rather than a path stripped of the prefix)
+// that are mounted in the app router must add their routes to it.
+func WithBasePath(r *mux.Router) *mux.Router {
+	return withBasePath(r, basePath)
+}
+
+func withBasePath(r *mux.Router, basePath string) *mux.Router {
+	if basePath == "" {
+		return r
+	}
+	return r.PathPrefix(basePath).Subrouter()
+}
+
+// addBasePathRedirect redirects requests for the base path itself to the
+// root under it, like StrictSlash does for routes ending in a slash.
+func addBasePathRedirect(r *mux.Router, basePath string) {
+	if basePath == "" {
+		return
+	}
+	r.MatcherFunc(func(req *http.Request, _ *mux.RouteMatch) bool {
+		return req.URL.Path == basePath
+	}).Handler(http.RedirectHandler(basePath+"/", http.StatusMovedPermanently))
+}
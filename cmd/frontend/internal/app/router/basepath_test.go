@@ -0,0 +1,63 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestBasePathRouter(t *testing.T) {
+	r := newRouter("", "/sourcegraph")
+	if err := Validate(r, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		"/sourcegraph/-/logout":    Logout,
+		"/sourcegraph/favicon.ico": Favicon,
+		"/sourcegraph/":            UI,
+		"/-/logout":                "",
+		"/sourcegraphx/-/logout":   "",
+	} {
+		var match mux.RouteMatch
+		got := ""
+		if r.Match(httptest.NewRequest("GET", path, nil), &match) {
+			got = match.Route.GetName()
+		}
+		if got != want {
+			t.Errorf("%s: got route %q, want %q", path, got, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/sourcegraph", nil))
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/sourcegraph/" {
+		t.Errorf("got status %d and location %q for the base path, want a redirect to /sourcegraph/", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestURLTo_basePath(t *testing.T) {
+	origRouter, origBasePath := router, basePath
+	router, basePath = newRouter("", "/sourcegraph"), "/sourcegraph"
+	defer func() { router, basePath = origRouter, origBasePath }()
+
+	if got, want := URLTo(SignIn).String(), "/sourcegraph/-/sign-in"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := URLTo(RepoBadge, "Repo", "github.com/gorilla/mux").String(), "/sourcegraph/github.com/gorilla/mux/-/badge.svg"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := URLToRepoTreeEntry("github.com/gorilla/mux", "v1", "a/b").String(), "/sourcegraph/github.com/gorilla/mux@v1/-/tree/a/b"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCleanBasePath(t *testing.T) {
+	for p, want := range map[string]string{"": "", "/": "", "/sourcegraph/": "/sourcegraph", "/a/b": "/a/b"} {
+		if got := cleanBasePath(p); got != want {
+			t.Errorf("cleanBasePath(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package router
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// Deprecation marks a route as deprecated. The route keeps working; requests
+// to it are answered with headers telling clients so, and are counted and
+// logged to find the remaining callers before the route is removed.
+type Deprecation struct {
+	// Since is when the route was deprecated, sent in the Deprecation header.
+	// If it is zero the header is "true".
+	Since time.Time
+
+	// Sunset if non-zero is when the route will stop working, sent in the
+	// Sunset header (RFC 8594).
+	Sunset time.Time
+
+	// Link if non-empty is a URL documenting the deprecation or the route's
+	// replacement, sent as a Link header with rel="deprecation".
+	Link string
+}
+
+// deprecationLogLimit limits how often the use of each deprecated route is
+// logged, because a single caller may hit it on every page load.
+const deprecationLogLimit = rate.Limit(1.0 / 60)
+
+var deprecationLogLimiters sync.Map // route name -> *rate.Limiter
+
+// DeprecationMiddleware is a middleware (see mux.Router.Use) of a router whose
+// routes are described by m that signals and records the use of routes with a
+// Deprecation.
+func (m MetadataMap) DeprecationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if d := m.Get(route.GetName()).Deprecation; d != nil {
+				d.signal(w, r, route.GetName())
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// signal sets the deprecation headers of the response to a request r of the
+// named route, and records the request.
+func (d *Deprecation) signal(w http.ResponseWriter, r *http.Request, name string) {
+	if d.Since.IsZero() {
+		w.Header().Set("Deprecation", "true")
+	} else {
+		w.Header().Set("Deprecation", d.Since.UTC().Format(http.TimeFormat))
+	}
+	if !d.Sunset.IsZero() {
+		w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		w.Header().Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+	}
+
+	deprecatedRouteRequests.WithLabelValues(name).Inc()
+	limiter, _ := deprecationLogLimiters.LoadOrStore(name, rate.NewLimiter(deprecationLogLimit, 1))
+	if limiter.(*rate.Limiter).Allow() {
+		log15.Warn("Deprecated route used.", "route", name, "path", r.URL.Path, "userAgent", r.UserAgent(), "referer", r.Referer())
+	}
+}
+
+var deprecatedRouteRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "src",
+	Name:      "deprecated_route_requests",
+	Help:      "Number of requests to deprecated routes.",
+}, []string{"route"})
+
+func init() {
+	prometheus.MustRegister(deprecatedRouteRequests)
+}
@@ -3,18 +3,114 @@ package router
 import (
 	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
+	"sync"
 
+	"github.com/gorilla/mux"
 	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/routevar"
 )
 
-func URLToRepoTreeEntry(repo api.RepoName, rev, path string) *url.URL {
-	return &url.URL{Path: fmt.Sprintf("/%s%s/-/tree/%s", repo, revStr(rev), path)}
+// URLTo returns the path of the named route, with the given route vars (as
+// alternating name/value pairs). It panics if the route does not exist. For a
+// multi-tenant router, use URLToTenant to get a URL on a tenant's subdomain.
+//
+// If an asset host is configured (see ASSET_HOST), the URL of an asset route
+// is on it instead, with no scheme so that it is resolved with the scheme of
+// the current page.
+func URLTo(routeName string, params ...string) *url.URL {
+	route := Router().Get(routeName)
+	if route == nil {
+		panic("no route named " + routeName)
+	}
+	u, err := RouteURLPath(route, params...)
+	if err != nil {
+		panic(err)
+	}
+	onAssetHost(u, routeName)
+	return u
 }
 
-func revStr(rev string) string {
-	if rev == "" || strings.HasPrefix(rev, "@") {
-		return rev
+// RouteURLPath returns the path of route, with the given route vars (as
+// alternating name/value pairs). Unlike route.URLPath, it checks each value
+// against the pattern of its own variable, so that a value can't spill into
+// the rest of the path (such as a repository name containing "/-/") or leave
+// out a required segment (an empty value), and it percent-encodes the
+// characters of the values that are reserved within a path segment.
+func RouteURLPath(route *mux.Route, params ...string) (*url.URL, error) {
+	if len(params)%2 != 0 {
+		return nil, fmt.Errorf("route %q: route vars must be name/value pairs, got %d strings", route.GetName(), len(params))
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+	for _, v := range routeVars(tpl) {
+		value, ok := values[v.Name]
+		if !ok {
+			return nil, fmt.Errorf("route %q: missing route variable %q", route.GetName(), v.Name)
+		}
+		if !routeVarPattern(v.Pattern).MatchString(value) {
+			if value == "" {
+				return nil, fmt.Errorf("route %q: route variable %q must not be empty", route.GetName(), v.Name)
+			}
+			return nil, fmt.Errorf("route %q: invalid value %q for route variable %q", route.GetName(), value, v.Name)
+		}
+	}
+
+	u, err := route.URLPath(params...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the path again from escaped values. It is only used as the
+	// escaped form of the path if it is one, i.e. if the template itself
+	// has nothing that would be escaped.
+	escaped := make([]string, len(params))
+	for i := 0; i < len(params); i += 2 {
+		escaped[i], escaped[i+1] = params[i], escapePathSegments(params[i+1])
+	}
+	if raw, err := route.URLPath(escaped...); err == nil {
+		if p, err := url.PathUnescape(raw.Path); err == nil && p == u.Path {
+			u.RawPath = raw.Path
+		}
 	}
-	return "@" + rev
+	return u, nil
+}
+
+// escapePathSegments percent-encodes each "/" separated segment of s.
+func escapePathSegments(s string) string {
+	segments := strings.Split(s, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+var routeVarPatterns sync.Map // pattern -> *regexp.Regexp
+
+// routeVarPattern returns the regexp matching a whole value of a route
+// variable with the pattern, which defaults to mux's single path segment.
+func routeVarPattern(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		pattern = "[^/]+"
+	}
+	if re, ok := routeVarPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile("^(?:" + pattern + ")$")
+	routeVarPatterns.Store(pattern, re)
+	return re
+}
+
+// URLToRepoTreeEntry returns the URL of the page of the file or directory at
+// path in repo at rev.
+func URLToRepoTreeEntry(repo api.RepoName, rev, path string) *url.URL {
+	return &url.URL{Path: basePath + routevar.TreeEntryPath(repo, rev, path)}
 }
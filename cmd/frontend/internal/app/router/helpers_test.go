@@ -0,0 +1,85 @@
+package router
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/sourcegraph/internal/routevar"
+)
+
+func TestRouteURLPath(t *testing.T) {
+	r := mux.NewRouter()
+	blob := r.Path("/" + routevar.Repo + routevar.RepoRevSuffix + "/-/blob/{Path:.*}").Name("blob")
+
+	tests := map[string]struct {
+		repo, rev, path string
+		want            string
+		wantErr         string
+	}{
+		"plain": {
+			repo: "github.com/gorilla/mux", rev: "@master", path: "mux.go",
+			want: "/github.com/gorilla/mux@master/-/blob/mux.go",
+		},
+		"no rev": {
+			repo: "github.com/gorilla/mux", path: "mux.go",
+			want: "/github.com/gorilla/mux/-/blob/mux.go",
+		},
+		"slash in rev": {
+			repo: "r", rev: "@feature/x", path: "a.go",
+			want: "/r@feature/x/-/blob/a.go",
+		},
+		"reserved characters": {
+			repo: "host/a?b#c", rev: "@v1;2", path: "dir/a b,c%.go",
+			want: "/host/a%3Fb%23c@v1%3B2/-/blob/dir/a%20b%2Cc%25.go",
+		},
+		"unicode": {
+			repo: "host/ü", path: "ö.go",
+			want: "/host/%C3%BC/-/blob/%C3%B6.go",
+		},
+		"empty repo": {
+			path:    "a.go",
+			wantErr: `route variable "Repo" must not be empty`,
+		},
+		"repo spilling into the path": {
+			repo: "r/-/blob/x", path: "a.go",
+			wantErr: `invalid value "r/-/blob/x" for route variable "Repo"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			u, err := RouteURLPath(blob, "Repo", test.repo, "Rev", test.rev, "Path", test.path)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := u.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+
+			// The URL is routed back to the same vars.
+			var match mux.RouteMatch
+			if !r.Match(httptest.NewRequest("GET", u.String(), nil), &match) || match.Route != blob {
+				t.Fatalf("%s does not match the route", u)
+			}
+			want := map[string]string{"Repo": test.repo, "Rev": test.rev, "Path": test.path}
+			if !reflect.DeepEqual(match.Vars, want) {
+				t.Errorf("got vars %v, want %v", match.Vars, want)
+			}
+		})
+	}
+
+	if _, err := RouteURLPath(blob, "Repo"); err == nil {
+		t.Error("expected an error for an odd number of route vars")
+	}
+	if _, err := RouteURLPath(blob, "Repo", "r"); err == nil || !strings.Contains(err.Error(), `missing route variable "Rev"`) {
+		t.Errorf("got error %v, want a missing route variable", err)
+	}
+}
@@ -0,0 +1,138 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// AuthLevel is the authentication required to access a route.
+type AuthLevel int
+
+const (
+	// AuthRequired routes require an authenticated user, unless the site
+	// allows anonymous access to everything (auth.public). It is the zero
+	// value, so routes without metadata require authentication.
+	AuthRequired AuthLevel = iota
+
+	// AuthPublic routes are always accessible to anonymous users.
+	AuthPublic
+
+	// AuthSiteAdmin routes require an authenticated site admin. Their
+	// handlers MUST still check this themselves.
+	AuthSiteAdmin
+)
+
+func (l AuthLevel) String() string {
+	switch l {
+	case AuthRequired:
+		return "required"
+	case AuthPublic:
+		return "public"
+	case AuthSiteAdmin:
+		return "site-admin"
+	default:
+		return "unknown"
+	}
+}
+
+// Audience is who a route serves, which determines e.g. whether its errors
+// are rendered as HTML or JSON.
+type Audience int
+
+const (
+	// AudienceBrowser routes serve pages to browsers. It is the zero value,
+	// so routes without metadata are browser routes.
+	AudienceBrowser Audience = iota
+
+	// AudienceAPI routes serve programmatic clients, such as the web app's
+	// fetch calls.
+	AudienceAPI
+
+	// AudienceBoth routes serve both; the request's Accept header decides.
+	AudienceBoth
+)
+
+func (a Audience) String() string {
+	switch a {
+	case AudienceBrowser:
+		return "browser"
+	case AudienceAPI:
+		return "api"
+	case AudienceBoth:
+		return "both"
+	default:
+		return "unknown"
+	}
+}
+
+// Metadata describes a named route. Middleware looks it up by the name of the
+// route matching a request, so that policy is defined next to the routes
+// rather than duplicated in each middleware.
+type Metadata struct {
+	// Auth is the authentication required to access the route.
+	Auth AuthLevel
+
+	// Audience is who the route serves.
+	Audience Audience
+
+	// Deprecation if non-nil marks the route as deprecated.
+	Deprecation *Deprecation
+
+	// Asset marks a route serving static files that can be served by the
+	// asset host (see ASSET_HOST), so URLs to it are on that host.
+	Asset bool
+}
+
+// MetadataMap holds the metadata of a router's named routes.
+type MetadataMap map[string]Metadata
+
+// Get returns the metadata of the named route. Routes without metadata
+// (including the empty name of an unmatched request) get the zero Metadata,
+// which is the most restrictive.
+func (m MetadataMap) Get(name string) Metadata {
+	return m[name]
+}
+
+// WantsJSON reports whether the response to r, as matched by a router whose
+// routes are described by m, should be JSON rather than HTML. It must be
+// called from a handler or middleware (see mux.Router.Use) of the router,
+// because it looks up the route r matched. For routes serving both
+// audiences, and requests the router didn't match, the Accept header
+// decides.
+func (m MetadataMap) WantsJSON(r *http.Request) bool {
+	var audience Audience = AudienceBoth
+	if route := mux.CurrentRoute(r); route != nil {
+		audience = m.Get(route.GetName()).Audience
+	}
+	switch audience {
+	case AudienceAPI:
+		return true
+	case AudienceBoth:
+		return strings.Contains(r.Header.Get("Accept"), "application/json")
+	default:
+		return false
+	}
+}
+
+// RouteMetadata is the metadata of the routes of Router.
+//
+// 🚨 SECURITY: Routes marked AuthPublic can be accessed by anonymous users. They MUST NOT leak any
+// sensitive data or allow unprivileged users to perform undesired actions.
+var RouteMetadata = MetadataMap{
+	RobotsTxt:         {Auth: AuthPublic},
+	Favicon:           {Auth: AuthPublic, Asset: true},
+	Logout:            {Auth: AuthPublic},
+	SignUp:            {Auth: AuthPublic, Audience: AudienceAPI},
+	SiteInit:          {Auth: AuthPublic, Audience: AudienceAPI},
+	SignIn:            {Auth: AuthPublic, Audience: AudienceAPI},
+	SignOut:           {Auth: AuthPublic},
+	ResetPasswordInit: {Auth: AuthPublic, Audience: AudienceAPI},
+	ResetPasswordCode: {Auth: AuthPublic, Audience: AudienceAPI},
+
+	RegistryExtensionBundle: {Audience: AudienceAPI, Asset: true},
+
+	Debug:        {Auth: AuthSiteAdmin},
+	DebugHeaders: {Auth: AuthSiteAdmin},
+}
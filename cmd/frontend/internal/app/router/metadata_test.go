@@ -0,0 +1,110 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRouteMetadata(t *testing.T) {
+	for name := range RouteMetadata {
+		if Router().Get(name) == nil {
+			t.Errorf("metadata for unknown route %q", name)
+		}
+	}
+
+	if got := RouteMetadata.Get(SignIn).Auth; got != AuthPublic {
+		t.Errorf("got auth %s for %s, want %s", got, SignIn, AuthPublic)
+	}
+	for _, name := range []string{Editor, "", "no-such-route"} {
+		if got := RouteMetadata.Get(name).Auth; got != AuthRequired {
+			t.Errorf("got auth %s for %q, want %s", got, name, AuthRequired)
+		}
+		if got := RouteMetadata.Get(name).Audience; got != AudienceBrowser {
+			t.Errorf("got audience %s for %q, want %s", got, name, AudienceBrowser)
+		}
+	}
+}
+
+func TestMetadataMap_WantsJSON(t *testing.T) {
+	metadata := MetadataMap{"api": {Audience: AudienceAPI}, "both": {Audience: AudienceBoth}}
+	r := mux.NewRouter()
+	var got bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = metadata.WantsJSON(r) })
+	r.Path("/api").Handler(handler).Name("api")
+	r.Path("/both").Handler(handler).Name("both")
+	r.Path("/page").Handler(handler).Name("page")
+	r.NotFoundHandler = handler
+
+	for _, test := range []struct {
+		path   string
+		accept string
+		want   bool
+	}{
+		{path: "/api", want: true},
+		{path: "/api", accept: "text/html", want: true},
+		{path: "/page", accept: "application/json", want: false},
+		{path: "/both", accept: "text/html", want: false},
+		{path: "/both", accept: "application/json", want: true},
+		{path: "/unmatched", accept: "application/json", want: true},
+		{path: "/unmatched", want: false},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		got = !test.want
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if got != test.want {
+			t.Errorf("%s with Accept %q: got %v, want %v", test.path, test.accept, got, test.want)
+		}
+	}
+}
+
+func TestMetadataMap_DeprecationMiddleware(t *testing.T) {
+	sunset := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	metadata := MetadataMap{
+		"old":   {Deprecation: &Deprecation{Sunset: sunset, Link: "https://example.com/new"}},
+		"dated": {Deprecation: &Deprecation{Since: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+	r := mux.NewRouter()
+	r.Use(metadata.DeprecationMiddleware)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r.Path("/old").Handler(handler).Name("old")
+	r.Path("/dated").Handler(handler).Name("dated")
+	r.Path("/current").Handler(handler).Name("current")
+
+	for _, test := range []struct {
+		path                      string
+		deprecation, sunset, link string
+	}{
+		{path: "/old", deprecation: "true", sunset: "Wed, 02 Jan 2030 03:04:05 GMT", link: `<https://example.com/new>; rel="deprecation"`},
+		{path: "/dated", deprecation: "Thu, 01 Jan 2026 00:00:00 GMT"},
+		{path: "/current"},
+	} {
+		before := testutil.ToFloat64(deprecatedRouteRequests.WithLabelValues(strings.TrimPrefix(test.path, "/")))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if got := rec.Header().Get("Deprecation"); got != test.deprecation {
+			t.Errorf("%s: got Deprecation %q, want %q", test.path, got, test.deprecation)
+		}
+		if got := rec.Header().Get("Sunset"); got != test.sunset {
+			t.Errorf("%s: got Sunset %q, want %q", test.path, got, test.sunset)
+		}
+		if got := rec.Header().Get("Link"); got != test.link {
+			t.Errorf("%s: got Link %q, want %q", test.path, got, test.link)
+		}
+		want := 0.0
+		if test.deprecation != "" {
+			want = 1
+		}
+		if n := testutil.ToFloat64(deprecatedRouteRequests.WithLabelValues(strings.TrimPrefix(test.path, "/"))) - before; n != want {
+			t.Errorf("%s: counted %v requests, want %v", test.path, n, want)
+		}
+	}
+}
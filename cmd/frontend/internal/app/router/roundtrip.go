@@ -0,0 +1,95 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// AssertURLToRoundTrips checks that for every named route of the app router,
+// URLTo(name, vars[name]...) builds a URL that a request is routed back to
+// the same route by, with the same route vars. vars holds sample route vars
+// (as alternating name/value pairs) by route name; routes without variables
+// may be left out. Each route that fails is reported with its vars, so that a
+// route pattern drifting apart from the vars passed to URLTo is caught.
+func AssertURLToRoundTrips(t testing.TB, vars map[string][]string) {
+	t.Helper()
+	assertRoundTrips(t, Router(), URLTo, vars)
+}
+
+func assertRoundTrips(t testing.TB, r *mux.Router, urlTo func(string, ...string) *url.URL, vars map[string][]string) {
+	t.Helper()
+
+	names := map[string]bool{}
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		name := route.GetName()
+		if name == "" {
+			return nil
+		}
+		names[name] = true
+		if problem := roundTripRoute(r, route, urlTo, vars[name]); problem != "" {
+			t.Errorf("route %q with vars %q: %s", name, vars[name], problem)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var unknown []string
+	for name := range vars {
+		if !names[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		t.Errorf("route %q with vars %q: no such route", name, vars[name])
+	}
+}
+
+// roundTripRoute returns what is wrong with the URL built to route from
+// params, or "" if it is routed back to route with the same vars.
+func roundTripRoute(r *mux.Router, route *mux.Route, urlTo func(string, ...string) *url.URL, params []string) (problem string) {
+	defer func() {
+		if e := recover(); e != nil {
+			problem = fmt.Sprintf("building the URL panicked: %v", e)
+		}
+	}()
+	u := urlTo(route.GetName(), params...)
+
+	method := "GET"
+	if methods, err := route.GetMethods(); err == nil && len(methods) > 0 {
+		method = methods[0]
+	}
+	req, err := http.NewRequest(method, u.EscapedPath(), nil)
+	if err != nil {
+		return fmt.Sprintf("building request for %s: %s", u, err)
+	}
+	// A multi-tenant router only routes requests for a tenant's subdomain.
+	if _, err := route.GetHostTemplate(); err == nil {
+		host, err := route.URLHost(append(params, tenantVar, SampleRouteVars[tenantVar])...)
+		if err != nil {
+			return fmt.Sprintf("building host: %s", err)
+		}
+		req.Host = host.Host
+	}
+
+	var match mux.RouteMatch
+	if !r.Match(req, &match) || match.Route == nil {
+		return fmt.Sprintf("%s %s does not match any route", method, u.EscapedPath())
+	}
+	if match.Route != route {
+		return fmt.Sprintf("%s %s matches route %q instead", method, u.EscapedPath(), match.Route.GetName())
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		if got := match.Vars[params[i]]; got != params[i+1] {
+			return fmt.Sprintf("%s %s has route var %s=%q instead of %q", method, u.EscapedPath(), params[i], got, params[i+1])
+		}
+	}
+	return ""
+}
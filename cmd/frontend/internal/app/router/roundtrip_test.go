@@ -0,0 +1,66 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestURLToRoundTrips(t *testing.T) {
+	AssertURLToRoundTrips(t, map[string][]string{
+		RegistryExtensionBundle: {"RegistryExtensionReleaseFilename", "1.js"},
+		OldTreeRedirect:         {"Repo", "github.com/gorilla/mux", "Rev", "@master", "Path", "/dir/file.go"},
+		RepoBadge:               {"Repo", "github.com/gorilla/mux"},
+	})
+}
+
+// recordingTB records the errors reported by a test helper.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingTB) Helper() {}
+
+func (t *recordingTB) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertRoundTrips_problems(t *testing.T) {
+	r := mux.NewRouter()
+	r.PathPrefix("/users").Methods("GET").Name("users")
+	r.Path("/users/{username}/settings").Methods("GET").Name("user.settings")
+	r.Path("/orgs/{org}").Methods("GET").Name("org")
+	r.Path("/orgs/{org}/members").Methods("GET").Name("org.members")
+	urlTo := func(name string, params ...string) *url.URL {
+		u, err := RouteURLPath(r.Get(name), params...)
+		if err != nil {
+			panic(err)
+		}
+		return u
+	}
+
+	rec := &recordingTB{TB: t}
+	assertRoundTrips(rec, r, urlTo, map[string][]string{
+		"user.settings": {"username", "alice"},
+		"org.members":   {"org", "acme", "team", "a"},
+		"team":          {"team", "a"},
+	})
+	got := strings.Join(rec.errors, "\n")
+	for _, want := range []string{
+		`route "user.settings" with vars ["username" "alice"]: GET /users/alice/settings matches route "users" instead`,
+		`route "org" with vars []: building the URL panicked: route "org": missing route variable "org"`,
+		`route "org.members" with vars ["org" "acme" "team" "a"]: GET /orgs/acme/members has route var team="" instead of "a"`,
+		`route "team" with vars ["team" "a"]: no such route`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected errors to contain %q, got:\n%s", want, got)
+		}
+	}
+	if len(rec.errors) != 4 {
+		t.Errorf("got %d errors, want 4:\n%s", len(rec.errors), got)
+	}
+}
@@ -49,12 +49,22 @@ const (
 // Router returns the frontend app router.
 func Router() *mux.Router { return router }
 
-var router = newRouter()
+var router = newRouter(envvar.TenantHost(), basePath)
 
-func newRouter() *mux.Router {
-	base := mux.NewRouter()
+// newRouter returns the app router. If tenantHost is non-empty, every route
+// only matches requests for a tenant subdomain of tenantHost (see Tenant). If
+// basePath is non-empty, every route only matches paths under it.
+func newRouter(tenantHost, basePath string) *mux.Router {
+	root := mux.NewRouter()
 
-	base.StrictSlash(true)
+	root.StrictSlash(true)
+
+	base := root
+	if tenantHost != "" {
+		base = root.Host(tenantHostTemplate(tenantHost)).Subrouter()
+	}
+	addBasePathRedirect(base, basePath)
+	base = withBasePath(base, basePath)
 
 	base.Path("/robots.txt").Methods("GET").Name(RobotsTxt)
 	base.Path("/favicon.ico").Methods("GET").Name(Favicon)
@@ -94,5 +104,5 @@ func newRouter() *mux.Router {
 	// Must come last
 	base.PathPrefix("/").Name(UI)
 
-	return base
+	return root
 }
@@ -0,0 +1,83 @@
+package router
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteInfo describes a named route, for generating documentation and API
+// clients.
+type RouteInfo struct {
+	Name     string     `json:"name"`
+	Host     string     `json:"host,omitempty"` // host template, if the route only matches some hosts
+	Path     string     `json:"path"`           // path template
+	Prefix   bool       `json:"prefix,omitempty"`
+	Methods  []string   `json:"methods,omitempty"` // empty if any method matches
+	Vars     []RouteVar `json:"vars,omitempty"`
+	Auth     string     `json:"auth"`
+	Audience string     `json:"audience"`
+	Asset    bool       `json:"asset,omitempty"` // served by the asset host, if configured
+
+	// Deprecated and Sunset are as in the route's Deprecation, if any.
+	Deprecated bool       `json:"deprecated,omitempty"`
+	Sunset     *time.Time `json:"sunset,omitempty"`
+}
+
+// RouteVar is a variable in a route's host or path template.
+type RouteVar struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern,omitempty"` // regexp the value must match, if not the default
+}
+
+// ListRoutes returns the named routes of r in the order they are matched,
+// reading them from r's route table so that the listing can't get out of sync
+// with the routes. The authentication levels, audiences and deprecations are
+// looked up in metadata.
+func ListRoutes(r *mux.Router, metadata MetadataMap) ([]RouteInfo, error) {
+	var routes []RouteInfo
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		name := route.GetName()
+		if name == "" {
+			return nil
+		}
+		md := metadata.Get(name)
+		info := RouteInfo{Name: name, Auth: md.Auth.String(), Audience: md.Audience.String(), Asset: md.Asset}
+		if d := md.Deprecation; d != nil {
+			info.Deprecated = true
+			if !d.Sunset.IsZero() {
+				sunset := d.Sunset
+				info.Sunset = &sunset
+			}
+		}
+
+		var err error
+		if info.Path, err = route.GetPathTemplate(); err != nil {
+			return err
+		}
+		re, err := route.GetPathRegexp()
+		if err != nil {
+			return err
+		}
+		info.Prefix = !strings.HasSuffix(re, "$")
+
+		if hostTpl, err := route.GetHostTemplate(); err == nil {
+			info.Host = hostTpl
+			info.Vars = routeVars(hostTpl)
+		}
+		info.Vars = append(info.Vars, routeVars(info.Path)...)
+
+		// GetMethods fails for routes that match any method.
+		if methods, err := route.GetMethods(); err == nil {
+			info.Methods = methods
+		}
+
+		routes = append(routes, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
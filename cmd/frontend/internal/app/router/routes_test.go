@@ -0,0 +1,55 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestListRoutes(t *testing.T) {
+	r := mux.NewRouter()
+	r.Path("/users/{username}").Methods("GET", "POST").Name("user")
+	r.Path("/repos/{Repo:[^/]+(?:/[^/]{1,3})?}/-/badge.svg").Methods("GET").Name("badge")
+	r.Path("/unnamed")
+	r.PathPrefix("/").Name("ui")
+
+	routes, err := ListRoutes(r, MetadataMap{"ui": {Auth: AuthPublic}, "badge": {Audience: AudienceAPI}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RouteInfo{
+		{
+			Name:     "user",
+			Path:     "/users/{username}",
+			Methods:  []string{"GET", "POST"},
+			Vars:     []RouteVar{{Name: "username"}},
+			Auth:     "required",
+			Audience: "browser",
+		},
+		{
+			Name:     "badge",
+			Path:     "/repos/{Repo:[^/]+(?:/[^/]{1,3})?}/-/badge.svg",
+			Methods:  []string{"GET"},
+			Vars:     []RouteVar{{Name: "Repo", Pattern: "[^/]+(?:/[^/]{1,3})?"}},
+			Auth:     "required",
+			Audience: "api",
+		},
+		{Name: "ui", Path: "/", Prefix: true, Auth: "public", Audience: "browser"},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("got %+v, want %+v", routes, want)
+	}
+}
+
+func TestListRoutes_tenant(t *testing.T) {
+	routes, err := ListRoutes(newRouter("example.com", ""), RouteMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range routes {
+		if route.Host == "" || len(route.Vars) == 0 || route.Vars[0].Name != tenantVar {
+			t.Errorf("route %q: expected the tenant host variable first, got host %q and vars %+v", route.Name, route.Host, route.Vars)
+		}
+	}
+}
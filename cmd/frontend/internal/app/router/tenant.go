@@ -0,0 +1,47 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+)
+
+// tenantVar is the route variable for a tenant's name, matching a single DNS
+// label.
+const tenantVar = "Tenant"
+
+func tenantHostTemplate(tenantHost string) string {
+	return "{" + tenantVar + ":[a-z0-9]+(?:-[a-z0-9]+)*}." + tenantHost
+}
+
+// Tenant returns the tenant the request was routed to, or "" if the router is
+// not multi-tenant.
+func Tenant(r *http.Request) string {
+	return mux.Vars(r)[tenantVar]
+}
+
+// URLToTenant returns the URL of the named route on tenant's subdomain, with
+// the given route vars (as alternating name/value pairs). The URL has no
+// scheme, so that it is resolved with the scheme of the current page. It
+// panics if the route does not exist or the router is not multi-tenant.
+func URLToTenant(tenant, routeName string, params ...string) *url.URL {
+	route := Router().Get(routeName)
+	if route == nil {
+		panic("no route named " + routeName)
+	}
+	params = append(params, tenantVar, tenant)
+	u, err := route.URLHost(params...)
+	if err != nil {
+		panic(err)
+	}
+	if u.Host == "" {
+		panic("router is not multi-tenant")
+	}
+	path, err := RouteURLPath(route, params...)
+	if err != nil {
+		panic(err)
+	}
+	u.Scheme, u.Path, u.RawPath = "", path.Path, path.RawPath
+	return u
+}
@@ -0,0 +1,53 @@
+package router
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTenantRouter(t *testing.T) {
+	r := newRouter("example.com", "")
+	if err := Validate(r, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "http://acme.example.com/-/logout", nil)
+	var match mux.RouteMatch
+	if !r.Match(req, &match) {
+		t.Fatal("expected tenant request to match")
+	}
+	if got, want := match.Route.GetName(), Logout; got != want {
+		t.Errorf("got route %q, want %q", got, want)
+	}
+	if got, want := match.Vars[tenantVar], "acme"; got != want {
+		t.Errorf("got tenant %q, want %q", got, want)
+	}
+
+	for _, host := range []string{"example.com", "a.b.example.com", "acme.example.org"} {
+		req := httptest.NewRequest("GET", "http://"+host+"/-/logout", nil)
+		if r.Match(req, &mux.RouteMatch{}) {
+			t.Errorf("expected request for host %q not to match", host)
+		}
+	}
+}
+
+func TestURLToTenant(t *testing.T) {
+	orig := router
+	router = newRouter("example.com", "")
+	defer func() { router = orig }()
+
+	if got, want := URLToTenant("acme", RepoBadge, "Repo", "r", "Rev", "").String(), "//acme.example.com/r/-/badge.svg"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := URLTo(RepoBadge, "Repo", "r", "Rev", "").String(), "/r/-/badge.svg"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestURLTo(t *testing.T) {
+	if got, want := URLTo(Logout).String(), "/-/logout"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// SampleRouteVars are representative values for route variables. Validate
+// uses them to build a URL for every named route.
+var SampleRouteVars = map[string]string{
+	"Repo":                             "github.com/gorilla/mux",
+	"Rev":                              "@master",
+	"Path":                             "/dir/file.go",
+	"RegistryExtensionReleaseFilename": "1.js",
+	tenantVar:                          "acme",
+}
+
+// routeVarNames returns the names of the variables in a route path template,
+// such as "Repo" in "/{Repo:[^/]+}/-/badge.svg".
+func routeVarNames(tpl string) []string {
+	var names []string
+	for _, v := range routeVars(tpl) {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+// routeVars returns the variables in a route path or host template, in order.
+// Variable patterns may themselves contain braces.
+func routeVars(tpl string) []RouteVar {
+	var (
+		vars  []RouteVar
+		depth int
+		start = -1 // start of the current variable's name
+		colon = -1 // index of the colon after the current variable's name
+	)
+	for i, c := range tpl {
+		switch c {
+		case '{':
+			if depth == 0 {
+				start, colon = i+1, -1
+			}
+			depth++
+		case ':':
+			if depth == 1 && colon < 0 {
+				colon = i
+			}
+		case '}':
+			depth--
+			if depth == 0 && start >= 0 {
+				v := RouteVar{Name: tpl[start:i]}
+				if colon >= 0 {
+					v.Name, v.Pattern = tpl[start:colon], tpl[colon+1:i]
+				}
+				vars = append(vars, v)
+				start = -1
+			}
+		}
+	}
+	return vars
+}
+
+// Validate checks every named route registered on r. Each route must be able
+// to build a URL from sample values for its variables (taken from vars, then
+// SampleRouteVars), and a request for that URL must be matched by the same
+// route. The latter catches routes shadowed by a broader route registered
+// before them. All problems found are reported in the returned error.
+func Validate(r *mux.Router, vars map[string]string) error {
+	var problems []string
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		name := route.GetName()
+		if name == "" {
+			return nil
+		}
+		if problem := validateRoute(r, route, vars); problem != "" {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, problem))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid routes:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+func validateRoute(r *mux.Router, route *mux.Route, vars map[string]string) string {
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return err.Error()
+	}
+
+	names := routeVarNames(tpl)
+	if hostTpl, err := route.GetHostTemplate(); err == nil {
+		names = append(names, routeVarNames(hostTpl)...)
+	}
+
+	var pairs []string
+	for _, name := range names {
+		v, ok := vars[name]
+		if !ok {
+			v, ok = SampleRouteVars[name]
+		}
+		if !ok {
+			return fmt.Sprintf("no sample value for route variable %q in %s", name, tpl)
+		}
+		pairs = append(pairs, name, v)
+	}
+
+	u, err := route.URL(pairs...)
+	if err != nil {
+		return fmt.Sprintf("building URL for %s: %s", tpl, err)
+	}
+
+	method := "GET"
+	if methods, err := route.GetMethods(); err == nil && len(methods) > 0 {
+		method = methods[0]
+	}
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return fmt.Sprintf("building request for %s: %s", u, err)
+	}
+
+	var match mux.RouteMatch
+	if !r.Match(req, &match) || match.Route == nil {
+		return fmt.Sprintf("%s %s does not match any route", method, u)
+	}
+	if match.Route != route {
+		return fmt.Sprintf("%s %s is shadowed by route %q", method, u, match.Route.GetName())
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+package router
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestValidate(t *testing.T) {
+	if err := Validate(Router(), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidate_problems(t *testing.T) {
+	r := mux.NewRouter()
+	r.PathPrefix("/users").Methods("GET").Name("users")
+	r.Path("/users/{username}/settings").Methods("GET").Name("user.settings")
+	r.Path("/orgs/{org}").Methods("GET").Name("org")
+
+	err := Validate(r, map[string]string{"username": "alice"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{
+		`user.settings: GET /users/alice/settings is shadowed by route "users"`,
+		`org: no sample value for route variable "org"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%s", want, err)
+		}
+	}
+}
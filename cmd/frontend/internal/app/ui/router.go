@@ -19,6 +19,7 @@ import (
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/envvar"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/app/router"
 	uirouter "github.com/sourcegraph/sourcegraph/cmd/frontend/internal/app/ui/router"
 	"github.com/sourcegraph/sourcegraph/internal/conf"
 	"github.com/sourcegraph/sourcegraph/internal/env"
@@ -98,8 +99,12 @@ func Router() *mux.Router {
 var mockServeRepo func(w http.ResponseWriter, r *http.Request)
 
 func newRouter() *mux.Router {
-	r := mux.NewRouter()
-	r.StrictSlash(true)
+	root := mux.NewRouter()
+	root.StrictSlash(true)
+
+	// The UI router is mounted in the app router, so it must match the base
+	// path too.
+	r := router.WithBasePath(root)
 
 	// Top-level routes.
 	r.Path("/").Methods("GET").Name(routeHome)
@@ -156,6 +161,8 @@ func newRouter() *mux.Router {
 	repo.PathPrefix("/commit").Methods("GET").Name(routeRepoCommit)
 	repo.PathPrefix("/branches").Methods("GET").Name(routeRepoBranches)
 	repo.PathPrefix("/tags").Methods("GET").Name(routeRepoTags)
+	// Must come before routeRepoCompare, whose prefix also matches it.
+	repo.Path("/compare-repo/" + routevar.BaseRepo + routevar.BaseRevSuffix).Methods("GET").Name(uirouter.RouteRepoCompareBaseRepo)
 	repo.PathPrefix("/compare").Methods("GET").Name(routeRepoCompare)
 	repo.PathPrefix("/stats").Methods("GET").Name(routeRepoStats)
 
@@ -164,7 +171,7 @@ func newRouter() *mux.Router {
 	repoRev.Path("/{dummy:def|refs}/" + routevar.Def).Methods("GET").Name(routeLegacyDefRedirectToDefLanding)
 	repoRev.Path("/info/" + routevar.Def).Methods("GET").Name(routeLegacyDefLanding)
 	repoRev.Path("/land/" + routevar.Def).Methods("GET").Name(routeLegacyOldRouteDefLanding)
-	return r
+	return root
 }
 
 func init() {
@@ -182,6 +189,7 @@ func initRouter() {
 	// basic pages with static titles
 	router := newRouter()
 	uirouter.Router = router // make accessible to other packages
+	router.Use(uirouter.RouteMetadata.DeprecationMiddleware)
 	router.Get(routeHome).Handler(handler(serveHome))
 	router.Get(routeThreads).Handler(handler(serveBrandedPageString("Threads")))
 	router.Get(routeCampaigns).Handler(handler(serveBrandedPageString("Campaigns")))
@@ -199,6 +207,7 @@ func initRouter() {
 	router.Get(routeRepoCommits).Handler(handler(serveBrandedPageString("Commits")))
 	router.Get(routeRepoTags).Handler(handler(serveBrandedPageString("Tags")))
 	router.Get(routeRepoCompare).Handler(handler(serveBrandedPageString("Compare")))
+	router.Get(uirouter.RouteRepoCompareBaseRepo).Handler(handler(serveBrandedPageString("Compare")))
 	router.Get(routeRepoStats).Handler(handler(serveBrandedPageString("Stats")))
 	router.Get(routeSearchScope).Handler(handler(serveBrandedPageString("Search scope")))
 	router.Get(routeSurvey).Handler(handler(serveBrandedPageString("Survey")))
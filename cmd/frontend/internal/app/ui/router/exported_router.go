@@ -1,7 +1,12 @@
 // Package router contains the route names for our app UI.
 package router
 
-import "github.com/gorilla/mux"
+import (
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/app/router"
+)
 
 // Router is the UI router.
 //
@@ -15,4 +20,34 @@ const (
 	RouteSignUp        = "sign-up"
 	RoutePasswordReset = "password-reset"
 	RouteRaw           = "raw"
+
+	// RouteRepoCompareBaseRepo compares a repository revision against a
+	// revision of another (base) repository, such as a fork's upstream. See
+	// routevar.BaseRepoRevRouteVars.
+	RouteRepoCompareBaseRepo = "repo-compare-base-repo"
 )
+
+// URLTo returns the path of the named route of Router, with the given route
+// vars (as alternating name/value pairs). It panics if the route does not
+// exist.
+func URLTo(routeName string, params ...string) *url.URL {
+	route := Router.Get(routeName)
+	if route == nil {
+		panic("no route named " + routeName)
+	}
+	u, err := router.RouteURLPath(route, params...)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// RouteMetadata is the metadata of the routes of Router.
+//
+// 🚨 SECURITY: Routes marked AuthPublic can be accessed by anonymous users. They MUST NOT leak any
+// sensitive data or allow unprivileged users to perform undesired actions.
+var RouteMetadata = router.MetadataMap{
+	RouteSignIn:        {Auth: router.AuthPublic},
+	RouteSignUp:        {Auth: router.AuthPublic},
+	RoutePasswordReset: {Auth: router.AuthPublic},
+}
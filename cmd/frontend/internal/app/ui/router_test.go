@@ -16,6 +16,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/routevar"
 )
 
 func init() {
@@ -121,6 +122,23 @@ func TestRouter(t *testing.T) {
 			wantVars:  map[string]string{"Repo": "r", "Rev": "@v", "Path": "/d/f"},
 		},
 
+		// compare
+		{
+			path:      "/r/-/compare/a...b",
+			wantRoute: routeRepoCompare,
+			wantVars:  map[string]string{"Repo": "r", "Rev": ""},
+		},
+		{
+			path:      "/r/r@v/-/compare-repo/u/r@w",
+			wantRoute: uirouter.RouteRepoCompareBaseRepo,
+			wantVars:  map[string]string{"Repo": "r/r", "Rev": "@v", "BaseRepo": "u/r", "BaseRev": "@w"},
+		},
+		{
+			path:      "/r/-/compare-repo/u/r",
+			wantRoute: uirouter.RouteRepoCompareBaseRepo,
+			wantVars:  map[string]string{"Repo": "r", "Rev": "", "BaseRepo": "u/r", "BaseRev": ""},
+		},
+
 		// about.sourcegraph.com redirects
 		{
 			path:      "/about",
@@ -204,6 +222,19 @@ func TestRouter(t *testing.T) {
 	}
 }
 
+func TestURLTo_compareBaseRepo(t *testing.T) {
+	var params []string
+	for k, v := range routevar.RepoRevRouteVars(routevar.RepoRev{Repo: "fork/r", Rev: "feature"}) {
+		params = append(params, k, v)
+	}
+	for k, v := range routevar.BaseRepoRevRouteVars(routevar.RepoRev{Repo: "upstream/r", Rev: "master"}) {
+		params = append(params, k, v)
+	}
+	if got, want := uirouter.URLTo(uirouter.RouteRepoCompareBaseRepo, params...).String(), "/fork/r@feature/-/compare-repo/upstream/r@master"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
 func TestRouter_RootPath(t *testing.T) {
 	tests := []struct {
 		repo   api.RepoName
@@ -0,0 +1,183 @@
+// Package archivestore fetches the tar archives of commits from a store of
+// pre-staged archives, such as an S3 bucket shared by symbols replicas, and
+// from gitserver if the store doesn't have them.
+package archivestore
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// Store holds the tar archives of commits.
+type Store interface {
+	// Get returns the archive of repo at commit, or ErrNotFound if the
+	// store doesn't have it.
+	Get(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error)
+
+	// Put stores the archive of repo at commit.
+	Put(ctx context.Context, repo api.RepoName, commit api.CommitID, archive io.ReadSeeker) error
+}
+
+// ErrNotFound is returned by Store.Get for an archive the store doesn't have.
+var ErrNotFound = errors.New("archive not found")
+
+// FetchTarFunc fetches the tar archive of a repository at a commit, as
+// symbols.Service.FetchTar does.
+type FetchTarFunc func(context.Context, gitserver.Repo, api.CommitID) (io.ReadCloser, error)
+
+// Fetcher fetches archives from Store, and from Fallback (such as gitserver)
+// if Store doesn't have them or fails.
+type Fetcher struct {
+	Store    Store
+	Fallback FetchTarFunc
+
+	// WriteBack if true writes the archives fetched from Fallback to Store,
+	// so that the next fetch of the same commit (by any replica) doesn't
+	// need Fallback. An archive is buffered in a temporary file in TempDir
+	// (os.TempDir() if empty) while it is read, and only written back if it
+	// was read completely.
+	WriteBack bool
+	TempDir   string
+}
+
+// writeBackTimeout is how long writing an archive back to the store may
+// take.
+const writeBackTimeout = 10 * time.Minute
+
+// maxTrailingBytes is how much of an archive is read on Close to complete
+// it, if its reader stopped before the end. A tar reader stops at the end of
+// archive marker, before the padding up to the archive's blocking factor.
+const maxTrailingBytes = 1 << 20
+
+// FetchTar fetches the archive of repo at commit. Only archives of absolute
+// commit IDs are fetched from or written to Store, since what any other
+// revision refers to changes.
+func (f *Fetcher) FetchTar(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+	if !isAbsoluteCommitID(commit) {
+		return f.Fallback(ctx, repo, commit)
+	}
+
+	archive, err := f.Store.Get(ctx, repo.Name, commit)
+	if err == nil {
+		fetches.WithLabelValues("hit").Inc()
+		return archive, nil
+	}
+	if err == ErrNotFound {
+		fetches.WithLabelValues("miss").Inc()
+	} else {
+		fetches.WithLabelValues("error").Inc()
+		log15.Warn("Failed to get archive from the archive store, fetching it instead.", "repo", repo.Name, "commit", commit, "error", err)
+	}
+
+	archive, err = f.Fallback(ctx, repo, commit)
+	if err != nil || !f.WriteBack {
+		return archive, err
+	}
+	tmp, err := ioutil.TempFile(f.TempDir, "symbols-archive-*.tar")
+	if err != nil {
+		log15.Warn("Failed to create a temporary file for writing an archive back to the archive store.", "error", err)
+		return archive, nil
+	}
+	return &writeBackReader{ReadCloser: archive, tmp: tmp, store: f.Store, repo: repo.Name, commit: commit}, nil
+}
+
+// writeBackReader copies an archive to a temporary file while it is read, and
+// writes it to the store when it is closed if it was read completely.
+type writeBackReader struct {
+	io.ReadCloser
+	tmp    *os.File
+	tmpErr error // the first error writing to tmp
+	eof    bool
+
+	store  Store
+	repo   api.RepoName
+	commit api.CommitID
+}
+
+func (r *writeBackReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && r.tmpErr == nil {
+		_, r.tmpErr = r.tmp.Write(p[:n])
+	}
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+func (r *writeBackReader) Close() error {
+	if !r.eof && r.tmpErr == nil {
+		if _, err := io.CopyN(r.tmp, r.ReadCloser, maxTrailingBytes); err == io.EOF {
+			r.eof = true
+		}
+	}
+	err := r.ReadCloser.Close()
+	if !r.eof || r.tmpErr != nil || err != nil {
+		r.removeTemp()
+		return err
+	}
+
+	go func() {
+		defer r.removeTemp()
+		ctx, cancel := context.WithTimeout(context.Background(), writeBackTimeout)
+		defer cancel()
+		if _, err := r.tmp.Seek(0, io.SeekStart); err != nil {
+			log15.Warn("Failed to write archive back to the archive store.", "repo", r.repo, "commit", r.commit, "error", err)
+			return
+		}
+		if err := r.store.Put(ctx, r.repo, r.commit, r.tmp); err != nil {
+			log15.Warn("Failed to write archive back to the archive store.", "repo", r.repo, "commit", r.commit, "error", err)
+			return
+		}
+		writeBacks.Inc()
+	}()
+	return nil
+}
+
+func (r *writeBackReader) removeTemp() {
+	r.tmp.Close()
+	os.Remove(r.tmp.Name())
+}
+
+// isAbsoluteCommitID reports whether commit is a full 40 character hex commit
+// ID.
+func isAbsoluteCommitID(commit api.CommitID) bool {
+	if len(commit) != 40 {
+		return false
+	}
+	for _, c := range commit {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	fetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "archive_store",
+		Name:      "fetches",
+		Help:      "The total number of archives of absolute commits fetched, by whether the archive store had them (hit, miss or error).",
+	}, []string{"result"})
+	writeBacks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "archive_store",
+		Name:      "write_backs",
+		Help:      "The total number of fetched archives written back to the archive store.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(fetches)
+	prometheus.MustRegister(writeBacks)
+}
@@ -0,0 +1,120 @@
+package archivestore
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+)
+
+// memStore is a Store in memory.
+type memStore struct {
+	mu       sync.Mutex
+	archives map[api.CommitID]string
+	put      chan api.CommitID
+}
+
+func (s *memStore) Get(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	archive, ok := s.archives[commit]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return ioutil.NopCloser(strings.NewReader(archive)), nil
+}
+
+func (s *memStore) Put(ctx context.Context, repo api.RepoName, commit api.CommitID, archive io.ReadSeeker) error {
+	b, err := ioutil.ReadAll(archive)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.archives[commit] = string(b)
+	s.mu.Unlock()
+	s.put <- commit
+	return nil
+}
+
+func TestFetcher(t *testing.T) {
+	const (
+		staged  = api.CommitID("1111111111111111111111111111111111111111")
+		missing = api.CommitID("2222222222222222222222222222222222222222")
+		partial = api.CommitID("3333333333333333333333333333333333333333")
+	)
+	store := &memStore{archives: map[api.CommitID]string{staged: "staged"}, put: make(chan api.CommitID, 1)}
+	var fetched []api.CommitID
+	fetcher := &Fetcher{
+		Store: store,
+		Fallback: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			fetched = append(fetched, commit)
+			padding := maxTrailingBytes / 2 // read on Close
+			if commit == partial {
+				padding = 2 * maxTrailingBytes
+			}
+			return ioutil.NopCloser(strings.NewReader("fetched " + strings.Repeat("x", padding))), nil
+		},
+		WriteBack: true,
+	}
+	fetch := func(commit api.CommitID, n int64) string {
+		t.Helper()
+		archive, err := fetcher.FetchTar(context.Background(), gitserver.Repo{Name: "r"}, commit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(archive, n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if got := fetch(staged, 100); got != "staged" || len(fetched) != 0 {
+		t.Errorf("got %q (fetched %v), want the staged archive", got, fetched)
+	}
+
+	// A missing archive is fetched and written back, including the end its
+	// reader left unread.
+	if got := fetch(missing, 7); got != "fetched" {
+		t.Errorf("got %q, want the fetched archive", got)
+	}
+	select {
+	case commit := <-store.put:
+		if commit != missing {
+			t.Errorf("wrote back %s, want %s", commit, missing)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the fetched archive was not written back")
+	}
+	if got := store.archives[missing]; !strings.HasPrefix(got, "fetched ") || len(got) != len("fetched ")+maxTrailingBytes/2 {
+		t.Errorf("wrote back %d bytes, want the complete archive", len(got))
+	}
+
+	// An archive whose reader stopped long before its end is not written
+	// back.
+	fetch(partial, 7)
+	select {
+	case commit := <-store.put:
+		t.Errorf("wrote back the incomplete archive of %s", commit)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Revisions that aren't absolute commit IDs bypass the store.
+	fetched = nil
+	fetch("HEAD", 7)
+	if len(fetched) != 1 {
+		t.Errorf("got %d fetches of HEAD, want 1", len(fetched))
+	}
+	if _, ok := store.archives["HEAD"]; ok {
+		t.Error("wrote back the archive of HEAD")
+	}
+}
@@ -0,0 +1,68 @@
+package archivestore
+
+import (
+	"context"
+	"io"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/aws/external"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// S3Store is a Store of archives in an S3 bucket, as objects named
+// Prefix/repo/commit.tar.
+type S3Store struct {
+	Client *s3.Client
+	Bucket string
+	Prefix string
+}
+
+// NewS3Store returns an S3Store of the archives in bucket under prefix,
+// configured by the usual AWS environment variables and files (see
+// external.LoadDefaultAWSConfig). If endpoint is non-empty it is the URL of
+// an S3-compatible object store (such as MinIO) to use instead of AWS, whose
+// buckets are addressed by path.
+func NewS3Store(bucket, prefix, endpoint string) (*S3Store, error) {
+	config, err := external.LoadDefaultAWSConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "loading AWS config")
+	}
+	if endpoint != "" {
+		config.EndpointResolver = aws.ResolveWithEndpointURL(endpoint)
+	}
+	client := s3.New(config)
+	client.ForcePathStyle = endpoint != ""
+	return &S3Store{Client: client, Bucket: bucket, Prefix: prefix}, nil
+}
+
+func (s *S3Store) key(repo api.RepoName, commit api.CommitID) string {
+	return path.Join(s.Prefix, string(repo), string(commit)+".tar")
+}
+
+func (s *S3Store) Get(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+	resp, err := s.Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key(repo, commit)),
+	}).Send(ctx)
+	if err != nil {
+		if e, ok := err.(awserr.Error); ok && e.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, repo api.RepoName, commit api.CommitID, archive io.ReadSeeker) error {
+	_, err := s.Client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.key(repo, commit)),
+		Body:        archive,
+		ContentType: aws.String("application/x-tar"),
+	}).Send(ctx)
+	return err
+}
@@ -0,0 +1,64 @@
+package ctags
+
+import (
+	"path"
+	"strings"
+)
+
+// languageParser routes each file to the parser for its language.
+type languageParser struct {
+	fallback   Parser
+	parsers    map[string]Parser // keyed by lowercase language
+	extensions map[string]string // lowercase extension -> language
+}
+
+// NewLanguageParser returns a Parser that parses files whose language (see
+// LanguageForPath) has a parser in parsers with that parser, and all other
+// files with fallback (normally ctags). extensions maps file extensions to
+// languages, overriding LanguageForPath (see
+// ParserOptions.ExtensionLanguages). Languages and extensions are compared
+// ignoring case. Closing it closes all of the parsers.
+func NewLanguageParser(fallback Parser, parsers map[string]Parser, extensions map[string]string) Parser {
+	p := &languageParser{
+		fallback:   fallback,
+		parsers:    make(map[string]Parser, len(parsers)),
+		extensions: make(map[string]string, len(extensions)),
+	}
+	for language, parser := range parsers {
+		p.parsers[strings.ToLower(language)] = parser
+	}
+	for ext, language := range extensions {
+		p.extensions[strings.ToLower(ext)] = language
+	}
+	return p
+}
+
+func (p *languageParser) Parse(filePath string, content []byte) ([]Entry, error) {
+	_, parser := p.route(filePath)
+	return parser.Parse(filePath, content)
+}
+
+// ParseBatch parses the files of each parser as a batch.
+func (p *languageParser) ParseBatch(files []File) ([][]Entry, error) {
+	return parseRouted(files, func(f File) (string, Parser) { return p.route(f.Path) }, nil)
+}
+
+// route returns the parser of the file at filePath, and the lowercase
+// language it is the parser of ("" for fallback).
+func (p *languageParser) route(filePath string) (string, Parser) {
+	language, ok := p.extensions[strings.ToLower(path.Ext(filePath))]
+	if !ok {
+		language = LanguageForPath(filePath)
+	}
+	if parser, ok := p.parsers[strings.ToLower(language)]; ok {
+		return strings.ToLower(language), parser
+	}
+	return "", p.fallback
+}
+
+func (p *languageParser) Close() {
+	p.fallback.Close()
+	for _, parser := range p.parsers {
+		parser.Close()
+	}
+}
@@ -0,0 +1,103 @@
+package ctags
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeParser returns a single entry named after itself for every file.
+type fakeParser struct {
+	name   string
+	closed *bool
+}
+
+func (p fakeParser) Parse(path string, content []byte) ([]Entry, error) {
+	return []Entry{{Name: p.name, Path: path}}, nil
+}
+
+func (p fakeParser) Close() { *p.closed = true }
+
+func TestLanguageParser(t *testing.T) {
+	var ctagsClosed, pythonClosed bool
+	p := NewLanguageParser(fakeParser{"ctags", &ctagsClosed}, map[string]Parser{"python": fakeParser{"python", &pythonClosed}},
+		map[string]string{".star": "Python", ".JSX": "Python"})
+
+	for path, want := range map[string]string{
+		"a.py":     "python",
+		"b/C.PY":   "python",
+		"a.go":     "ctags",
+		"Makefile": "ctags",
+		"a.star":   "python",
+		"a.jsx":    "python",
+	} {
+		entries, err := p.Parse(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name != want {
+			t.Errorf("%s: got %+v, want an entry from the %s parser", path, entries, want)
+		}
+	}
+
+	p.Close()
+	if !ctagsClosed || !pythonClosed {
+		t.Errorf("expected all parsers to be closed, got ctags %v and python %v", ctagsClosed, pythonClosed)
+	}
+}
+
+func TestTreeSitterParser(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tree-sitter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The tagger echoes its argument into the first tag so that the test can
+	// check it is passed the path, and checks it is given the content.
+	command := filepath.Join(dir, "tagger")
+	script := `#!/bin/sh
+grep -q "def f" || exit 1
+echo '{"name":"f","syntax_type":"definition.function","is_definition":true,"row":0,"parent":"'"$1"'","parent_syntax_type":"definition.module"}'
+echo
+echo '{"name":"g","syntax_type":"call","is_definition":false,"row":2}'
+`
+	if err := ioutil.WriteFile(command, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := NewTreeSitterParser(command, "Python").Parse("a.py", []byte("def f():\n  pass\ng()\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{{Name: "f", Path: "a.py", Line: 1, Kind: "function", Language: "Python", Parent: "a.py", ParentKind: "module"}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %+v, want %+v", entries, want)
+	}
+
+	if _, err := NewTreeSitterParser(command, "Python").Parse("a.py", []byte("x = 1")); err == nil {
+		t.Error("expected an error when the command fails")
+	}
+}
+
+func TestExtensionMapArgs(t *testing.T) {
+	got := extensionMapArgs(map[string]string{".tmpl": "Go", ".inc": "PHP"})
+	want := []string{"--map-Go=+.tmpl", "--map-PHP=+.inc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExtensionForLanguage(t *testing.T) {
+	for language, want := range map[string]string{"go": ".go", "C++": ".cc", "Cobol": ""} {
+		if got := ExtensionForLanguage(language); got != want {
+			t.Errorf("%s: got %q, want %q", language, got, want)
+		}
+		if want != "" && !strings.EqualFold(LanguageForPath("a"+want), language) {
+			t.Errorf("%s: LanguageForPath does not map %s back to it", language, want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package ctags
+
+// File is a file to parse with ParseBatch.
+type File struct {
+	Path    string
+	Content []byte
+}
+
+// A BatchParser is a Parser that parses several files at once faster than
+// one at a time.
+type BatchParser interface {
+	Parser
+
+	// ParseBatch returns the entries of each of files, in order. An error
+	// fails the whole batch.
+	ParseBatch(files []File) ([][]Entry, error)
+}
+
+// ParseBatch parses files with p, at once if p is a BatchParser and one at a
+// time otherwise. It returns the entries of each file, in order. An error
+// fails the whole batch, and like an error of Parse means that p is broken.
+func ParseBatch(p Parser, files []File) ([][]Entry, error) {
+	if bp, ok := p.(BatchParser); ok {
+		return bp.ParseBatch(files)
+	}
+	entries := make([][]Entry, len(files))
+	for i, f := range files {
+		var err error
+		if entries[i], err = p.Parse(f.Path, f.Content); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// parseRouted parses each of files with the parser route returns for it, or
+// with parse if route returns a nil parser. The files routed to the same key
+// (and parser) are parsed as a batch (see ParseBatch).
+func parseRouted(files []File, route func(File) (key string, p Parser), parse func(File) []Entry) ([][]Entry, error) {
+	type batch struct {
+		parser  Parser
+		indexes []int // of the batch's files in files
+	}
+	var (
+		entries = make([][]Entry, len(files))
+		keys    []string
+		batches = map[string]*batch{}
+	)
+	for i, f := range files {
+		key, p := route(f)
+		if p == nil {
+			entries[i] = parse(f)
+			continue
+		}
+		if batches[key] == nil {
+			keys = append(keys, key)
+			batches[key] = &batch{parser: p}
+		}
+		batches[key].indexes = append(batches[key].indexes, i)
+	}
+	for _, key := range keys {
+		b := batches[key]
+		batchFiles := make([]File, len(b.indexes))
+		for j, i := range b.indexes {
+			batchFiles[j] = files[i]
+		}
+		batchEntries, err := ParseBatch(b.parser, batchFiles)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range b.indexes {
+			entries[i] = batchEntries[j]
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,167 @@
+package ctags
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("CTAGS_TEST_FAKE_PROCESS") != "" {
+		fakeCtagsProcess(os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeCtagsProcess speaks the interactive protocol of ctags, replying to each
+// request with an entry for each non-empty line of the file, named like the
+// line.
+func fakeCtagsProcess(stdin io.Reader, stdout io.Writer) {
+	in := bufio.NewReader(stdin)
+	out := bufio.NewWriter(stdout)
+	enc := json.NewEncoder(out)
+	_ = enc.Encode(reply{Typ: "program", Name: "Universal Ctags"})
+	_ = out.Flush()
+	for {
+		line, err := in.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			return
+		}
+		content := make([]byte, req.Size)
+		if _, err := io.ReadFull(in, content); err != nil {
+			return
+		}
+		for i, name := range strings.Split(string(content), "\n") {
+			if name != "" {
+				_ = enc.Encode(reply{Typ: "tag", Name: name, Path: req.Filename, Line: i + 1, Kind: "func"})
+			}
+		}
+		_ = enc.Encode(reply{Typ: "completed", Command: "generate-tags"})
+		_ = out.Flush()
+	}
+}
+
+// startFakeCtags starts a ctags process parser running fakeCtagsProcess.
+func startFakeCtags(t testing.TB) Parser {
+	t.Helper()
+	os.Setenv("CTAGS_TEST_FAKE_PROCESS", "1")
+	defer os.Unsetenv("CTAGS_TEST_FAKE_PROCESS")
+	p, err := NewParser(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// batchFiles returns n files with lines lines each.
+func batchFiles(n, lines int) []File {
+	files := make([]File, n)
+	for i := range files {
+		var content strings.Builder
+		for j := 0; j < lines; j++ {
+			fmt.Fprintf(&content, "func f%d_%d() {}\n", i, j)
+		}
+		files[i] = File{Path: fmt.Sprintf("f%d.go", i), Content: []byte(content.String())}
+	}
+	return files
+}
+
+func TestCtagsProcess_ParseBatch(t *testing.T) {
+	p := startFakeCtags(t)
+	defer p.Close()
+
+	// Enough output to fill the pipes to and from the process, which must
+	// not deadlock.
+	files := batchFiles(50, 2000)
+	got, err := ParseBatch(p, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(BatchParser); !ok {
+		t.Fatal("ctags process parser is not a BatchParser")
+	}
+	for i, f := range files {
+		want, err := p.Parse(f.Path, f.Content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got[i], want) {
+			t.Fatalf("%s: the batch got %d entries, want the %d entries of parsing it alone", f.Path, len(got[i]), len(want))
+		}
+	}
+}
+
+func TestParseBatch_routed(t *testing.T) {
+	var closed bool
+	languages := NewLanguageParser(fakeParser{"ctags", &closed}, map[string]Parser{"python": fakeParser{"python", &closed}}, nil)
+	p, err := NewExtractorParser(languages, []string{"make"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []File{
+		{Path: "a.py"},
+		{Path: "Makefile", Content: []byte("all:\n")},
+		{Path: "b.go"},
+		{Path: "c.py"},
+	}
+	entries, err := ParseBatch(p, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i, e := range entries {
+		if len(e) != 1 || e[0].Path != files[i].Path {
+			t.Fatalf("%s: got entries %+v, want one entry of the file", files[i].Path, e)
+		}
+		got = append(got, e[0].Name)
+	}
+	if want := []string{"python", "all", "ctags", "python"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries %v, want %v", got, want)
+	}
+}
+
+// BenchmarkCtagsProcess compares parsing files one at a time to parsing them
+// in batches, with universal-ctags if it is in PATH (otherwise only the
+// overhead of the protocol is measured, with fakeCtagsProcess).
+func BenchmarkCtagsProcess(b *testing.B) {
+	files := batchFiles(100, 20)
+	for _, batchSize := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("batch=%d", batchSize), func(b *testing.B) {
+			var p Parser
+			if _, err := exec.LookPath("universal-ctags"); err == nil {
+				if p, err = NewParser("universal-ctags"); err != nil {
+					b.Fatal(err)
+				}
+			} else {
+				p = startFakeCtags(b)
+			}
+			defer p.Close()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				for i := 0; i < len(files); i += batchSize {
+					var err error
+					if batchSize == 1 {
+						_, err = p.Parse(files[i].Path, files[i].Content)
+					} else {
+						_, err = ParseBatch(p, files[i:i+batchSize])
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Package ctagstest provides a fake ctags.Parser returning scripted symbols,
+// so that code using parsers can be tested without universal-ctags installed.
+package ctagstest
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+)
+
+// Parser is a fake ctags.Parser. It is safe for concurrent use, so a single
+// Parser can serve a whole pool (see New).
+type Parser struct {
+	// Entries are the entries returned for each file path. The Path of each
+	// entry is set to the path of the parsed file.
+	Entries map[string][]ctags.Entry
+
+	// Default are the entries returned for files not in Entries.
+	Default []ctags.Entry
+
+	// Errors are the errors returned for each file path, instead of entries.
+	Errors map[string]error
+
+	mu     sync.Mutex
+	parsed []string
+	closed int
+}
+
+var _ ctags.Parser = (*Parser)(nil)
+
+// New returns p. Its signature matches symbols.Service.NewParser, so that a
+// service can be given a fake with NewParser: p.New.
+func (p *Parser) New() (ctags.Parser, error) {
+	return p, nil
+}
+
+func (p *Parser) Parse(name string, content []byte) ([]ctags.Entry, error) {
+	p.mu.Lock()
+	p.parsed = append(p.parsed, name)
+	p.mu.Unlock()
+
+	if err := p.Errors[name]; err != nil {
+		return nil, err
+	}
+	scripted, ok := p.Entries[name]
+	if !ok {
+		scripted = p.Default
+	}
+	entries := make([]ctags.Entry, len(scripted))
+	for i, e := range scripted {
+		e.Path = name
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+func (p *Parser) Close() {
+	p.mu.Lock()
+	p.closed++
+	p.mu.Unlock()
+}
+
+// Parsed returns the paths of the files parsed so far, sorted. A file parsed
+// more than once is listed as many times.
+func (p *Parser) Parsed() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	parsed := append([]string(nil), p.parsed...)
+	sort.Strings(parsed)
+	return parsed
+}
+
+// Closed returns the number of times Close was called.
+func (p *Parser) Closed() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
@@ -0,0 +1,37 @@
+package ctagstest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+)
+
+func TestParser(t *testing.T) {
+	p := &Parser{
+		Entries: map[string][]ctags.Entry{"a.go": {{Name: "A", Kind: "func"}}},
+		Default: []ctags.Entry{{Name: "x"}},
+		Errors:  map[string]error{"bad.go": errors.New("crashed")},
+	}
+
+	entries, err := p.Parse("a.go", nil)
+	if want := []ctags.Entry{{Name: "A", Kind: "func", Path: "a.go"}}; err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("a.go: got %+v (error %v), want %+v", entries, err, want)
+	}
+	entries, err = p.Parse("b.js", nil)
+	if want := []ctags.Entry{{Name: "x", Path: "b.js"}}; err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("b.js: got %+v (error %v), want %+v", entries, err, want)
+	}
+	if _, err := p.Parse("bad.go", nil); err == nil {
+		t.Error("bad.go: expected an error")
+	}
+
+	if got, want := p.Parsed(), []string{"a.go", "b.js", "bad.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got parsed %v, want %v", got, want)
+	}
+	p.Close()
+	if p.Closed() != 1 {
+		t.Errorf("got %d closes, want 1", p.Closed())
+	}
+}
@@ -0,0 +1,242 @@
+package ctags
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// An extractor emits synthetic symbols for a well-known kind of configuration
+// file that ctags doesn't parse (well), such as each target of a Makefile.
+// The kinds of the symbols it emits are prefixed with its name and a dot, so
+// that they can't be mistaken for symbols of code.
+type extractor struct {
+	// language is the Entry.Language of the symbols.
+	language string
+
+	// matches reports whether the extractor handles a file with the base
+	// name.
+	matches func(name string) bool
+
+	// extract returns the symbols of a file, with unprefixed kinds.
+	extract func(content []byte) []Entry
+}
+
+// extractors are the available extractors, by name.
+var extractors = map[string]extractor{
+	"make": {
+		language: "Makefile",
+		matches: func(name string) bool {
+			return name == "Makefile" || name == "makefile" || name == "GNUmakefile" || path.Ext(name) == ".mk"
+		},
+		extract: extractMakeTargets,
+	},
+	"compose": {
+		language: "Docker Compose",
+		matches: func(name string) bool {
+			switch name {
+			case "docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml":
+				return true
+			}
+			return false
+		},
+		extract: extractComposeServices,
+	},
+	"bazel": {
+		language: "Bazel",
+		matches: func(name string) bool {
+			return name == "BUILD" || name == "BUILD.bazel"
+		},
+		extract: extractBazelTargets,
+	},
+}
+
+// Extractors returns the names of the available extractors (see
+// NewExtractorParser), sorted.
+func Extractors() []string {
+	names := make([]string, 0, len(extractors))
+	for name := range extractors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extractorParser parses the files handled by its extractors with them, and
+// all other files with fallback.
+type extractorParser struct {
+	fallback   Parser
+	extractors map[string]extractor
+}
+
+// NewExtractorParser returns a Parser that parses the well-known
+// configuration files handled by the named extractors (see Extractors) with
+// them, and all other files with fallback. The symbols of an extractor have
+// kinds prefixed with its name, such as "make.target":
+//
+//	make: the targets of Makefiles (make.target)
+//	compose: the services of docker-compose files (compose.service)
+//	bazel: the targets of Bazel BUILD files (bazel.target, with the rule as the signature)
+//
+// Closing it closes fallback.
+func NewExtractorParser(fallback Parser, names []string) (Parser, error) {
+	p := &extractorParser{fallback: fallback, extractors: make(map[string]extractor, len(names))}
+	for _, name := range names {
+		e, ok := extractors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown extractor %q (must be one of %s)", name, strings.Join(Extractors(), ", "))
+		}
+		p.extractors[name] = e
+	}
+	return p, nil
+}
+
+func (p *extractorParser) Parse(filePath string, content []byte) ([]Entry, error) {
+	if prefix := p.extractorFor(filePath); prefix != "" {
+		return p.extract(prefix, filePath, content), nil
+	}
+	return p.fallback.Parse(filePath, content)
+}
+
+// ParseBatch extracts the symbols of the files handled by extractors, and
+// parses the other files with fallback as a batch.
+func (p *extractorParser) ParseBatch(files []File) ([][]Entry, error) {
+	return parseRouted(files, func(f File) (string, Parser) {
+		if p.extractorFor(f.Path) != "" {
+			return "", nil
+		}
+		return "fallback", p.fallback
+	}, func(f File) []Entry {
+		return p.extract(p.extractorFor(f.Path), f.Path, f.Content)
+	})
+}
+
+// extractorFor returns the name of the extractor handling the file at
+// filePath, or "" if fallback parses it.
+func (p *extractorParser) extractorFor(filePath string) string {
+	name := path.Base(filePath)
+	for prefix, e := range p.extractors {
+		if e.matches(name) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// extract returns the symbols of a file extracted by the named extractor.
+func (p *extractorParser) extract(prefix, filePath string, content []byte) []Entry {
+	e := p.extractors[prefix]
+	entries := e.extract(content)
+	for i := range entries {
+		entries[i].Path = filePath
+		entries[i].Language = e.language
+		entries[i].Kind = prefix + "." + entries[i].Kind
+	}
+	return entries
+}
+
+func (p *extractorParser) Close() {
+	p.fallback.Close()
+}
+
+// lineEnding matches the line endings that the symbols service counts lines
+// by: LF, CRLF and a lone CR.
+var lineEnding = regexp.MustCompile("\r\n|\r|\n")
+
+// lines calls fn with each line of content and its (1-indexed) number.
+func lines(content []byte, fn func(line string, n int)) {
+	for i, line := range lineEnding.Split(string(content), -1) {
+		fn(line, i+1)
+	}
+}
+
+// makeTargetLine matches a Makefile rule, capturing its targets. Lines
+// starting with whitespace are recipes or continuations.
+var makeTargetLine = regexp.MustCompile(`^([^\s:=#][^:=#]*?)\s*::?(?:[^:=]|$)`)
+
+// extractMakeTargets returns the targets of a Makefile, leaving out pattern
+// rules and special targets like .PHONY.
+func extractMakeTargets(content []byte) []Entry {
+	var entries []Entry
+	lines(content, func(line string, n int) {
+		m := makeTargetLine.FindStringSubmatch(line)
+		if m == nil {
+			return
+		}
+		for _, target := range strings.Fields(m[1]) {
+			if strings.HasPrefix(target, ".") || strings.ContainsAny(target, "%$") {
+				continue
+			}
+			entries = append(entries, Entry{Name: target, Line: n, Kind: "target"})
+		}
+	})
+	return entries
+}
+
+// extractComposeServices returns the services of a docker-compose file: the
+// keys directly within its top level services key.
+func extractComposeServices(content []byte) []Entry {
+	var (
+		entries    []Entry
+		inServices bool
+		indent     = -1 // the indentation of the service keys, once known
+	)
+	lines(content, func(line string, n int) {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			return
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if lineIndent == 0 {
+			inServices = strings.HasPrefix(trimmed, "services:")
+			return
+		}
+		if !inServices {
+			return
+		}
+		if indent == -1 {
+			indent = lineIndent
+		}
+		if lineIndent != indent {
+			return
+		}
+		if i := strings.Index(trimmed, ":"); i > 0 {
+			entries = append(entries, Entry{Name: strings.Trim(trimmed[:i], `"'`), Line: n, Kind: "service"})
+		}
+	})
+	return entries
+}
+
+var (
+	// bazelRuleStart matches the start of a call to a rule at the top level
+	// of a BUILD file, capturing the rule.
+	bazelRuleStart = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.]*)\(`)
+
+	// bazelName matches the name attribute of a rule, capturing the name.
+	bazelName = regexp.MustCompile(`\bname\s*=\s*"([^"]+)"`)
+)
+
+// extractBazelTargets returns the targets of a Bazel BUILD file: the names of
+// the rules called at its top level, with the rule as the signature.
+func extractBazelTargets(content []byte) []Entry {
+	var (
+		entries []Entry
+		rule    string // the rule of the call being read, if its name is not known yet
+		line    int    // the line of the call being read
+	)
+	lines(content, func(text string, n int) {
+		if m := bazelRuleStart.FindStringSubmatch(text); m != nil {
+			rule, line = m[1], n
+		}
+		if rule == "" {
+			return
+		}
+		if m := bazelName.FindStringSubmatch(text); m != nil {
+			entries = append(entries, Entry{Name: m[1], Line: line, Kind: "target", Signature: rule})
+			rule = ""
+		}
+	})
+	return entries
+}
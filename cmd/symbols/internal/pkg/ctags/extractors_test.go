@@ -0,0 +1,122 @@
+package ctags
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractorParser(t *testing.T) {
+	var closed bool
+	p, err := NewExtractorParser(fakeParser{"ctags", &closed}, []string{"make", "compose", "bazel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		content string
+		want    []Entry
+	}{
+		"Makefile": {
+			content: strings.Join([]string{
+				".PHONY: all test",
+				"VAR := x",
+				"OTHER ::= y",
+				"all: build test",
+				"build test:",
+				"\tgo build ./...",
+				"%.o: %.c",
+				"clean::",
+			}, "\n"),
+			want: []Entry{
+				{Name: "all", Line: 4},
+				{Name: "build", Line: 5},
+				{Name: "test", Line: 5},
+				{Name: "clean", Line: 8},
+			},
+		},
+		"deploy/docker-compose.yml": {
+			content: strings.Join([]string{
+				"version: '3'",
+				"services:",
+				"  # the database",
+				"  db:",
+				"    image: postgres",
+				"    environment:",
+				"      POSTGRES_DB: x",
+				"  \"web\":",
+				"    ports: [80]",
+				"volumes:",
+				"  data:",
+			}, "\n"),
+			want: []Entry{{Name: "db", Line: 4}, {Name: "web", Line: 8}},
+		},
+		"a/BUILD.bazel": {
+			content: strings.Join([]string{
+				`load("@io_bazel_rules_go//go:def.bzl", "go_library")`,
+				``,
+				`go_library(`,
+				`    name = "a",`,
+				`    srcs = ["a.go"],`,
+				`)`,
+				`go_test(name = "a_test")`,
+			}, "\n"),
+			want: []Entry{{Name: "a", Line: 3, Signature: "go_library"}, {Name: "a_test", Line: 7, Signature: "go_test"}},
+		},
+	}
+	kinds := map[string]string{"Makefile": "make.target", "deploy/docker-compose.yml": "compose.service", "a/BUILD.bazel": "bazel.target"}
+	languages := map[string]string{"Makefile": "Makefile", "deploy/docker-compose.yml": "Docker Compose", "a/BUILD.bazel": "Bazel"}
+	for path, test := range tests {
+		for i := range test.want {
+			test.want[i].Path, test.want[i].Kind, test.want[i].Language = path, kinds[path], languages[path]
+		}
+		got, err := p.Parse(path, []byte(test.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", path, got, test.want)
+		}
+	}
+
+	if entries, _ := p.Parse("a.go", nil); len(entries) != 1 || entries[0].Name != "ctags" {
+		t.Errorf("a.go: got %+v, want an entry from the fallback parser", entries)
+	}
+	p.Close()
+	if !closed {
+		t.Error("expected the fallback parser to be closed")
+	}
+
+	if _, err := NewExtractorParser(nil, []string{"nope"}); err == nil {
+		t.Error("expected an error for an unknown extractor")
+	}
+}
+
+func TestExtractorParser_optIn(t *testing.T) {
+	var closed bool
+	p, err := NewExtractorParser(fakeParser{"ctags", &closed}, []string{"bazel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := p.Parse("Makefile", []byte("all:")); len(entries) != 1 || entries[0].Name != "ctags" {
+		t.Errorf("got %+v, want the Makefile to be left to the fallback parser", entries)
+	}
+}
+
+func TestExtractorParser_lineEndings(t *testing.T) {
+	p, err := NewExtractorParser(nil, []string{"make"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.Parse("Makefile", []byte("a:\r\nb:\rc:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []int
+	for _, e := range got {
+		lines = append(lines, e.Line)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("got lines %v, want %v", lines, want)
+	}
+}
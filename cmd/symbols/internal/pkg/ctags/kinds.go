@@ -0,0 +1,73 @@
+package ctags
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Kind is a kind of symbol of a language, as reported by ctags.
+type Kind struct {
+	Letter      string // the single letter ctags may report for the kind
+	Name        string
+	Description string
+}
+
+// ListKinds returns the kinds of symbols of each language, keyed by
+// language, by running `ctags --list-kinds-full`.
+func ListKinds(ctagsCommand string) (map[string][]Kind, error) {
+	out, err := exec.Command(ctagsCommand, "--list-kinds-full").Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s --list-kinds-full", ctagsCommand)
+	}
+	return parseKinds(bytes.NewReader(out))
+}
+
+// parseKinds parses the output of `ctags --list-kinds-full`, for example:
+//
+//	#LANGUAGE LETTER NAME     ENABLED REFONLY NROLES MASTER DESCRIPTION
+//	Go        f      func     yes     no      0      NONE   functions
+func parseKinds(r io.Reader) (map[string][]Kind, error) {
+	const columns = 8 // the description may contain spaces
+
+	kinds := map[string][]Kind{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < columns-1 {
+			return nil, errors.Errorf("unexpected ctags kind line: %q", line)
+		}
+		kind := Kind{Letter: fields[1], Name: fields[2]}
+		if len(fields) >= columns {
+			kind.Description = strings.Join(fields[columns-1:], " ")
+		}
+		kinds[fields[0]] = append(kinds[fields[0]], kind)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return kinds, nil
+}
+
+// Version returns the version of ctags: the first line of the output of
+// `ctags --version`, such as "Universal Ctags 0.0.0(a1b2c3d), Copyright (C)
+// 2015 Universal Ctags Team".
+func Version(ctagsCommand string) (string, error) {
+	out, err := exec.Command(ctagsCommand, "--version").Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "%s --version", ctagsCommand)
+	}
+	line := out
+	if i := bytes.IndexByte(out, '\n'); i >= 0 {
+		line = out[:i]
+	}
+	return strings.TrimSpace(string(line)), nil
+}
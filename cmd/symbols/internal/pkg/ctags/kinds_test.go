@@ -0,0 +1,35 @@
+package ctags
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKinds(t *testing.T) {
+	out := `#LANGUAGE      LETTER NAME       ENABLED REFONLY NROLES MASTER DESCRIPTION
+Go             p      package    yes     no      0      NONE   packages
+Go             f      func       yes     no      0      NONE   functions
+Java           m      method     yes     no      0      NONE   methods
+Python         x      unknown    yes     no      0      NONE
+`
+	got, err := parseKinds(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]Kind{
+		"Go": {
+			{Letter: "p", Name: "package", Description: "packages"},
+			{Letter: "f", Name: "func", Description: "functions"},
+		},
+		"Java":   {{Letter: "m", Name: "method", Description: "methods"}},
+		"Python": {{Letter: "x", Name: "unknown"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := parseKinds(strings.NewReader("Go f func\n")); err == nil {
+		t.Error("expected error for malformed line")
+	}
+}
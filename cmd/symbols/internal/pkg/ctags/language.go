@@ -0,0 +1,63 @@
+package ctags
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// extensionLanguages maps file extensions to ctags language names, for the
+// languages that may be routed to another parser backend. Files with other
+// extensions are left to ctags to detect.
+var extensionLanguages = map[string]string{
+	".c":    "C",
+	".h":    "C",
+	".cc":   "C++",
+	".cpp":  "C++",
+	".hpp":  "C++",
+	".cs":   "C#",
+	".go":   "Go",
+	".java": "Java",
+	".js":   "JavaScript",
+	".jsx":  "JavaScript",
+	".php":  "PHP",
+	".py":   "Python",
+	".rb":   "Ruby",
+	".rs":   "Rust",
+	".ts":   "TypeScript",
+	".tsx":  "TSX",
+}
+
+// LanguageForPath returns the ctags name of the language of the file at
+// filePath, judging by its extension, or "" if it is not known.
+func LanguageForPath(filePath string) string {
+	return extensionLanguages[strings.ToLower(path.Ext(filePath))]
+}
+
+// extensionMapArgs returns the ctags arguments that map the extensions in
+// extensionLanguages to their languages, sorted so that the command line is
+// deterministic.
+func extensionMapArgs(extensionLanguages map[string]string) []string {
+	args := make([]string, 0, len(extensionLanguages))
+	for ext, language := range extensionLanguages {
+		args = append(args, "--map-"+language+"=+"+ext)
+	}
+	sort.Strings(args)
+	return args
+}
+
+// ExtensionForLanguage returns a file extension (including the dot) that
+// LanguageForPath maps to language, ignoring case, or "" if there is none.
+func ExtensionForLanguage(language string) string {
+	var exts []string
+	for ext, l := range extensionLanguages {
+		if strings.EqualFold(l, language) {
+			exts = append(exts, ext)
+		}
+	}
+	if len(exts) == 0 {
+		return ""
+	}
+	sort.Strings(exts)
+	return exts[0]
+}
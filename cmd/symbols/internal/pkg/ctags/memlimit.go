@@ -0,0 +1,32 @@
+package ctags
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMemoryLimitExceeded is returned by a parser whose process failed
+// because it hit ParserOptions.MemoryLimit. The parser can't be used anymore.
+var ErrMemoryLimitExceeded = errors.New("ctags exceeded its memory limit")
+
+// oomWriter passes the stderr of a ctags process through to w, noting
+// whether ctags reported that it ran out of memory (which with a memory
+// limit is how an allocation beyond it ends).
+type oomWriter struct {
+	w   io.Writer
+	oom int32 // accessed atomically
+}
+
+func (o *oomWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("out of memory")) {
+		atomic.StoreInt32(&o.oom, 1)
+	}
+	return o.w.Write(p)
+}
+
+func (o *oomWriter) outOfMemory() bool {
+	return atomic.LoadInt32(&o.oom) != 0
+}
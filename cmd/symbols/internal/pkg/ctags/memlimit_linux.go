@@ -0,0 +1,18 @@
+package ctags
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// setMemoryLimit limits the virtual memory (RLIMIT_AS) of process pid to
+// limit bytes, so that an allocation beyond it fails in the process instead
+// of taking memory from the rest of the host.
+func setMemoryLimit(pid int, limit int64) error {
+	rlimit := unix.Rlimit{Cur: uint64(limit), Max: uint64(limit)}
+	if _, _, errno := unix.RawSyscall6(unix.SYS_PRLIMIT64, uintptr(pid), unix.RLIMIT_AS, uintptr(unsafe.Pointer(&rlimit)), 0, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
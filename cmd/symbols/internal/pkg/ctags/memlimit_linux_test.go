@@ -0,0 +1,29 @@
+package ctags
+
+import (
+	"os/exec"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSetMemoryLimit(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("failed to start sleep: %s", err)
+	}
+	defer cmd.Process.Kill()
+
+	const limit = 1 << 30
+	if err := setMemoryLimit(cmd.Process.Pid, limit); err != nil {
+		t.Fatal(err)
+	}
+	var got unix.Rlimit
+	if _, _, errno := unix.RawSyscall6(unix.SYS_PRLIMIT64, uintptr(cmd.Process.Pid), unix.RLIMIT_AS, 0, uintptr(unsafe.Pointer(&got)), 0, 0); errno != 0 {
+		t.Fatal(errno)
+	}
+	if got.Cur != limit || got.Max != limit {
+		t.Errorf("got limit %+v, want %d", got, limit)
+	}
+}
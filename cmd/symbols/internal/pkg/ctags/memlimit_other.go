@@ -0,0 +1,12 @@
+// +build !linux
+
+package ctags
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func setMemoryLimit(pid int, limit int64) error {
+	return fmt.Errorf("limiting process memory is not supported on %s", runtime.GOOS)
+}
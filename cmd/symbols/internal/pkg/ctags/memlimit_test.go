@@ -0,0 +1,26 @@
+package ctags
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOOMWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &oomWriter{w: &buf}
+	if _, err := w.Write([]byte("ctags: Warning: ignoring null tag\n")); err != nil {
+		t.Fatal(err)
+	}
+	if w.outOfMemory() {
+		t.Fatal("got out of memory after a warning")
+	}
+	if _, err := w.Write([]byte("ctags: out of memory\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !w.outOfMemory() {
+		t.Error("got no out of memory after ctags reported it")
+	}
+	if got, want := buf.String(), "ctags: Warning: ignoring null tag\nctags: out of memory\n"; got != want {
+		t.Errorf("got stderr %q, want %q", got, want)
+	}
+}
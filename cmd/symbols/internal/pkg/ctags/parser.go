@@ -9,6 +9,8 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/internal/env"
@@ -58,6 +60,62 @@ func GetCommand() string {
 }
 
 func NewParser(ctagsCommand string) (Parser, error) {
+	return NewParserWithOptions(ctagsCommand, ParserOptions{})
+}
+
+// ParserOptions configure the ctags process started by NewParserWithOptions.
+type ParserOptions struct {
+	// Nice is the nice level (from -20 to 19, higher is lower priority) to run
+	// the process at. On Linux the I/O priority is lowered to match. Zero
+	// leaves the priority unchanged.
+	Nice int
+
+	// ExtensionLanguages maps file extensions (including the dot, such as
+	// ".tmpl") to the name of the language ctags should parse files with
+	// that extension as, overriding its own detection. Other extensions are
+	// detected by ctags as usual.
+	ExtensionLanguages map[string]string
+
+	// Languages when non-empty restricts the process to parsing files of
+	// these languages (a subset of DefaultLanguages, see SupportedLanguage).
+	// Files of other languages have no symbols.
+	Languages []string
+
+	// MemoryLimit when positive is the maximum virtual memory of the process
+	// in bytes (only supported on Linux, elsewhere the process fails to
+	// start). An allocation beyond it fails in ctags, which then exits, so
+	// the file being parsed fails and the process must be replaced. Zero
+	// leaves the memory unlimited.
+	MemoryLimit int64
+}
+
+// DefaultLanguages are the languages ctags parses, unless restricted by
+// ParserOptions.Languages.
+var DefaultLanguages = []string{"Basic", "C", "C#", "C++", "Clojure", "Cobol", "CSS", "CUDA", "D", "Elixir", "elm", "Erlang", "Go", "GraphQL", "Groovy", "haskell", "Java", "JavaScript", "kotlin", "Lisp", "Lua", "MatLab", "ObjectiveC", "OCaml", "Pascal", "Perl", "Perl6", "PHP", "Protobuf", "Python", "R", "Ruby", "Rust", "scala", "Scheme", "Sh", "swift", "SystemVerilog", "Tcl", "typescript", "tsx", "Verilog", "VHDL", "Vim"}
+
+// SupportedLanguage returns the name in DefaultLanguages of language, which
+// is compared ignoring case, or "" if ctags doesn't parse it.
+func SupportedLanguage(language string) string {
+	for _, l := range DefaultLanguages {
+		if strings.EqualFold(l, language) {
+			return l
+		}
+	}
+	return ""
+}
+
+// languagesArg returns the ctags argument enabling languages, or
+// DefaultLanguages if it is empty.
+func languagesArg(languages []string) string {
+	if len(languages) == 0 {
+		languages = DefaultLanguages
+	}
+	return "--languages=" + strings.Join(languages, ",")
+}
+
+var priorityWarning sync.Once
+
+func NewParserWithOptions(ctagsCommand string, opts ParserOptions) (Parser, error) {
 	opt := "default"
 
 	// TODO(sqs): Figure out why running with --_interactive=sandbox causes `Bad system call` inside Docker, and
@@ -67,10 +125,12 @@ func NewParser(ctagsCommand string) (Parser, error) {
 	//  opt = "sandbox"
 	// }
 
-	cmd := exec.Command(ctagsCommand, "--_interactive="+opt, "--fields=*",
-		"--languages=Basic,C,C#,C++,Clojure,Cobol,CSS,CUDA,D,Elixir,elm,Erlang,Go,GraphQL,Groovy,haskell,Java,JavaScript,kotlin,Lisp,Lua,MatLab,ObjectiveC,OCaml,Pascal,Perl,Perl6,PHP,Protobuf,Python,R,Ruby,Rust,scala,Scheme,Sh,swift,SystemVerilog,Tcl,typescript,tsx,Verilog,VHDL,Vim",
+	args := []string{"--_interactive=" + opt, "--fields=*",
+		languagesArg(opts.Languages),
 		"--map-CSS=+.scss", "--map-CSS=+.less", "--map-CSS=+.sass",
-	)
+	}
+	args = append(args, extensionMapArgs(opts.ExtensionLanguages)...)
+	cmd := exec.Command(ctagsCommand, args...)
 	in, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, err
@@ -81,18 +141,40 @@ func NewParser(ctagsCommand string) (Parser, error) {
 		in.Close()
 		return nil, err
 	}
-	cmd.Stderr = os.Stderr
 	proc := ctagsProcess{
 		cmd:     cmd,
 		in:      in,
 		out:     bufio.NewScanner(out),
 		outPipe: out,
 	}
+	if opts.MemoryLimit > 0 {
+		proc.stderr = &oomWriter{w: os.Stderr}
+		cmd.Stderr = proc.stderr
+	} else {
+		cmd.Stderr = os.Stderr
+	}
 
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
 
+	if opts.Nice != 0 {
+		if err := setPriority(cmd.Process.Pid, opts.Nice); err != nil {
+			// Parsing at normal priority is better than not parsing at all.
+			priorityWarning.Do(func() {
+				log.Printf("failed to set the priority of ctags processes to nice %d: %s", opts.Nice, err)
+			})
+		}
+	}
+	if opts.MemoryLimit > 0 {
+		// Unlike the priority, the limit is relied on to bound the memory of
+		// the service, so a process without it is not used.
+		if err := setMemoryLimit(cmd.Process.Pid, opts.MemoryLimit); err != nil {
+			proc.Close()
+			return nil, errors.Wrapf(err, "limiting the memory of %s to %d bytes", ctagsCommand, opts.MemoryLimit)
+		}
+	}
+
 	var init reply
 	if err := proc.read(&init); err != nil {
 		proc.Close()
@@ -112,6 +194,10 @@ type ctagsProcess struct {
 	in      io.WriteCloser
 	out     *bufio.Scanner
 	outPipe io.ReadCloser
+
+	// stderr, if the process has a memory limit, notes whether it ran out
+	// of memory.
+	stderr *oomWriter
 }
 
 func (p *ctagsProcess) Close() {
@@ -127,6 +213,15 @@ func (p *ctagsProcess) read(rep *reply) error {
 			// p.out.Err() returns nil if the Scanner hit EOF,
 			// but EOF is unexpected and means the process is bad and needs to be cleaned up
 			err = errors.New("unexpected EOF from ctags")
+			if p.stderr != nil {
+				// Wait for the process to exit and its stderr to be
+				// copied, to tell whether it hit its memory limit.
+				_ = p.cmd.Process.Kill()
+				_ = p.cmd.Wait()
+				if p.stderr.outOfMemory() {
+					err = ErrMemoryLimitExceeded
+				}
+			}
 		}
 		return err
 	}
@@ -198,17 +293,59 @@ type reply struct {
 }
 
 func (p *ctagsProcess) Parse(name string, content []byte) (entries []Entry, err error) {
+	if err := p.postFile(name, content); err != nil {
+		return nil, err
+	}
+	return p.readEntries(name)
+}
+
+// ParseBatch sends all of files to ctags before reading the entries of the
+// first. The interactive protocol has no command to parse several files, but
+// ctags handles requests in order, so this saves waiting for a round trip to
+// ctags between files.
+func (p *ctagsProcess) ParseBatch(files []File) ([][]Entry, error) {
+	// Requests are sent while replies are read, since ctags stops reading
+	// requests while its replies aren't read.
+	posted := make(chan error, 1)
+	go func() {
+		for _, f := range files {
+			if err := p.postFile(f.Path, f.Content); err != nil {
+				posted <- err
+				return
+			}
+		}
+		posted <- nil
+	}()
+
+	entries := make([][]Entry, len(files))
+	for i, f := range files {
+		var err error
+		if entries[i], err = p.readEntries(f.Path); err != nil {
+			// The process is broken, and closing it ends the sending of
+			// requests.
+			return nil, err
+		}
+	}
+	if err := <-posted; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// postFile sends the request to parse a file.
+func (p *ctagsProcess) postFile(name string, content []byte) error {
 	req := request{
 		Command:  "generate-tags",
 		Size:     len(content),
 		Filename: name,
 	}
+	return p.post(&req, content)
+}
 
-	if err := p.post(&req, content); err != nil {
-		return nil, err
-	}
-
-	entries = make([]Entry, 0, 250)
+// readEntries reads the entries of the file name, up to the reply that its
+// parse is completed.
+func (p *ctagsProcess) readEntries(name string) ([]Entry, error) {
+	entries := make([]Entry, 0, 250)
 	for {
 		var rep reply
 		if err := p.read(&rep); err != nil {
@@ -4,6 +4,7 @@ import (
 	"os"
 	"os/exec"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -106,3 +107,17 @@ class A implements B extends C {
 		}
 	}
 }
+
+func TestLanguagesArg(t *testing.T) {
+	if got, want := languagesArg([]string{"Go", "Python"}), "--languages=Go,Python"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := languagesArg(nil); !strings.HasPrefix(got, "--languages=Basic,C,") {
+		t.Errorf("got %q, want the default languages", got)
+	}
+	for language, want := range map[string]string{"python": "Python", "TypeScript": "typescript", "Fortran": ""} {
+		if got := SupportedLanguage(language); got != want {
+			t.Errorf("%s: got %q, want %q", language, got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package ctags
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ioprioWhoProcess   = 1 // IOPRIO_WHO_PROCESS
+	ioprioClassBE      = 2 // IOPRIO_CLASS_BE, the best-effort scheduling class
+	ioprioClassShift   = 13
+	ioprioBELevelCount = 8
+)
+
+// setPriority sets the CPU nice level of process pid to nice, and its I/O
+// priority to the matching best-effort level (the kernel's default mapping
+// from the nice level).
+func setPriority(pid, nice int) error {
+	if err := unix.Setpriority(unix.PRIO_PROCESS, pid, nice); err != nil {
+		return err
+	}
+
+	level := (nice + 20) / 5
+	if level >= ioprioBELevelCount {
+		level = ioprioBELevelCount - 1
+	}
+	ioprio := ioprioClassBE<<ioprioClassShift | level
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(ioprio)); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package ctags
+
+import (
+	"os/exec"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSetPriority(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("failed to start sleep: %s", err)
+	}
+	defer cmd.Process.Kill()
+
+	if err := setPriority(cmd.Process.Pid, 10); err != nil {
+		t.Fatal(err)
+	}
+	// The raw getpriority syscall returns 20 - nice.
+	prio, err := unix.Getpriority(unix.PRIO_PROCESS, cmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := 20 - prio; got != 10 {
+		t.Errorf("got nice %d, want 10", got)
+	}
+}
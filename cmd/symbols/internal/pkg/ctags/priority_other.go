@@ -0,0 +1,12 @@
+// +build !linux
+
+package ctags
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func setPriority(pid, nice int) error {
+	return fmt.Errorf("setting process priority is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,84 @@
+package ctags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// treeSitterTag is a tag as written by a tree-sitter tagger command: one JSON
+// object per line, with the fields of tree-sitter's tags.Tag.
+type treeSitterTag struct {
+	Name         string `json:"name"`
+	SyntaxType   string `json:"syntax_type"` // e.g. "function" or "definition.function"
+	IsDefinition bool   `json:"is_definition"`
+	Row          int    `json:"row"` // 0-indexed
+	Parent       string `json:"parent"`
+	ParentType   string `json:"parent_syntax_type"`
+}
+
+// treeSitterParser parses files by running a tree-sitter tagger command.
+type treeSitterParser struct {
+	command  string
+	language string
+}
+
+// NewTreeSitterParser returns a Parser that runs command for each file, with
+// the file's path as its only argument and its content on stdin. The command
+// must use tree-sitter's tagging queries for the file's language and write
+// each tag as a JSON line with the fields name, syntax_type, is_definition,
+// row (0-indexed) and optionally parent and parent_syntax_type.
+//
+// The tags are normalized to ctags entries for language: references are
+// dropped, rows become 1-indexed lines and syntax types like
+// "definition.function" become kinds like "function".
+func NewTreeSitterParser(command, language string) Parser {
+	return &treeSitterParser{command: command, language: language}
+}
+
+func (p *treeSitterParser) Parse(path string, content []byte) ([]Entry, error) {
+	cmd := exec.Command(p.command, path)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "running %s", p.command)
+	}
+
+	var entries []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var tag treeSitterTag
+		if err := json.Unmarshal(scanner.Bytes(), &tag); err != nil {
+			return nil, errors.Wrapf(err, "decoding %s output %q", p.command, scanner.Text())
+		}
+		if !tag.IsDefinition {
+			continue
+		}
+		entries = append(entries, Entry{
+			Name:       tag.Name,
+			Path:       path,
+			Line:       tag.Row + 1,
+			Kind:       treeSitterKind(tag.SyntaxType),
+			Language:   p.language,
+			Parent:     tag.Parent,
+			ParentKind: treeSitterKind(tag.ParentType),
+		})
+	}
+	return entries, scanner.Err()
+}
+
+func (p *treeSitterParser) Close() {}
+
+// treeSitterKind returns the ctags-style kind of a tree-sitter syntax type.
+func treeSitterKind(syntaxType string) string {
+	return strings.TrimPrefix(syntaxType, "definition.")
+}
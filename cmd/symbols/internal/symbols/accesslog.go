@@ -0,0 +1,143 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// Access log formats for Service.AccessLogFormat.
+const (
+	AccessLogCommon = "common" // the Common Log Format, followed by key=value fields
+	AccessLogJSON   = "json"   // one JSON object per line
+)
+
+// accessLogEntry is the information about a request that is logged in the
+// access log. Handlers fill in what they know about the request via
+// accessLogFromContext.
+type accessLogEntry struct {
+	Time       time.Time
+	RemoteAddr string
+	Method     string
+	Path       string
+	Proto      string
+	Status     int
+	Bytes      int64
+	Duration   time.Duration `json:"-"`
+	DurationMS float64
+
+	Repo     api.RepoName `json:",omitempty"`
+	CommitID api.CommitID `json:",omitempty"`
+	Symbols  int
+	Cache    string `json:",omitempty"` // "hit" or "miss", if the request used a cached commit
+}
+
+type accessLogKey struct{}
+
+// accessLogFromContext returns the access log entry of the request. If the
+// access log is disabled a throwaway entry is returned, so callers don't need
+// to check.
+func accessLogFromContext(ctx context.Context) *accessLogEntry {
+	if e, ok := ctx.Value(accessLogKey{}).(*accessLogEntry); ok {
+		return e
+	}
+	return &accessLogEntry{}
+}
+
+// setCacheHit records in the access log entry whether the request was for a
+// cached commit.
+func (e *accessLogEntry) setCacheHit(hit bool) {
+	if hit {
+		e.Cache = "hit"
+	} else {
+		e.Cache = "miss"
+	}
+}
+
+// accessLogWriter records the status and size of a response.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// accessLogMu serializes writes to the access log, so that lines from
+// concurrent requests aren't interleaved.
+var accessLogMu sync.Mutex
+
+// withAccessLog wraps h to write a line to the access log for every request,
+// if it is enabled.
+func (s *Service) withAccessLog(h http.Handler) http.Handler {
+	if s.AccessLogFormat == "" {
+		return h
+	}
+	out := s.accessLogOut
+	if out == nil {
+		out = os.Stderr
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		e := &accessLogEntry{
+			Time:       time.Now(),
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Proto:      r.Proto,
+		}
+		lw := &accessLogWriter{ResponseWriter: w}
+		h.ServeHTTP(lw, r.WithContext(context.WithValue(r.Context(), accessLogKey{}, e)))
+		e.Duration = time.Since(e.Time)
+		e.DurationMS = milliseconds(e.Duration)
+		e.Status = lw.status
+		if e.Status == 0 {
+			e.Status = http.StatusOK
+		}
+		e.Bytes = lw.bytes
+
+		accessLogMu.Lock()
+		defer accessLogMu.Unlock()
+		writeAccessLog(out, s.AccessLogFormat, e)
+	})
+}
+
+func writeAccessLog(out io.Writer, format string, e *accessLogEntry) {
+	switch format {
+	case AccessLogJSON:
+		_ = json.NewEncoder(out).Encode(e)
+	default:
+		cache := e.Cache
+		if cache == "" {
+			cache = "-"
+		}
+		fmt.Fprintf(out, "%s - - [%s] \"%s %s %s\" %d %d repo=%q commit=%q symbols=%d cache=%s duration=%s\n",
+			e.RemoteAddr, e.Time.Format("02/Jan/2006:15:04:05 -0700"), e.Method, e.Path, e.Proto,
+			e.Status, e.Bytes, e.Repo, e.CommitID, e.Symbols, cache, e.Duration)
+	}
+}
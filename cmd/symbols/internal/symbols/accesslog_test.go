@@ -0,0 +1,65 @@
+package symbols
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_accessLog(t *testing.T) {
+	var out bytes.Buffer
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.js": "var x = 1"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x", "y"}, nil
+		},
+		AccessLogFormat: AccessLogJSON,
+		accessLogOut:    &out,
+	}
+	server, cleanup := startTestService(t, service)
+
+	for i := 0; i < 2; i++ {
+		resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10})
+		resp.Body.Close()
+	}
+	if resp, err := http.Get(server.URL + "/healthz"); err == nil {
+		resp.Body.Close()
+	}
+	// Wait for the requests to finish being logged.
+	cleanup()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d access log lines, want 2 (health checks are not logged):\n%s", len(lines), out.String())
+	}
+	for i, wantCache := range []string{"miss", "hit"} {
+		var e accessLogEntry
+		if err := json.Unmarshal([]byte(lines[i]), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Method != "POST" || e.Path != "/search" || e.Status != 200 || e.Bytes == 0 || e.Repo != "r" || e.CommitID != "c" || e.Symbols != 2 || e.Cache != wantCache {
+			t.Errorf("unexpected access log entry %d: %s", i, lines[i])
+		}
+	}
+}
+
+func TestWriteAccessLog_common(t *testing.T) {
+	var out bytes.Buffer
+	e := &accessLogEntry{RemoteAddr: "1.2.3.4:5", Method: "POST", Path: "/search", Proto: "HTTP/1.1", Status: 200, Bytes: 10, Repo: "r", CommitID: "c", Symbols: 2, Cache: "hit"}
+	writeAccessLog(&out, AccessLogCommon, e)
+	want := `1.2.3.4:5 - - [01/Jan/0001:00:00:00 +0000] "POST /search HTTP/1.1" 200 10 repo="r" commit="c" symbols=2 cache=hit duration=0s` + "\n"
+	if out.String() != want {
+		t.Errorf("got  %q\nwant %q", out.String(), want)
+	}
+}
@@ -0,0 +1,90 @@
+package symbols
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// parseQueue tracks how many parse jobs are waiting for a parser and how long
+// parses take, so that the service can tell clients how busy it is.
+type parseQueue struct {
+	// depth is the number of parse jobs waiting for a parser.
+	depth int64
+
+	// avgParseNanos is an exponentially weighted moving average of the time
+	// a single parse job takes.
+	avgParseNanos int64
+
+	// busyNanos is the total time parsers have spent parsing.
+	busyNanos int64
+}
+
+// observe records the duration of a finished parse job.
+func (q *parseQueue) observe(d time.Duration) {
+	atomic.AddInt64(&q.busyNanos, int64(d))
+	for {
+		old := atomic.LoadInt64(&q.avgParseNanos)
+		avg := int64(d)
+		if old != 0 {
+			avg = old + (int64(d)-old)/16
+		}
+		// Retry if another job updated the average since it was loaded, so
+		// that concurrent observations aren't lost.
+		if atomic.CompareAndSwapInt64(&q.avgParseNanos, old, avg) {
+			return
+		}
+	}
+}
+
+// estimatedWait is the approximate time a newly enqueued parse job will wait
+// for one of numParsers parsers.
+func (q *parseQueue) estimatedWait(numParsers int) time.Duration {
+	if numParsers <= 0 {
+		numParsers = 1
+	}
+	depth := atomic.LoadInt64(&q.depth)
+	return time.Duration(depth * atomic.LoadInt64(&q.avgParseNanos) / int64(numParsers))
+}
+
+// rejectIfSaturated reports whether the parser pool is saturated, i.e. every
+// parser (or every parse slot, see MaxConcurrentParses) is busy and at least
+// MaxParseQueueDepth parse jobs are waiting. If so it responds with 429 Too
+// Many Requests, including the queue depth and the estimated wait so that the
+// client can decide whether to retry or back off.
+//
+// Every endpoint that may parse calls it before doing so, unless what it
+// needs is already cached. The status, kinds, cached and healthz endpoints
+// never parse, so they are served however busy the parsers are.
+func (s *Service) rejectIfSaturated(w http.ResponseWriter) bool {
+	if s.MaxParseQueueDepth <= 0 || (len(s.parsers) > 0 && (s.parseSem == nil || len(s.parseSem) < cap(s.parseSem))) {
+		return false
+	}
+	depth := atomic.LoadInt64(&s.parseQueue.depth)
+	if depth < int64(s.MaxParseQueueDepth) {
+		return false
+	}
+
+	wait := s.parseQueue.estimatedWait(s.parseConcurrency())
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.Header().Set("X-Symbols-Queue-Depth", strconv.FormatInt(depth, 10))
+	w.Header().Set("X-Symbols-Estimated-Wait", wait.Round(time.Millisecond).String())
+	http.Error(w, "symbols parser pool is saturated, retry later", http.StatusTooManyRequests)
+	saturatedRejections.Inc()
+	return true
+}
+
+var saturatedRejections = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "symbols",
+	Subsystem: "parse",
+	Name:      "saturated_rejections",
+	Help:      "The total number of requests rejected because the parser pool was saturated.",
+})
+
+func init() {
+	prometheus.MustRegister(saturatedRejections)
+}
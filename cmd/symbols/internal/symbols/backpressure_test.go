@@ -0,0 +1,113 @@
+package symbols
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestRejectIfSaturated(t *testing.T) {
+	s := &Service{
+		MaxParseQueueDepth: 2,
+		parsers:            make(chan ctags.Parser, 2),
+	}
+	s.parseQueue.observe(time.Second)
+
+	s.parseQueue.depth = 1
+	if rec := httptest.NewRecorder(); s.rejectIfSaturated(rec) {
+		t.Fatal("expected no rejection below the queue depth limit")
+	}
+
+	s.parseQueue.depth = 6
+	rec := httptest.NewRecorder()
+	if !s.rejectIfSaturated(rec) {
+		t.Fatal("expected rejection when saturated")
+	}
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got, want := rec.Header().Get("X-Symbols-Queue-Depth"), "6"; got != want {
+		t.Errorf("got queue depth %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("Retry-After"), "3"; got != want {
+		t.Errorf("got Retry-After %q, want %q", got, want)
+	}
+
+	// An idle parser means the pool isn't saturated, however long the queue.
+	s.parsers <- nil
+	if rec := httptest.NewRecorder(); s.rejectIfSaturated(rec) {
+		t.Fatal("expected no rejection with an idle parser")
+	}
+}
+
+func TestService_rejectIfSaturatedEndpoints(t *testing.T) {
+	const (
+		cachedHash   = "1111111111111111111111111111111111111111"
+		uncachedHash = "2222222222222222222222222222222222222222"
+	)
+	service := &Service{
+		ListBlobs: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, paths []string) (map[string]string, error) {
+			hashes := map[string]string{}
+			for _, p := range paths {
+				hashes[p] = map[string]string{"cached.js": cachedHash, "uncached.js": uncachedHash}[p]
+			}
+			return hashes, nil
+		},
+		FetchBlob: func(ctx context.Context, repo gitserver.Repo, hash string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("var x = 1\n")), nil
+		},
+		FetchFile: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, path string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("var x = 1\n")), nil
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x"}, nil
+		},
+		MaxParseQueueDepth: 1,
+		// Fail rather than hang should a request wait for a parser.
+		ParseQueueTimeout: time.Second,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	post := func(path string, args interface{}) int {
+		t.Helper()
+		resp := postJSON(t, server.URL+path, args)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post("/files", protocol.FilesArgs{Repo: "r", CommitID: "c", Paths: []string{"cached.js"}}); code != http.StatusOK {
+		t.Fatalf("got status %d caching a file", code)
+	}
+
+	// Take every parser and queue a parse job.
+	for len(service.parsers) > 0 {
+		<-service.parsers
+	}
+	service.parseQueue.depth = 1
+
+	for _, test := range []struct {
+		path string
+		args interface{}
+		want int
+	}{
+		{"/files", protocol.FilesArgs{Repo: "r", CommitID: "c", Paths: []string{"cached.js"}}, http.StatusOK},
+		{"/files", protocol.FilesArgs{Repo: "r", CommitID: "c", Paths: []string{"uncached.js"}}, http.StatusTooManyRequests},
+		{"/blobs", protocol.BlobsArgs{Repo: "r", Blobs: []protocol.BlobArg{{Hash: cachedHash, Path: "cached.js"}}}, http.StatusOK},
+		{"/blobs", protocol.BlobsArgs{Repo: "r", Blobs: []protocol.BlobArg{{Hash: uncachedHash, Path: "uncached.js"}}}, http.StatusTooManyRequests},
+		{"/patch", protocol.PatchArgs{Repo: "r", CommitID: "c", Patch: "--- a/a.js\n+++ b/a.js\n@@ -1 +1 @@\n-var x = 1\n+var x = 2\n"}, http.StatusTooManyRequests},
+	} {
+		if got := post(test.path, test.args); got != test.want {
+			t.Errorf("%s %+v: got status %d, want %d", test.path, test.args, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package symbols
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+)
+
+// benchmarkLanguages are the templates the benchmark corpus is generated
+// from. Each template is one unit of source code, repeated to make files of
+// different sizes; "%d" is replaced with the unit's index so that every unit
+// defines distinct symbols.
+var benchmarkLanguages = []struct {
+	ext    string
+	header string
+	unit   string
+	footer string
+}{
+	{
+		ext:    "go",
+		header: "package corpus\n\n",
+		unit:   "// Type%[1]d is a type.\ntype Type%[1]d struct {\n\tField%[1]d int\n}\n\nfunc (t *Type%[1]d) Method%[1]d(x int) int {\n\treturn t.Field%[1]d + x\n}\n\nfunc Func%[1]d() *Type%[1]d {\n\treturn &Type%[1]d{Field%[1]d: %[1]d}\n}\n\n",
+	},
+	{
+		ext:  "js",
+		unit: "function func%[1]d(a, b) {\n  return a + b + %[1]d;\n}\n\nclass Class%[1]d {\n  method%[1]d() {\n    return func%[1]d(1, 2);\n  }\n}\n\n",
+	},
+	{
+		ext:  "py",
+		unit: "def func_%[1]d(a):\n    return a + %[1]d\n\n\nclass Class%[1]d:\n    def method_%[1]d(self):\n        return func_%[1]d(self)\n\n\n",
+	},
+	{
+		ext:    "java",
+		header: "package corpus;\n\npublic class Corpus {\n",
+		unit:   "    private int field%[1]d;\n\n    public int method%[1]d(int x) {\n        return field%[1]d + x;\n    }\n\n",
+		footer: "}\n",
+	},
+	{
+		ext:  "c",
+		unit: "struct struct_%[1]d {\n\tint a;\n};\n\nint func_%[1]d(struct struct_%[1]d *s) {\n\treturn s->a + %[1]d;\n}\n\n",
+	},
+}
+
+const (
+	// benchmarkCopies is the number of files of each language and size in
+	// the benchmark corpus.
+	benchmarkCopies = 8
+
+	// maxBenchmarkRuns is the limit on the runs query parameter of the
+	// benchmark endpoint.
+	maxBenchmarkRuns = 10
+)
+
+// benchmarkUnits are the number of units in the corpus's small, medium and
+// large files.
+var benchmarkUnits = []int{5, 50, 500}
+
+// benchmarkCorpusTar returns a tar archive of the benchmark corpus. The corpus
+// is generated deterministically so that results are comparable across
+// releases.
+func benchmarkCorpusTar() ([]byte, error) {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, lang := range benchmarkLanguages {
+		for _, units := range benchmarkUnits {
+			var body strings.Builder
+			body.WriteString(lang.header)
+			for i := 0; i < units; i++ {
+				fmt.Fprintf(&body, lang.unit, i)
+			}
+			body.WriteString(lang.footer)
+
+			for c := 0; c < benchmarkCopies; c++ {
+				hdr := &tar.Header{
+					Name: fmt.Sprintf("%s/%d/file%d.%s", lang.ext, units, c, lang.ext),
+					Mode: 0600,
+					Size: int64(body.Len()),
+				}
+				if err := w.WriteHeader(hdr); err != nil {
+					return nil, err
+				}
+				if _, err := io.WriteString(w, body.String()); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// benchmarkResult is the result of a benchmark run.
+type benchmarkResult struct {
+	Runs      int
+	Parsers   int
+	BatchSize int
+
+	// The remaining fields describe the fastest run.
+	Files          int
+	Bytes          int64
+	Symbols        int
+	Errors         int
+	WallTimeMS     float64
+	FilesPerSecond float64
+	MBPerSecond    float64
+
+	// PoolUtilization is the fraction of the parser pool's capacity that was
+	// spent parsing. It includes any other parses done by the service at the
+	// same time.
+	PoolUtilization float64
+}
+
+// handleBenchmark parses a bundled corpus of source files end-to-end (through
+// the fetch, parse and database writing pipeline, but without gitserver or
+// the cache) and responds with the throughput. The runs query parameter is the
+// number of times to parse the corpus (default 3); the fastest run is
+// reported. The batch query parameter overrides ParseBatchSize, to compare
+// parsing files one at a time (batch=1) with parsing them in batches.
+func (s *Service) handleBenchmark(w http.ResponseWriter, r *http.Request) {
+	runs := 3
+	if v := r.URL.Query().Get("runs"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxBenchmarkRuns {
+			http.Error(w, fmt.Sprintf("runs must be an integer between 1 and %d", maxBenchmarkRuns), http.StatusBadRequest)
+			return
+		}
+		runs = n
+	}
+	batchSize := s.ParseBatchSize
+	if v := r.URL.Query().Get("batch"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "batch must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		batchSize = n
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	corpus, err := benchmarkCorpusTar()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var best *benchmarkResult
+	for i := 0; i < runs; i++ {
+		result, err := s.benchmark(r.Context(), corpus, batchSize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if best == nil || result.WallTimeMS < best.WallTimeMS {
+			best = result
+		}
+	}
+	best.Runs = runs
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(best); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// benchmark does a single run of the benchmark on the corpus tar archive,
+// parsing batches of up to batchSize files.
+func (s *Service) benchmark(ctx context.Context, corpus []byte, batchSize int) (*benchmarkResult, error) {
+	dbFile, err := ioutil.TempFile("", "symbols-benchmark-")
+	if err != nil {
+		return nil, err
+	}
+	dbFile.Close()
+	defer os.Remove(dbFile.Name())
+
+	result := &benchmarkResult{Parsers: cap(s.parsers), BatchSize: batchSize}
+	var mu sync.Mutex
+	opts := parseOptions{
+		batchSize: batchSize,
+		fetchTar: func(context.Context, gitserver.Repo, api.CommitID) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(corpus)), nil
+		},
+		onFile: func(fp fileParse) {
+			mu.Lock()
+			defer mu.Unlock()
+			result.Files++
+			result.Bytes += int64(fp.size)
+			result.Symbols += fp.symbols
+			if fp.err != nil {
+				result.Errors++
+			}
+		},
+	}
+
+	busy := atomic.LoadInt64(&s.parseQueue.busyNanos)
+	start := time.Now()
+	if err := s.writeAllSymbolsToNewDB(ctx, dbFile.Name(), "symbols-benchmark", "corpus", opts); err != nil {
+		return nil, err
+	}
+	wall := time.Since(start)
+	busy = atomic.LoadInt64(&s.parseQueue.busyNanos) - busy
+
+	result.WallTimeMS = milliseconds(wall)
+	if wall > 0 {
+		result.FilesPerSecond = float64(result.Files) / wall.Seconds()
+		result.MBPerSecond = float64(result.Bytes) / (1 << 20) / wall.Seconds()
+		if result.Parsers > 0 {
+			result.PoolUtilization = float64(busy) / (float64(wall) * float64(result.Parsers))
+		}
+	}
+	return result, nil
+}
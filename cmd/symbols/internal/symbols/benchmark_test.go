@@ -0,0 +1,45 @@
+package symbols
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+)
+
+func TestService_benchmark(t *testing.T) {
+	service := &Service{
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x", "y"}, nil
+		},
+	}
+	_, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	for _, test := range []struct {
+		query     string
+		batchSize int
+	}{
+		{"runs=2", 1},
+		{"runs=2&batch=16", 16},
+	} {
+		w := httptest.NewRecorder()
+		service.handleBenchmark(w, httptest.NewRequest("GET", "/benchmark?"+test.query, nil))
+		if w.Code != 200 {
+			t.Fatalf("%s: got status %d: %s", test.query, w.Code, w.Body)
+		}
+		var result benchmarkResult
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+
+		wantFiles := len(benchmarkLanguages) * len(benchmarkUnits) * benchmarkCopies
+		if result.Runs != 2 || result.BatchSize != test.batchSize || result.Files != wantFiles || result.Symbols != 2*wantFiles || result.Errors != 0 {
+			t.Errorf("%s: got runs=%d batchSize=%d files=%d symbols=%d errors=%d, want runs=2 batchSize=%d files=%d symbols=%d errors=0", test.query, result.Runs, result.BatchSize, result.Files, result.Symbols, result.Errors, test.batchSize, wantFiles, 2*wantFiles)
+		}
+		if result.Bytes == 0 || result.FilesPerSecond == 0 {
+			t.Errorf("%s: got no throughput: %+v", test.query, result)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package symbols
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// blobHashPattern matches a full Git object ID.
+var blobHashPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// maxBlobsPerRequest is the maximum number of blobs that can be requested at
+// once from the blobs endpoint.
+const maxBlobsPerRequest = 1000
+
+// handleBlobs returns the symbols of individual blobs, identified by their
+// hash, independent of any commit. The blob paths are only used to detect the
+// language.
+func (s *Service) handleBlobs(w http.ResponseWriter, r *http.Request) {
+	var args protocol.BlobsArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.FetchBlob == nil {
+		http.Error(w, "fetching blobs is not supported", http.StatusNotImplemented)
+		return
+	}
+	if len(args.Blobs) > maxBlobsPerRequest {
+		http.Error(w, fmt.Sprintf("too many blobs (maximum is %d)", maxBlobsPerRequest), http.StatusBadRequest)
+		return
+	}
+	for _, blob := range args.Blobs {
+		if !blobHashPattern.MatchString(blob.Hash) {
+			http.Error(w, fmt.Sprintf("invalid blob hash %q", blob.Hash), http.StatusBadRequest)
+			return
+		}
+	}
+
+	accessLog := accessLogFromContext(r.Context())
+	accessLog.Repo = args.Repo
+
+	if !s.checkRepoAccess(w, r, args.Repo) {
+		return
+	}
+
+	cached := true
+	for _, blob := range args.Blobs {
+		if !s.blobCached(args.Repo, blob.Hash, blob.Path) {
+			cached = false
+			break
+		}
+	}
+	if !cached && s.rejectIfSaturated(w) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	result := protocol.BlobsResult{Blobs: make([]protocol.BlobSymbols, len(args.Blobs))}
+	var (
+		wg         sync.WaitGroup
+		sem        = make(chan struct{}, s.parseConcurrency())
+		mem        = s.newRequestMemory(ctx)
+		memErrOnce sync.Once
+		memErr     error
+	)
+	for i, blob := range args.Blobs {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int, blob protocol.BlobArg) {
+			defer func() {
+				wg.Done()
+				<-sem
+			}()
+			symbols, err := s.parseBlob(ctx, args.Repo, blob.Hash, blob.Path, func(ctx context.Context) (io.ReadCloser, error) {
+				return s.FetchBlob(ctx, gitserver.Repo{Name: args.Repo}, blob.Hash)
+			})
+			if err := mem.add(symbols...); err != nil {
+				memErrOnce.Do(func() {
+					memErr = err
+					cancel() // stop parsing the remaining blobs
+				})
+				return
+			}
+			result.Blobs[i] = protocol.BlobSymbols{Hash: blob.Hash, Path: blob.Path, Symbols: symbols}
+			if err != nil {
+				log15.Error("Failed to parse blob", "repo", args.Repo, "hash", blob.Hash, "path", blob.Path, "error", err)
+				result.Blobs[i].Error = err.Error()
+			}
+		}(i, blob)
+	}
+	wg.Wait()
+
+	if err := r.Context().Err(); err != nil {
+		return // client went away
+	}
+	if memErr != nil {
+		http.Error(w, memErr.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	for _, blob := range result.Blobs {
+		accessLog.Symbols += len(blob.Symbols)
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// blobCacheKey returns the disk cache key for the symbols of the blob of repo
+// with the given hash. The repository is part of the key so that the symbols
+// of a blob are only served to callers of a repository that has it, and the
+// file name because it determines the language the blob is parsed as.
+func (s *Service) blobCacheKey(repo api.RepoName, hash, filePath string) string {
+	return fmt.Sprintf("blob-%s-%s-%s-%s", s.cacheVersion, repo, hash, path.Base(filePath))
+}
+
+// blobCached reports whether the symbols of the blob of repo with the given
+// hash and path are cached.
+func (s *Service) blobCached(repo api.RepoName, hash, filePath string) bool {
+	return s.cache.Exists(s.blobCacheKey(repo, hash, filePath))
+}
+
+// parseBlob returns the symbols in the blob of repo with the given hash,
+// parsing it as the file filePath. Since blobs are content addressed the
+// symbols are cached by repo and hash, so fetch is only called for blobs of
+// the repo that were not seen before.
+func (s *Service) parseBlob(ctx context.Context, repo api.RepoName, hash, filePath string, fetch func(context.Context) (io.ReadCloser, error)) ([]protocol.Symbol, error) {
+	symbols, err := s.readBlobSymbols(ctx, repo, hash, filePath, fetch)
+	if err != nil {
+		if _, ok := errors.Cause(err).(blobDecodeError); !ok {
+			return nil, err
+		}
+		// The cached symbols are unreadable, so parse the blob again.
+		s.removeCorruptCacheEntry(s.blobCacheKey(repo, hash, filePath), "blob", repo, "", err)
+		if symbols, err = s.readBlobSymbols(ctx, repo, hash, filePath, fetch); err != nil {
+			return nil, err
+		}
+	}
+	// The same blob may be checked in under different paths.
+	drop := kindSet(s.dropKinds(nil))
+	kept := symbols[:0]
+	for _, symbol := range symbols {
+		if !drop[symbol.Kind] {
+			symbol.Path = filePath
+			kept = append(kept, symbol)
+		}
+	}
+	return kept, nil
+}
+
+// blobDecodeError is returned when the cached symbols of a blob can't be
+// decoded.
+type blobDecodeError struct{ error }
+
+// readBlobSymbols returns the cached symbols of the blob of repo with the given
+// hash, parsing it first if it isn't cached.
+func (s *Service) readBlobSymbols(ctx context.Context, repo api.RepoName, hash, filePath string, fetch func(context.Context) (io.ReadCloser, error)) ([]protocol.Symbol, error) {
+	f, err := s.cache.Open(ctx, s.blobCacheKey(repo, hash, filePath), func(ctx context.Context) (io.ReadCloser, error) {
+		rc, err := fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		data, err := ioutil.ReadAll(io.LimitReader(rc, maxFileSize+1))
+		if err != nil {
+			return nil, err
+		}
+
+		var symbols []protocol.Symbol
+		if len(data) <= maxFileSize && !isBinary(data) {
+			entries, err := s.parse(ctx, parseRequest{path: filePath, data: data})
+			if err != nil {
+				return nil, errors.Wrap(err, "parse")
+			}
+			for _, e := range entries {
+				if !shouldSkipEntry(e) {
+					symbols = append(symbols, entryToSymbol(e))
+				}
+			}
+		}
+
+		b, err := json.Marshal(symbols)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var symbols []protocol.Symbol
+	if err := json.NewDecoder(f).Decode(&symbols); err != nil {
+		return nil, errors.Wrap(blobDecodeError{err}, "decoding cached blob symbols")
+	}
+	return symbols, nil
+}
+
+// isBinary is a heuristic for whether data is the contents of a binary file:
+// it is considered binary if the first 32KB contain a 0x00.
+func isBinary(data []byte) bool {
+	if len(data) > 32*1024 {
+		data = data[:32*1024]
+	}
+	return bytes.IndexByte(data, 0x00) >= 0
+}
@@ -0,0 +1,149 @@
+package symbols
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// errMemoryBudgetExceeded is returned when the symbols accumulated by a
+// request would take the projected memory of the service over
+// MemoryBudgetBytes.
+var errMemoryBudgetExceeded = errors.New("the symbols service is over its memory budget")
+
+// isMemoryExceeded reports whether err is because a request used too much
+// memory, of its own or of the service's budget.
+func isMemoryExceeded(err error) bool {
+	cause := errors.Cause(err)
+	return cause == errRequestMemoryExceeded || cause == errMemoryBudgetExceeded
+}
+
+// memoryBudget accounts for the memory the service is projected to use
+// against Service.MemoryBudgetBytes: the memory its parser processes may use
+// at most, the bytes of the archives being fetched that wait to be parsed,
+// and the symbols requests accumulate. The service's own heap otherwise is
+// not counted, so the budget should leave room for it.
+type memoryBudget struct {
+	limit    int64 // zero means no budget
+	reserved int64 // for the parser processes
+
+	fetched int64 // accessed atomically
+	symbols int64 // accessed atomically
+}
+
+// set sets the budget to limit bytes, of which reserved are taken by the
+// parser processes.
+func (b *memoryBudget) set(limit, reserved int64) {
+	b.limit, b.reserved = limit, reserved
+	memoryBudgetBytes.Set(float64(limit))
+	b.update()
+}
+
+// projected returns the memory the service is projected to use.
+func (b *memoryBudget) projected() int64 {
+	return b.reserved + atomic.LoadInt64(&b.fetched) + atomic.LoadInt64(&b.symbols)
+}
+
+// over reports whether the projected memory is at least the budget.
+func (b *memoryBudget) over() bool {
+	return b.limit > 0 && b.projected() >= b.limit
+}
+
+// addFetched accounts for n bytes fetched from archives (or released, if n
+// is negative).
+func (b *memoryBudget) addFetched(n int64) {
+	atomic.AddInt64(&b.fetched, n)
+	b.update()
+}
+
+// addSymbols accounts for n bytes of symbols held by requests (or released,
+// if n is negative). It reports whether the projected memory is within the
+// budget.
+func (b *memoryBudget) addSymbols(n int64) bool {
+	atomic.AddInt64(&b.symbols, n)
+	b.update()
+	return !b.over() || n <= 0
+}
+
+func (b *memoryBudget) update() {
+	memoryProjectedBytes.Set(float64(b.projected()))
+}
+
+// budgetCharge is the memory of symbols charged to the budget by a request,
+// which is released once the response has been written.
+type budgetCharge struct {
+	bytes int64 // accessed atomically
+}
+
+type budgetChargeKey struct{}
+
+// memoryBudgetExempt are the paths of the requests that take little memory,
+// which are served even when the service is over its memory budget.
+var memoryBudgetExempt = map[string]bool{
+	"/status":  true,
+	"/push":    true,
+	"/kinds":   true,
+	"/cached":  true,
+	"/healthz": true,
+}
+
+// withMemoryBudget sheds requests with 503 Service Unavailable while the
+// projected memory of the service is at least MemoryBudgetBytes, and charges
+// the symbols of the requests it serves to the budget.
+func (s *Service) withMemoryBudget(next http.Handler) http.Handler {
+	if s.MemoryBudgetBytes <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if memoryBudgetExempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.memory.over() {
+			memoryBudgetRejections.Inc()
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, errMemoryBudgetExceeded.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		charge := &budgetCharge{}
+		defer func() { s.memory.addSymbols(-atomic.LoadInt64(&charge.bytes)) }()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), budgetChargeKey{}, charge)))
+	})
+}
+
+var (
+	memoryBudgetBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "symbols",
+		Subsystem: "memory",
+		Name:      "budget_bytes",
+		Help:      "The memory budget of the service (0 if it has none).",
+	})
+	memoryProjectedBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "symbols",
+		Subsystem: "memory",
+		Name:      "projected_bytes",
+		Help:      "The memory the service is projected to use: the limit of the parser processes, fetched archive bytes waiting to be parsed and the symbols held by requests.",
+	})
+	memoryBudgetRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "memory",
+		Name:      "budget_rejections",
+		Help:      "The total number of requests rejected or aborted because the service was over its memory budget.",
+	})
+	parserMemoryLimitExceeded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "memory",
+		Name:      "parser_limit_exceeded",
+		Help:      "The total number of parser processes replaced because they exceeded their memory limit.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(memoryBudgetBytes)
+	prometheus.MustRegister(memoryProjectedBytes)
+	prometheus.MustRegister(memoryBudgetRejections)
+	prometheus.MustRegister(parserMemoryLimitExceeded)
+}
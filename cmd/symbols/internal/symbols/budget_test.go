@@ -0,0 +1,59 @@
+package symbols
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestWithMemoryBudget(t *testing.T) {
+	s := &Service{MemoryBudgetBytes: 1000}
+	s.memory.set(1000, 400)
+
+	sym := protocol.Symbol{Name: "x"}
+	var addErr error
+	handler := s.withMemoryBudget(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mem := s.newRequestMemory(r.Context())
+		for i := 0; i < 100 && addErr == nil; i++ {
+			addErr = mem.add(sym)
+		}
+	}))
+
+	// The symbols of a request count against the budget until it is served.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/search", nil))
+	if !isMemoryExceeded(addErr) {
+		t.Fatalf("got error %v, want the memory budget to be exceeded", addErr)
+	}
+	if got, want := s.memory.projected(), int64(400); got != want {
+		t.Errorf("got projected memory %d after the request, want %d", got, want)
+	}
+
+	// Requests are shed while fetched archives take the service over budget.
+	s.memory.addFetched(600)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/search", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got, want := rec.Header().Get("Retry-After"), "1"; got != want {
+		t.Errorf("got Retry-After %q, want %q", got, want)
+	}
+
+	// Cheap requests are still served.
+	addErr = nil
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d for a health check, want %d", rec.Code, http.StatusOK)
+	}
+
+	s.memory.addFetched(-600)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/search", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d once under budget, want %d", rec.Code, http.StatusOK)
+	}
+}
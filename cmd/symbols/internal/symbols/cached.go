@@ -0,0 +1,81 @@
+package symbols
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+// handleCached lists the commits of the repository given by the repo query
+// parameter whose symbols are cached, with a protocol.CachedCommitsResult.
+// Commits cached before keys were recorded in the cache are not listed.
+func (s *Service) handleCached(w http.ResponseWriter, r *http.Request) {
+	repo := api.RepoName(r.URL.Query().Get("repo"))
+	if repo == "" {
+		http.Error(w, "repo query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	accessLog := accessLogFromContext(r.Context())
+	accessLog.Repo = repo
+
+	if !s.checkRepoAccess(w, r, repo) {
+		return
+	}
+
+	items, err := s.cache.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := protocol.CachedCommitsResult{Commits: []protocol.CachedCommit{}}
+	for _, item := range items {
+		commitID, variant, ok := s.parseCacheKey(item.Key, repo)
+		if !ok {
+			continue
+		}
+		result.Commits = append(result.Commits, protocol.CachedCommit{
+			CommitID:   commitID,
+			Variant:    variant,
+			Size:       item.Size,
+			LastAccess: item.ModTime.UTC(),
+		})
+	}
+	sort.Slice(result.Commits, func(i, j int) bool {
+		return result.Commits[i].LastAccess.After(result.Commits[j].LastAccess)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseCacheKey returns the commit and the variant (the suffix of the key
+// after cacheKey's, such as "drop-local") of a symbols database key of repo
+// as returned by searchCacheKey. It returns false for other keys, including
+// those of other repositories and of other database versions or parse
+// configurations.
+func (s *Service) parseCacheKey(key string, repo api.RepoName) (commitID api.CommitID, variant string, ok bool) {
+	prefix := fmt.Sprintf("%s-%s@", s.cacheVersion, repo)
+	if !strings.HasPrefix(key, prefix) {
+		return "", "", false
+	}
+	rest := key[len(prefix):]
+	commit := rest
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		commit, variant = rest[:i], rest[i+1:]
+	}
+	// Tell "r@c" apart from the keys of a repository named like "r@x/y".
+	if commit == "" || strings.ContainsAny(commit, "@/") {
+		return "", "", false
+	}
+	return api.CommitID(commit), variant, true
+}
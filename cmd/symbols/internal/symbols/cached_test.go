@@ -0,0 +1,63 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags/ctagstest"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_cached(t *testing.T) {
+	parser := &ctagstest.Parser{Default: []ctags.Entry{{Name: "x"}}}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.go": "x"})
+		},
+		NewParser: parser.New,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	for _, args := range []protocol.SearchArgs{
+		{Repo: "r", CommitID: "c1"},
+		{Repo: "r", CommitID: "c2"},
+		{Repo: "r", CommitID: "c2", MaxDepth: 1},
+		{Repo: "r@x/y", CommitID: "c3"},
+	} {
+		resp := postJSON(t, server.URL+"/search", args)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d", resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/cached?repo=r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result protocol.CachedCommitsResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range result.Commits {
+		if c.Size == 0 || c.LastAccess.IsZero() {
+			t.Errorf("got commit %+v, want a size and last access time", c)
+		}
+		got = append(got, string(c.CommitID)+" "+c.Variant)
+	}
+	sort.Strings(got)
+	if want := []string{"c1 ", "c2 ", "c2 depth-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got cached commits %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package symbols
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// commitRequests counts the requests being served for each commit, to
+// enforce MaxRequestsPerCommit.
+type commitRequests struct {
+	mu sync.Mutex
+	n  map[string]int // repo@commit -> requests being served
+}
+
+// acquireCommitRequest counts a request for the symbols of a commit, unless
+// MaxRequestsPerCommit requests for it are already being served. Then it
+// responds with 429 Too Many Requests and returns false. Otherwise release
+// must be called once the request is done.
+//
+// Parses of a commit are deduplicated by the cache, but each request still
+// holds a connection and streams its own response; this bounds how many of
+// them a client can open for a single popular commit.
+func (s *Service) acquireCommitRequest(w http.ResponseWriter, repo api.RepoName, commitID api.CommitID) (release func(), ok bool) {
+	if s.MaxRequestsPerCommit <= 0 {
+		return func() {}, true
+	}
+
+	key := string(repo) + "@" + string(commitID)
+	c := &s.commitRequests
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.n[key] >= s.MaxRequestsPerCommit {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "too many concurrent requests for this commit, retry later", http.StatusTooManyRequests)
+		commitRequestRejections.Inc()
+		return nil, false
+	}
+	if c.n == nil {
+		c.n = map[string]int{}
+	}
+	c.n[key]++
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.n[key]--; c.n[key] == 0 {
+			delete(c.n, key)
+		}
+	}, true
+}
+
+var commitRequestRejections = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "symbols",
+	Subsystem: "request",
+	Name:      "commit_limit_rejections",
+	Help:      "The total number of requests rejected because MaxRequestsPerCommit requests for the same commit were already being served.",
+})
+
+func init() {
+	prometheus.MustRegister(commitRequestRejections)
+}
@@ -0,0 +1,43 @@
+package symbols
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcquireCommitRequest(t *testing.T) {
+	s := &Service{MaxRequestsPerCommit: 2}
+
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, ok := s.acquireCommitRequest(httptest.NewRecorder(), "r", "c")
+		if !ok {
+			t.Fatalf("request %d rejected, want it served below the limit", i)
+		}
+		releases = append(releases, release)
+	}
+
+	rec := httptest.NewRecorder()
+	if _, ok := s.acquireCommitRequest(rec, "r", "c"); ok {
+		t.Fatal("expected rejection at the limit")
+	}
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	// The limit is per commit.
+	if _, ok := s.acquireCommitRequest(httptest.NewRecorder(), "r", "d"); !ok {
+		t.Error("request for another commit rejected")
+	}
+
+	releases[0]()
+	if _, ok := s.acquireCommitRequest(httptest.NewRecorder(), "r", "c"); !ok {
+		t.Error("request rejected after another one was done")
+	}
+
+	releases[1]()
+	if n := s.commitRequests.n["r@c"]; n != 1 {
+		t.Errorf("got %d requests for r@c, want 1", n)
+	}
+}
@@ -0,0 +1,66 @@
+package symbols
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"golang.org/x/time/rate"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// corruptionLogLimit limits how often cache corruption is logged, so that a
+// bad disk doesn't flood the logs. Every occurrence is still counted.
+var corruptionLogLimit = rate.NewLimiter(rate.Every(time.Minute), 5)
+
+// checkDB returns an error if db is not a readable symbols database, e.g.
+// because the file was truncated or written by an incompatible schema.
+func checkDB(ctx context.Context, db *sqlx.DB) error {
+	for _, q := range []string{`SELECT 1 FROM symbols LIMIT 1`, `SELECT 1 FROM files LIMIT 1`} {
+		rows, err := db.QueryContext(ctx, q)
+		if err != nil {
+			return err
+		}
+		rows.Close()
+	}
+	return nil
+}
+
+// isCorruptDBError reports whether err means a symbols database is unusable,
+// as opposed to e.g. the request being canceled.
+func isCorruptDBError(err error) bool {
+	if e, ok := errors.Cause(err).(sqlite3.Error); ok && (e.Code == sqlite3.ErrCorrupt || e.Code == sqlite3.ErrNotADB) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "no such table") || strings.Contains(msg, "no such column")
+}
+
+// removeCorruptCacheEntry records that the cache entry key of repo@commitID
+// could not be read and removes it, so that the caller can fall back to
+// parsing again.
+func (s *Service) removeCorruptCacheEntry(key, kind string, repo api.RepoName, commitID api.CommitID, cause error) {
+	cacheCorruptEntries.WithLabelValues(kind).Inc()
+	if corruptionLogLimit.Allow() {
+		log15.Warn("Removing corrupt symbols cache entry", "repo", repo, "commit", commitID, "key", key, "error", cause)
+	}
+	if err := s.cache.Remove(key); err != nil {
+		log15.Error("Failed to remove corrupt symbols cache entry", "key", key, "error", err)
+	}
+}
+
+var cacheCorruptEntries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "symbols",
+	Subsystem: "cache",
+	Name:      "corrupt_entries",
+	Help:      "The total number of cache entries that could not be read and were parsed again, by kind (db or blob).",
+}, []string{"kind"})
+
+func init() {
+	prometheus.MustRegister(cacheCorruptEntries)
+}
@@ -0,0 +1,106 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_corruptCache(t *testing.T) {
+	var tarFetches, blobFetches int
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			tarFetches++
+			return createTar(map[string]string{"a.js": "var x = 1"})
+		},
+		FetchBlob: func(ctx context.Context, repo gitserver.Repo, hash string) (io.ReadCloser, error) {
+			blobFetches++
+			return ioutil.NopCloser(strings.NewReader("var x = 1")), nil
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x"}, nil
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	// corrupt overwrites the cache entry key with garbage.
+	corrupt := func(key string) {
+		f, err := service.cache.Open(context.Background(), key, func(context.Context) (io.ReadCloser, error) {
+			t.Fatalf("cache entry %s does not exist", key)
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if err := ioutil.WriteFile(f.Path, []byte("not a cache entry"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func() []protocol.Symbol {
+		resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10})
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("search: got status %d", resp.StatusCode)
+		}
+		var result protocol.SearchResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result.Symbols
+	}
+	if got := search(); len(got) != 1 {
+		t.Fatalf("got %d symbols, want 1", len(got))
+	}
+
+	before := testutil.ToFloat64(cacheCorruptEntries.WithLabelValues("db"))
+	corrupt(service.cacheKey("r", "c", nil))
+	if got := search(); len(got) != 1 {
+		t.Errorf("got %d symbols after corrupting the cache, want 1", len(got))
+	}
+	if n := testutil.ToFloat64(cacheCorruptEntries.WithLabelValues("db")) - before; n != 1 {
+		t.Errorf("got %v corrupt db entries, want 1", n)
+	}
+	if tarFetches != 2 {
+		t.Errorf("got %d tar fetches, want 2", tarFetches)
+	}
+
+	hash := strings.Repeat("a", 40)
+	blobs := func() []protocol.BlobSymbols {
+		resp := postJSON(t, server.URL+"/blobs", protocol.BlobsArgs{Repo: "r", Blobs: []protocol.BlobArg{{Hash: hash, Path: "a.js"}}})
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("blobs: got status %d", resp.StatusCode)
+		}
+		var result protocol.BlobsResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result.Blobs
+	}
+	blobs()
+
+	before = testutil.ToFloat64(cacheCorruptEntries.WithLabelValues("blob"))
+	corrupt(service.blobCacheKey("r", hash, "a.js"))
+	if got := blobs(); len(got) != 1 || len(got[0].Symbols) != 1 {
+		t.Errorf("got %+v after corrupting the cache, want 1 blob with 1 symbol", got)
+	}
+	if n := testutil.ToFloat64(cacheCorruptEntries.WithLabelValues("blob")) - before; n != 1 {
+		t.Errorf("got %v corrupt blob entries, want 1", n)
+	}
+	if blobFetches != 2 {
+		t.Errorf("got %d blob fetches, want 2", blobFetches)
+	}
+}
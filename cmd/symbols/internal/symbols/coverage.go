@@ -0,0 +1,167 @@
+package symbols
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	"github.com/src-d/enry/v2"
+)
+
+// skipOverLimit is the reason for not parsing a file that is over
+// Service.MaxFilesPerCommit in a parse coverage report.
+const skipOverLimit = "over file limit"
+
+// parseCoverage is how many of the files of a commit produced symbols, per
+// language. A language with low coverage points to a misconfiguration or a
+// dialect ctags doesn't understand.
+type parseCoverage struct {
+	Repo     api.RepoName
+	CommitID api.CommitID
+
+	Files   int
+	Parsed  int
+	Symbols int
+
+	// Skipped is the number of files not parsed for each reason (such as
+	// "binary").
+	Skipped map[string]int
+
+	// Languages are sorted by their number of files, most first.
+	Languages []*parseCoverageLanguage
+}
+
+// parseCoverageLanguage is the parse coverage of the files of a language.
+type parseCoverageLanguage struct {
+	Name    string
+	Files   int // all files, including skipped ones
+	Parsed  int // files with at least one symbol
+	Symbols int
+	Skipped int // files not parsed, as in parseCoverage.Skipped
+	Errors  int // files that failed to parse
+
+	// Coverage is the percentage of the files that were not skipped that
+	// have symbols.
+	Coverage float64
+}
+
+// handleParseCoverage parses the commit given by the repo and commit query
+// parameters (bypassing the cache) and responds with its parse coverage.
+func (s *Service) handleParseCoverage(w http.ResponseWriter, r *http.Request) {
+	repo, commitID := api.RepoName(r.URL.Query().Get("repo")), api.CommitID(r.URL.Query().Get("commit"))
+	if repo == "" || commitID == "" {
+		http.Error(w, "repo and commit query parameters are required", http.StatusBadRequest)
+		return
+	}
+	if !s.checkRepoAccess(w, r, repo) {
+		return
+	}
+
+	var (
+		mu      sync.Mutex
+		files   []fileParse
+		skipped = map[string]string{} // path -> reason
+	)
+	skip := func(path, reason string) {
+		mu.Lock()
+		skipped[path] = reason
+		mu.Unlock()
+	}
+	err := s.parseUncached(r.Context(), repo, commitID, parseOptions{
+		onFile: func(fp fileParse) {
+			mu.Lock()
+			files = append(files, fp)
+			mu.Unlock()
+		},
+		onSkip:      skip,
+		maxFiles:    s.MaxFilesPerCommit,
+		onOverLimit: func(path string) { skip(path, skipOverLimit) },
+	}, func(protocol.Symbol) error { return nil })
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	coverage := newParseCoverage(files, skipped)
+	coverage.Repo = repo
+	coverage.CommitID = commitID
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(coverage); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// newParseCoverage returns the coverage of the parsed files and the skipped
+// files (by path, with the reason). Files are grouped by the language go-enry
+// detects from their name rather than the language of their symbols, so that
+// files without symbols are counted under their language too.
+func newParseCoverage(files []fileParse, skipped map[string]string) *parseCoverage {
+	coverage := &parseCoverage{
+		Files:   len(files) + len(skipped),
+		Skipped: map[string]int{},
+	}
+
+	languages := map[string]*parseCoverageLanguage{}
+	language := func(filePath string) *parseCoverageLanguage {
+		name := fileLanguage(filePath)
+		if languages[name] == nil {
+			languages[name] = &parseCoverageLanguage{Name: name}
+		}
+		return languages[name]
+	}
+	for _, f := range files {
+		l := language(f.path)
+		l.Files++
+		l.Symbols += f.symbols
+		coverage.Symbols += f.symbols
+		if f.symbols > 0 {
+			l.Parsed++
+			coverage.Parsed++
+		}
+		if f.err != nil {
+			l.Errors++
+		}
+	}
+	for filePath, reason := range skipped {
+		l := language(filePath)
+		l.Files++
+		l.Skipped++
+		coverage.Skipped[reason]++
+	}
+
+	for _, l := range languages {
+		if n := l.Files - l.Skipped; n > 0 {
+			l.Coverage = 100 * float64(l.Parsed) / float64(n)
+		}
+		coverage.Languages = append(coverage.Languages, l)
+	}
+	sort.Slice(coverage.Languages, func(i, j int) bool {
+		a, b := coverage.Languages[i], coverage.Languages[j]
+		if a.Files != b.Files {
+			return a.Files > b.Files
+		}
+		return a.Name < b.Name
+	})
+	return coverage
+}
+
+// fileLanguage returns the language of a file detected from its name, or
+// "unknown (.ext)".
+func fileLanguage(filePath string) string {
+	name := path.Base(filePath)
+	if language, _ := enry.GetLanguageByFilename(name); language != "" {
+		return language
+	}
+	if language, _ := enry.GetLanguageByExtension(name); language != "" {
+		return language
+	}
+	return "unknown (" + path.Ext(filePath) + ")"
+}
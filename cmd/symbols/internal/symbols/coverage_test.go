@@ -0,0 +1,40 @@
+package symbols
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNewParseCoverage(t *testing.T) {
+	coverage := newParseCoverage([]fileParse{
+		{path: "a.go", symbols: 2},
+		{path: "b.go", symbols: 3},
+		{path: "c.go"},
+		{path: "d.py", err: errors.New("crashed")},
+	}, map[string]string{
+		"e.go":     skipTooLarge,
+		"f.py":     skipBinary,
+		"data.bin": skipBinary,
+	})
+
+	if coverage.Files != 7 || coverage.Parsed != 2 || coverage.Symbols != 5 {
+		t.Errorf("got totals files=%d parsed=%d symbols=%d", coverage.Files, coverage.Parsed, coverage.Symbols)
+	}
+	if want := map[string]int{skipTooLarge: 1, skipBinary: 2}; !reflect.DeepEqual(coverage.Skipped, want) {
+		t.Errorf("got skipped %v, want %v", coverage.Skipped, want)
+	}
+
+	want := []parseCoverageLanguage{
+		{Name: "Go", Files: 4, Parsed: 2, Symbols: 5, Skipped: 1, Coverage: 100 * 2.0 / 3},
+		{Name: "Python", Files: 2, Skipped: 1, Errors: 1},
+		{Name: "unknown (.bin)", Files: 1, Skipped: 1},
+	}
+	var got []parseCoverageLanguage
+	for _, l := range coverage.Languages {
+		got = append(got, *l)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got languages %+v, want %+v", got, want)
+	}
+}
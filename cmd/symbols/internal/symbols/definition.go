@@ -0,0 +1,113 @@
+package symbols
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	"github.com/src-d/enry/v2"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// handleDefinition returns the symbols of a commit with exactly the given
+// name (and kind, if given), such as the candidates for jumping to the
+// definition of an identifier. It responds with a protocol.SearchResult whose
+// symbols are ranked as by rankDefinitions.
+func (s *Service) handleDefinition(w http.ResponseWriter, r *http.Request) {
+	var args protocol.DefinitionArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if args.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	accessLog := accessLogFromContext(r.Context())
+	accessLog.Repo, accessLog.CommitID = args.Repo, args.CommitID
+
+	if !s.checkRepoAccess(w, r, args.Repo) {
+		return
+	}
+	release, ok := s.acquireCommitRequest(w, args.Repo, args.CommitID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	searchArgs := protocol.SearchArgs{Repo: args.Repo, CommitID: args.CommitID, IncludeKinds: args.IncludeKinds}
+	cached := s.cache.Exists(s.searchCacheKey(searchArgs))
+	accessLog.setCacheHit(cached)
+	if !cached && s.rejectIfSaturated(w) {
+		return
+	}
+
+	db, err := s.openDB(r.Context(), searchArgs)
+	if err != nil {
+		writeSearchError(w, r, searchArgs, err)
+		return
+	}
+	defer db.Close()
+
+	// The name index makes this a lookup rather than a scan.
+	query, queryArgs := `SELECT * FROM symbols WHERE name = ?`, []interface{}{args.Name}
+	if args.Kind != "" {
+		query += ` AND kind = ?`
+		queryArgs = append(queryArgs, args.Kind)
+	}
+	var rows []symbolInDB
+	if err := db.SelectContext(r.Context(), &rows, query, queryArgs...); err != nil {
+		writeSearchError(w, r, searchArgs, err)
+		return
+	}
+
+	var result protocol.SearchResult
+	for _, row := range rows {
+		symbol := symbolInDBToSymbol(row)
+		if !args.IncludeSource {
+			symbol.Source = ""
+		}
+		result.Symbols = append(result.Symbols, symbol)
+	}
+	s.rankDefinitions(result.Symbols)
+	accessLog.Symbols = len(result.Symbols)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log15.Error("Failed to write symbol definition response", "error", err)
+	}
+}
+
+// rankDefinitions sorts candidate definitions of a name from most to least
+// likely to be the one meant: top level symbols before members of other
+// symbols, symbols in the repository's own code before those in vendored or
+// generated files, and then symbols in shallower files first. Ties are broken
+// by path and line so that the order is stable.
+func (s *Service) rankDefinitions(symbols []protocol.Symbol) {
+	penalty := func(symbol protocol.Symbol) int {
+		p := 0
+		if symbol.Parent != "" {
+			p++
+		}
+		if enry.IsVendor(symbol.Path) || s.isGeneratedPath(symbol.Path) {
+			p += 2
+		}
+		return p
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		a, b := symbols[i], symbols[j]
+		if pa, pb := penalty(a), penalty(b); pa != pb {
+			return pa < pb
+		}
+		if da, db := strings.Count(a.Path, "/"), strings.Count(b.Path, "/"); da != db {
+			return da < db
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+}
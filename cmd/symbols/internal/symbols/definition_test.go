@@ -0,0 +1,80 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags/ctagstest"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_definition(t *testing.T) {
+	parser := &ctagstest.Parser{
+		Entries: map[string][]ctags.Entry{
+			"a/b/deep.go":     {{Name: "Foo", Kind: "func", Line: 3}},
+			"a/shallow.go":    {{Name: "Foo", Kind: "func", Line: 7}, {Name: "foo", Kind: "func", Line: 9}},
+			"member.go":       {{Name: "Foo", Kind: "member", Parent: "T", ParentKind: "struct", Line: 2}},
+			"vendor/x/x.go":   {{Name: "Foo", Kind: "func", Line: 1}},
+			"z.go":            {{Name: "Foo", Kind: "type", Line: 5}},
+			"other.go":        {{Name: "Bar", Kind: "func", Line: 1}},
+			"generated.pb.go": {{Name: "Foo", Kind: "func", Line: 1}},
+		},
+	}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			files := map[string]string{}
+			for name := range parser.Entries {
+				files[name] = "x"
+			}
+			return createTar(files)
+		},
+		NewParser: parser.New,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	get := func(args protocol.DefinitionArgs) (int, []string) {
+		args.Repo, args.CommitID = "r", "c"
+		resp := postJSON(t, server.URL+"/definition", args)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, nil
+		}
+		var result protocol.SearchResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		var locations []string
+		for _, s := range result.Symbols {
+			locations = append(locations, s.Path+":"+s.Kind)
+		}
+		return resp.StatusCode, locations
+	}
+
+	for _, test := range []struct {
+		args   protocol.DefinitionArgs
+		status int
+		want   []string
+	}{
+		{
+			args:   protocol.DefinitionArgs{Name: "Foo"},
+			status: http.StatusOK,
+			want:   []string{"z.go:type", "a/shallow.go:func", "a/b/deep.go:func", "member.go:member", "generated.pb.go:func", "vendor/x/x.go:func"},
+		},
+		{args: protocol.DefinitionArgs{Name: "Foo", Kind: "type"}, status: http.StatusOK, want: []string{"z.go:type"}},
+		{args: protocol.DefinitionArgs{Name: "Missing"}, status: http.StatusOK},
+		{args: protocol.DefinitionArgs{}, status: http.StatusBadRequest},
+	} {
+		status, got := get(test.args)
+		if status != test.status || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got status %d and definitions %v, want %d and %v", test.args, status, got, test.status, test.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package symbols
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+// maxEnclosingDepth is the maximum number of enclosing symbols looked up for a
+// symbol, in case the scopes of the symbols of a file form a cycle.
+const maxEnclosingDepth = 16
+
+// enclosingSymbols returns the Enclosing symbols of symbol, a symbol of db.
+// The symbol a scope refers to is the nearest preceding symbol of the same
+// file named like the scope (and of the scope's kind, if ctags reported it),
+// as in protocol.DocumentSymbols. If there is none the scope is returned by
+// name only, and the qualifiers of a qualified scope (such as "Outer" of
+// "Outer.Inner") are looked up in its place.
+func enclosingSymbols(ctx context.Context, db *sqlx.DB, symbol protocol.Symbol) ([]protocol.EnclosingSymbol, error) {
+	var enclosing []protocol.EnclosingSymbol
+	prepend := func(e protocol.EnclosingSymbol) {
+		enclosing = append([]protocol.EnclosingSymbol{e}, enclosing...)
+	}
+
+	current := symbol
+	for i := 0; i < maxEnclosingDepth && current.Parent != ""; i++ {
+		qualifier, name := splitScope(current.Parent)
+		var row symbolInDB
+		err := db.GetContext(ctx, &row, `
+			SELECT * FROM symbols
+			WHERE path = ? AND (name = ? OR name = ?) AND (? = '' OR kind = ?)
+				AND (line < ? OR (line = ? AND NOT (name = ? AND kind = ?)))
+			ORDER BY line DESC LIMIT 1`,
+			current.Path, current.Parent, name, current.ParentKind, current.ParentKind,
+			current.Line, current.Line, current.Name, current.Kind)
+		if err == sql.ErrNoRows {
+			prepend(protocol.EnclosingSymbol{Name: name, Kind: current.ParentKind})
+			// Look up the qualifier as the scope of the unresolved symbol.
+			current = protocol.Symbol{Name: name, Path: current.Path, Line: current.Line, Parent: qualifier}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		prepend(protocol.EnclosingSymbol{Name: row.Name, Kind: row.Kind, Line: row.Line})
+		current = symbolInDBToSymbol(row)
+	}
+	return enclosing, nil
+}
+
+// splitScope splits a possibly qualified scope (such as "Outer.Inner" or
+// "ns::Class") into its qualifier and its last name. The qualifier is empty if
+// the scope isn't qualified.
+func splitScope(scope string) (qualifier, name string) {
+	i := strings.LastIndexAny(scope, ".:")
+	if i < 0 {
+		return "", scope
+	}
+	return strings.TrimRight(scope[:i], ".:"), scope[i+1:]
+}
@@ -0,0 +1,88 @@
+package symbols
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// handleExport responds with the complete symbols database of a commit, for
+// archival and offline processing. The response is a gzip compressed SQLite 3
+// database, streamed from the cache rather than buffered. Its symbols table
+// has a row per symbol, with the fields of protocol.Symbol as lower case
+// columns (such as parentkind) plus namelowercase and pathlowercase; its files
+// table has the path of every parsed file, including files without symbols.
+//
+// The schema version is sent in the X-Symbols-DB-Version header; the schema
+// only changes when the version does. The X-Symbols-Cache-Version header has
+// the version of the parse configuration, which a cache snapshot (see
+// Service.CacheSnapshot) records.
+func (s *Service) handleExport(w http.ResponseWriter, r *http.Request) {
+	var args protocol.ExportArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accessLog := accessLogFromContext(r.Context())
+	accessLog.Repo, accessLog.CommitID = args.Repo, args.CommitID
+
+	if !s.checkRepoAccess(w, r, args.Repo) {
+		return
+	}
+	release, ok := s.acquireCommitRequest(w, args.Repo, args.CommitID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	searchArgs := protocol.SearchArgs{Repo: args.Repo, CommitID: args.CommitID, IncludeKinds: args.IncludeKinds}
+	cached := s.cache.Exists(s.searchCacheKey(searchArgs))
+	accessLog.setCacheHit(cached)
+	if !cached && s.rejectIfSaturated(w) {
+		return
+	}
+
+	// Opening the database first replaces a corrupt cache entry.
+	db, err := s.openDB(r.Context(), searchArgs)
+	if err != nil {
+		writeSearchError(w, r, searchArgs, err)
+		return
+	}
+	db.Close()
+
+	// The open file stays readable even if the cache entry is evicted while
+	// it is being sent.
+	f, err := s.openDBFile(r.Context(), searchArgs)
+	if err != nil {
+		writeSearchError(w, r, searchArgs, err)
+		return
+	}
+	defer f.File.Close()
+
+	filename := fmt.Sprintf("%s@%s.sqlite3.gz", path.Base(string(args.Repo)), args.CommitID)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("X-Symbols-DB-Version", strconv.Itoa(symbolsDBVersion))
+	w.Header().Set("X-Symbols-Cache-Version", s.cacheVersion)
+
+	zw := gzip.NewWriter(w)
+	if _, err := io.Copy(zw, f.File); err != nil {
+		// The status line has already been sent, so all we can do is log and
+		// leave the response truncated, which fails decompression.
+		if r.Context().Err() == nil {
+			log15.Error("Failed to write symbols database export", "repo", args.Repo, "commit", args.CommitID, "error", err)
+		}
+		return
+	}
+	if err := zw.Close(); err != nil {
+		log15.Error("Failed to write symbols database export", "repo", args.Repo, "commit", args.CommitID, "error", err)
+	}
+}
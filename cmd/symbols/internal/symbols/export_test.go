@@ -0,0 +1,78 @@
+package symbols
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_export(t *testing.T) {
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.js": "var x = 1", "b.js": "// empty"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return parserFunc(func(name string, content []byte) ([]ctags.Entry, error) {
+				if name == "b.js" {
+					return nil, nil
+				}
+				return []ctags.Entry{{Name: "x", Path: name}, {Name: "y", Path: name}}, nil
+			}), nil
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	resp := postJSON(t, server.URL+"/export", protocol.ExportArgs{Repo: "github.com/a/r", CommitID: "c"})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+	if got, want := resp.Header.Get("Content-Disposition"), `attachment; filename="r@c.sqlite3.gz"`; got != want {
+		t.Errorf("got Content-Disposition %q, want %q", got, want)
+	}
+	if got, want := resp.Header.Get("X-Symbols-DB-Version"), strconv.Itoa(symbolsDBVersion); got != want {
+		t.Errorf("got X-Symbols-DB-Version %q, want %q", got, want)
+	}
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ioutil.TempFile("", "symbols-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, zr); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := sqlx.Open("sqlite3_with_pcre", f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var symbols, files int
+	if err := db.Get(&symbols, `SELECT COUNT(*) FROM symbols WHERE path = 'a.js'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&files, `SELECT COUNT(*) FROM files`); err != nil {
+		t.Fatal(err)
+	}
+	if symbols != 2 || files != 2 {
+		t.Errorf("got %d symbols and %d files, want 2 and 2", symbols, files)
+	}
+}
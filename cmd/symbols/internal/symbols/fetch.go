@@ -5,21 +5,48 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"io/ioutil"
 	"path"
+	"strings"
 
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	log15 "gopkg.in/inconshreveable/log15.v2"
 )
 
 type parseRequest struct {
 	path string
 	data []byte
+
+	// language, if set, is the language to parse the file as, overriding
+	// the detected language.
+	language string
+
+	// dropKinds are kinds of symbols to leave out of this file, in addition
+	// to those of the parse.
+	dropKinds map[string]bool
 }
 
-func (s *Service) fetchRepositoryArchive(ctx context.Context, repo api.RepoName, commitID api.CommitID) (<-chan parseRequest, <-chan error, error) {
+// Reasons for a file of a commit to not be parsed, passed to the onSkip
+// callback of fetchRepositoryArchive.
+const (
+	skipJSON      = "json"
+	skipTooLarge  = "too large"
+	skipBinary    = "binary"
+	skipGenerated = "generated"
+	skipExcluded  = "excluded"
+	skipTooDeep   = "too deep"
+	skipIgnored   = "ignored"
+)
+
+// fetchRepositoryArchive fetches the archive of repo@commitID and returns the
+// files to parse. Of opts it uses maxDepth to leave out deep files, and calls
+// onSkip with each regular file that is left out. If s.FollowGitignore is set,
+// the files ignored by .gitignore files are left out too.
+func (s *Service) fetchRepositoryArchive(ctx context.Context, fetchTar func(context.Context, gitserver.Repo, api.CommitID) (io.ReadCloser, error), repo api.RepoName, commitID api.CommitID, opts parseOptions) (<-chan parseRequest, <-chan error, error) {
 	fetchQueueSize.Inc()
 	s.fetchSem <- 1 // acquire concurrent fetches semaphore
 	fetchQueueSize.Dec()
@@ -30,6 +57,11 @@ func (s *Service) fetchRepositoryArchive(ctx context.Context, repo api.RepoName,
 	span.SetTag("repo", repo)
 	span.SetTag("commit", commitID)
 
+	onSkip := opts.onSkip
+	if onSkip == nil {
+		onSkip = func(string, string) {}
+	}
+
 	requestCh := make(chan parseRequest, s.NumParserProcesses)
 	errCh := make(chan error, 1)
 
@@ -59,7 +91,7 @@ func (s *Service) fetchRepositoryArchive(ctx context.Context, repo api.RepoName,
 		span.Finish()
 	}
 
-	r, err := s.FetchTar(ctx, gitserver.Repo{Name: repo}, commitID)
+	r, err := fetchTar(ctx, gitserver.Repo{Name: repo}, commitID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -72,6 +104,59 @@ func (s *Service) fetchRepositoryArchive(ctx context.Context, repo api.RepoName,
 		defer r.Close()
 		buf := make([]byte, 32*1024) // 32*1024 is the same size used by io.Copy
 		tr := tar.NewReader(r)
+
+		// The repository's configuration applies to every file, but is only
+		// known once it is read from the archive. Archives list files in path
+		// order, so the few files sorting before repoConfigPath (such as
+		// .github/*) are held back until it has been read or can no longer
+		// appear. They don't count towards the fetch bytes budget while held,
+		// so that they can't starve each other of it.
+		var (
+			config         *repoConfig
+			configResolved bool
+			held           []parseRequest
+		)
+		send := func(req parseRequest) error {
+			if !config.apply(&req) {
+				onSkip(req.path, skipExcluded)
+				return nil
+			}
+			if err := s.acquireFetchBytes(ctx, len(req.data)); err != nil {
+				return err
+			}
+			requestCh <- req
+			return nil
+		}
+		resolveConfig := func(c *repoConfig) error {
+			config, configResolved = c, true
+			for _, req := range held {
+				if err := send(req); err != nil {
+					return err
+				}
+			}
+			held = nil
+			return nil
+		}
+		add := func(req parseRequest) error {
+			if !configResolved {
+				held = append(held, req)
+				return nil
+			}
+			return send(req)
+		}
+		var ignores *gitignores
+		if s.FollowGitignore {
+			ignores = newGitignores(func(path string) { onSkip(path, skipIgnored) })
+		}
+		addAll := func(reqs []parseRequest) error {
+			for _, req := range reqs {
+				if err := add(req); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
 		for {
 			if ctx.Err() != nil {
 				done(ctx.Err())
@@ -80,7 +165,14 @@ func (s *Service) fetchRepositoryArchive(ctx context.Context, repo api.RepoName,
 
 			hdr, err := tr.Next()
 			if err == io.EOF {
-				done(nil)
+				var err error
+				if ignores != nil {
+					err = addAll(ignores.finish())
+				}
+				if err == nil && !configResolved {
+					err = resolveConfig(nil)
+				}
+				done(err)
 				return
 			}
 			if err != nil {
@@ -88,21 +180,79 @@ func (s *Service) fetchRepositoryArchive(ctx context.Context, repo api.RepoName,
 				return
 			}
 
-			if path.Ext(hdr.Name) == ".json" {
-				continue
+			if ignores != nil {
+				if err := addAll(ignores.visit(hdr.Name)); err != nil {
+					done(err)
+					return
+				}
+				if path.Base(hdr.Name) == gitignoreName && (hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA) && hdr.Size <= maxGitignoreSize {
+					data, err := ioutil.ReadAll(tr)
+					if err == nil {
+						err = addAll(ignores.read(data))
+					}
+					if err != nil {
+						done(err)
+						return
+					}
+					continue
+				}
+			}
+
+			if !configResolved {
+				if hdr.Name == repoConfigPath && hdr.Size <= maxRepoConfigSize {
+					data, err := ioutil.ReadAll(tr)
+					if err != nil {
+						done(err)
+						return
+					}
+					c, err := parseRepoConfig(data)
+					if err != nil {
+						log15.Warn("Ignoring invalid repository symbols configuration", "repo", repo, "commit", commitID, "path", repoConfigPath, "error", err)
+					}
+					if err := resolveConfig(c); err != nil {
+						done(err)
+						return
+					}
+					continue
+				}
+				if hdr.Name > repoConfigPath {
+					if err := resolveConfig(nil); err != nil {
+						done(err)
+						return
+					}
+				}
 			}
 
 			// We only care about files
 			if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
 				continue
 			}
+			if ignores != nil && ignores.ignored(hdr.Name) {
+				onSkip(hdr.Name, skipIgnored)
+				continue
+			}
+			if opts.maxDepth > 0 && strings.Count(hdr.Name, "/") >= opts.maxDepth {
+				onSkip(hdr.Name, skipTooDeep)
+				continue
+			}
+			if path.Ext(hdr.Name) == ".json" {
+				onSkip(hdr.Name, skipJSON)
+				continue
+			}
 			// We do not search large files
 			if hdr.Size > maxFileSize {
+				onSkip(hdr.Name, skipTooLarge)
+				continue
+			}
+			if s.SkipGeneratedFiles && s.isGeneratedPath(hdr.Name) {
+				generatedFilesSkipped.Inc()
+				onSkip(hdr.Name, skipGenerated)
 				continue
 			}
 			// Heuristic: Assume file is binary if first 256 bytes contain a 0x00. Best effort, so ignore err.
 			n, err := tr.Read(buf)
 			if n > 0 && bytes.IndexByte(buf[:n], 0x00) >= 0 {
+				onSkip(hdr.Name, skipBinary)
 				continue
 			}
 			switch err {
@@ -115,6 +265,11 @@ func (s *Service) fetchRepositoryArchive(ctx context.Context, repo api.RepoName,
 				done(err)
 				return
 			}
+			if s.SkipGeneratedFiles && hasGeneratedHeader(buf[:n]) {
+				generatedFilesSkipped.Inc()
+				onSkip(hdr.Name, skipGenerated)
+				continue
+			}
 
 			// Read the file's contents.
 			data := make([]byte, int(hdr.Size))
@@ -126,14 +281,63 @@ func (s *Service) fetchRepositoryArchive(ctx context.Context, repo api.RepoName,
 					return
 				}
 			}
-			requestCh <- parseRequest{path: hdr.Name, data: data}
+			req := parseRequest{path: hdr.Name, data: data}
+			if ignores != nil {
+				err = addAll(ignores.add(req))
+			} else {
+				err = add(req)
+			}
+			if err != nil {
+				done(err)
+				return
+			}
 		}
 	}()
 
 	return requestCh, errCh, nil
 }
 
+// fetchBytesWeight returns the weight a file of n bytes takes from the byte
+// budget. Files larger than the whole budget take all of it, so that they
+// can still be fetched (one at a time).
+func (s *Service) fetchBytesWeight(n int) int64 {
+	if int64(n) > s.MaxConcurrentFetchTarBytes {
+		return s.MaxConcurrentFetchTarBytes
+	}
+	return int64(n)
+}
+
+// acquireFetchBytes blocks until n bytes fetched from an archive can be held
+// in memory without exceeding MaxConcurrentFetchTarBytes. Every successful
+// call must be paired with a call to releaseFetchBytes once the bytes have
+// been parsed or dropped.
+func (s *Service) acquireFetchBytes(ctx context.Context, n int) error {
+	if s.fetchBytesSem != nil {
+		if err := s.fetchBytesSem.Acquire(ctx, s.fetchBytesWeight(n)); err != nil {
+			return err
+		}
+	}
+	fetchBytesInFlight.Add(float64(n))
+	s.memory.addFetched(int64(n))
+	return nil
+}
+
+// releaseFetchBytes releases bytes acquired by acquireFetchBytes.
+func (s *Service) releaseFetchBytes(n int) {
+	if s.fetchBytesSem != nil {
+		s.fetchBytesSem.Release(s.fetchBytesWeight(n))
+	}
+	fetchBytesInFlight.Sub(float64(n))
+	s.memory.addFetched(-int64(n))
+}
+
 var (
+	fetchBytesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "symbols",
+		Subsystem: "store",
+		Name:      "fetch_bytes_in_flight",
+		Help:      "The number of bytes fetched from archives that are waiting to be parsed or being parsed.",
+	})
 	fetching = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: "symbols",
 		Subsystem: "store",
@@ -155,6 +359,7 @@ var (
 )
 
 func init() {
+	prometheus.MustRegister(fetchBytesInFlight)
 	prometheus.MustRegister(fetching)
 	prometheus.MustRegister(fetchQueueSize)
 	prometheus.MustRegister(fetchFailed)
@@ -0,0 +1,155 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+// maxFilesPerRequest is the maximum number of paths that can be requested at
+// once from the files endpoint.
+const maxFilesPerRequest = maxBlobsPerRequest
+
+// handleFiles returns the symbols of only the given files of a commit, such as
+// the files it changed, without fetching and parsing the whole commit. The
+// files are resolved to their blobs, so their symbols are cached by content
+// and shared with the blobs endpoint and other commits. Requested paths that
+// are not files in the commit are reported as missing rather than failing the
+// request.
+func (s *Service) handleFiles(w http.ResponseWriter, r *http.Request) {
+	var args protocol.FilesArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.ListBlobs == nil || s.FetchBlob == nil {
+		http.Error(w, "fetching files is not supported", http.StatusNotImplemented)
+		return
+	}
+	if len(args.Paths) > maxFilesPerRequest {
+		http.Error(w, fmt.Sprintf("too many paths (maximum is %d)", maxFilesPerRequest), http.StatusBadRequest)
+		return
+	}
+
+	accessLog := accessLogFromContext(r.Context())
+	accessLog.Repo, accessLog.CommitID = args.Repo, args.CommitID
+
+	if !s.checkRepoAccess(w, r, args.Repo) {
+		return
+	}
+	release, ok := s.acquireCommitRequest(w, args.Repo, args.CommitID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	repo := gitserver.Repo{Name: args.Repo}
+	var hashes map[string]string
+	if len(args.Paths) > 0 {
+		var err error
+		hashes, err = s.ListBlobs(ctx, repo, args.CommitID, args.Paths)
+		if err != nil {
+			writeSearchError(w, r, protocol.SearchArgs{Repo: args.Repo, CommitID: args.CommitID}, errors.Wrap(err, "listing blobs"))
+			return
+		}
+	}
+
+	cached := true
+	for filePath, hash := range hashes {
+		if !s.blobCached(args.Repo, hash, filePath) {
+			cached = false
+			break
+		}
+	}
+	if !cached && s.rejectIfSaturated(w) {
+		return
+	}
+
+	var (
+		result   protocol.FilesResult
+		files    = make([]*protocol.FileSymbols, len(args.Paths))
+		seen     = make(map[string]bool, len(args.Paths))
+		mem      = s.newRequestMemory(ctx)
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, s.parseConcurrency())
+	)
+	for i, filePath := range args.Paths {
+		hash, ok := hashes[filePath]
+		if !ok {
+			result.Missing = append(result.Missing, filePath)
+			continue
+		}
+		if seen[filePath] {
+			continue
+		}
+		seen[filePath] = true
+
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int, filePath, hash string) {
+			defer func() {
+				wg.Done()
+				<-sem
+			}()
+			symbols, err := s.parseBlob(ctx, args.Repo, hash, filePath, func(ctx context.Context) (io.ReadCloser, error) {
+				return s.FetchBlob(ctx, repo, hash)
+			})
+			if err == nil {
+				err = mem.add(symbols...)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				exceeded := isMemoryExceeded(err)
+				if firstErr == nil || exceeded {
+					firstErr = errors.Wrapf(err, "parsing %s", filePath)
+				}
+				if exceeded {
+					cancel() // stop parsing the remaining files
+				}
+				return
+			}
+			files[i] = &protocol.FileSymbols{Path: filePath, Symbols: symbols}
+		}(i, filePath, hash)
+	}
+	wg.Wait()
+
+	if err := r.Context().Err(); err != nil {
+		return // client went away
+	}
+	if firstErr != nil {
+		if isMemoryExceeded(firstErr) {
+			http.Error(w, firstErr.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, firstErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, f := range files {
+		if f != nil {
+			result.Files = append(result.Files, *f)
+			accessLog.Symbols += len(f.Symbols)
+		}
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,88 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags/ctagstest"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_files(t *testing.T) {
+	// copy/a.js is a copy of a.js, so they are the same blob.
+	blobs := map[string]string{
+		"a.js":      "1111111111111111111111111111111111111111",
+		"copy/a.js": "1111111111111111111111111111111111111111",
+		"c.js":      "2222222222222222222222222222222222222222",
+	}
+	var (
+		mu      sync.Mutex
+		fetched []string
+	)
+	parser := &ctagstest.Parser{Default: []ctags.Entry{{Name: "x", Kind: "variable"}}}
+	service := &Service{
+		ListBlobs: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, paths []string) (map[string]string, error) {
+			hashes := make(map[string]string)
+			for _, p := range paths {
+				if hash, ok := blobs[p]; ok {
+					hashes[p] = hash
+				}
+			}
+			return hashes, nil
+		},
+		FetchBlob: func(ctx context.Context, repo gitserver.Repo, hash string) (io.ReadCloser, error) {
+			mu.Lock()
+			fetched = append(fetched, hash)
+			mu.Unlock()
+			return ioutil.NopCloser(strings.NewReader("var x = 1\n")), nil
+		},
+		NewParser: parser.New,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	files := func(paths ...string) protocol.FilesResult {
+		t.Helper()
+		resp := postJSON(t, server.URL+"/files", protocol.FilesArgs{Repo: "r", CommitID: "c", Paths: paths})
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d", resp.StatusCode)
+		}
+		var result protocol.FilesResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := files("a.js", "gone.js")
+	want := protocol.FilesResult{
+		Files:   []protocol.FileSymbols{{Path: "a.js", Symbols: []protocol.Symbol{{Name: "x", Path: "a.js", Kind: "variable"}}}},
+		Missing: []string{"gone.js"},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %+v, want %+v", result, want)
+	}
+
+	// copy/a.js is cached by its blob, so only c.js is fetched and parsed.
+	result = files("copy/a.js", "c.js")
+	if len(result.Files) != 2 || result.Files[0].Path != "copy/a.js" || result.Files[0].Symbols[0].Path != "copy/a.js" || result.Files[1].Path != "c.js" {
+		t.Errorf("got %+v, want copy/a.js and c.js", result)
+	}
+	if want := []string{blobs["a.js"], blobs["c.js"]}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched %v, want %v", fetched, want)
+	}
+	if want := []string{"a.js", "c.js"}; !reflect.DeepEqual(parser.Parsed(), want) {
+		t.Errorf("parsed %v, want %v", parser.Parsed(), want)
+	}
+}
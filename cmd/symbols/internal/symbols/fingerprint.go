@@ -0,0 +1,116 @@
+package symbols
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// fingerprintVersion is hashed first into every fingerprint. It must be
+// incremented when the fields or the encoding hashed by symbolsFingerprint
+// change, so that fingerprints computed differently never compare equal.
+const fingerprintVersion = 1
+
+// handleFingerprint responds with a protocol.FingerprintResult, so that a
+// client can tell whether the symbols of two commits differ (or whether
+// symbols it already has are still current) without fetching them.
+func (s *Service) handleFingerprint(w http.ResponseWriter, r *http.Request) {
+	var args protocol.FingerprintArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accessLog := accessLogFromContext(r.Context())
+	accessLog.Repo, accessLog.CommitID = args.Repo, args.CommitID
+
+	if !s.checkRepoAccess(w, r, args.Repo) {
+		return
+	}
+	release, ok := s.acquireCommitRequest(w, args.Repo, args.CommitID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	searchArgs := protocol.SearchArgs{Repo: args.Repo, CommitID: args.CommitID, IncludeKinds: args.IncludeKinds}
+	cached := s.cache.Exists(s.searchCacheKey(searchArgs))
+	accessLog.setCacheHit(cached)
+	if !cached && s.rejectIfSaturated(w) {
+		return
+	}
+
+	db, err := s.openDB(r.Context(), searchArgs)
+	if err != nil {
+		writeSearchError(w, r, searchArgs, err)
+		return
+	}
+	defer db.Close()
+
+	result, err := symbolsFingerprint(r.Context(), db)
+	if err != nil {
+		writeSearchError(w, r, searchArgs, err)
+		return
+	}
+	truncated, err := commitTruncation(r.Context(), db)
+	if err != nil {
+		writeSearchError(w, r, searchArgs, err)
+		return
+	}
+	result.SkippedFiles, result.Truncated = truncated.skippedFiles, truncated.reasons
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log15.Error("Failed to write symbols fingerprint response", "error", err)
+	}
+}
+
+// symbolsFingerprint hashes the symbols of db. The symbols are read sorted by
+// all of the hashed fields, so the fingerprint only depends on which symbols
+// there are. Source is left out because it is only a trimmed copy of the line
+// Pattern matches.
+func symbolsFingerprint(ctx context.Context, db *sqlx.DB) (*protocol.FingerprintResult, error) {
+	rows, err := db.QueryxContext(ctx, `
+		SELECT name, path, line, kind, language, parent, parentkind, signature, pattern, filelimited
+		FROM symbols
+		ORDER BY path, line, name, kind, language, parent, parentkind, signature, pattern, filelimited`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	h := sha256.New()
+	writeFingerprintInt(h, fingerprintVersion)
+	result := &protocol.FingerprintResult{}
+	for rows.Next() {
+		var symbol symbolInDB
+		if err := rows.Scan(&symbol.Name, &symbol.Path, &symbol.Line, &symbol.Kind, &symbol.Language, &symbol.Parent, &symbol.ParentKind, &symbol.Signature, &symbol.Pattern, &symbol.FileLimited); err != nil {
+			return nil, err
+		}
+		for _, field := range []string{symbol.Name, symbol.Path, strconv.Itoa(symbol.Line), symbol.Kind, symbol.Language, symbol.Parent, symbol.ParentKind, symbol.Signature, symbol.Pattern, strconv.FormatBool(symbol.FileLimited)} {
+			// Length prefixed, so that fields can't run into each other.
+			writeFingerprintInt(h, int64(len(field)))
+			h.Write([]byte(field))
+		}
+		result.Symbols++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	result.Fingerprint = hex.EncodeToString(h.Sum(nil))
+	return result, nil
+}
+
+func writeFingerprintInt(h hash.Hash, n int64) {
+	var buf [binary.MaxVarintLen64]byte
+	h.Write(buf[:binary.PutVarint(buf[:], n)])
+}
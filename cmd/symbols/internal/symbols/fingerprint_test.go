@@ -0,0 +1,66 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_fingerprint(t *testing.T) {
+	commits := map[api.CommitID]map[string]string{
+		"c1": {"a.js": "x", "b.js": "y"},
+		"c2": {"b.js": "y", "a.js": "x", "README": "no symbols"},
+		"c3": {"a.js": "x", "b.js": "z"},
+	}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(commits[commit])
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return parserFunc(func(name string, content []byte) ([]ctags.Entry, error) {
+				if name == "README" {
+					return nil, nil
+				}
+				return []ctags.Entry{{Name: string(content), Path: name, Line: 1, Kind: "variable"}}, nil
+			}), nil
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	fingerprint := func(commit api.CommitID) protocol.FingerprintResult {
+		t.Helper()
+		resp := postJSON(t, server.URL+"/fingerprint", protocol.FingerprintArgs{Repo: "r", CommitID: commit})
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d", resp.StatusCode)
+		}
+		var result protocol.FingerprintResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	c1, c2, c3 := fingerprint("c1"), fingerprint("c2"), fingerprint("c3")
+	if c1.Symbols != 2 || c1.Fingerprint == "" {
+		t.Errorf("got %+v, want the fingerprint of 2 symbols", c1)
+	}
+	if !reflect.DeepEqual(c1, c2) {
+		t.Errorf("got %+v and %+v for commits with the same symbols, want equal fingerprints", c1, c2)
+	}
+	if c1.Fingerprint == c3.Fingerprint {
+		t.Errorf("got fingerprint %s for commits with different symbols, want different fingerprints", c1.Fingerprint)
+	}
+	if again := fingerprint("c1"); !reflect.DeepEqual(again, c1) {
+		t.Errorf("got %+v for the cached commit, want %+v", again, c1)
+	}
+}
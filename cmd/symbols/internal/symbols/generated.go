@@ -0,0 +1,79 @@
+package symbols
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultGeneratedFilePatterns are the file name patterns of generated files
+// used when SkipGeneratedFiles is set without GeneratedFilePatterns.
+var DefaultGeneratedFilePatterns = []string{
+	"*.pb.go", "*.pb.gw.go", "*_pb2.py", "*_pb2_grpc.py", "*.pb.h", "*.pb.cc",
+	"*_generated.go", "zz_generated.*",
+	"*.min.js", "*.bundle.js",
+}
+
+// generatedHeaderBytes is how much of the start of a file is scanned for a
+// generated code marker.
+const generatedHeaderBytes = 1024
+
+// generatedHeader matches the markers generators put at the top of their
+// output, such as Go's "// Code generated by protoc-gen-go. DO NOT EDIT.".
+var generatedHeader = regexp.MustCompile(`(?m)^\W*(Code generated .*DO NOT EDIT|@generated\b)`)
+
+// validateGeneratedFilePatterns returns an error if any of patterns is not a
+// valid path.Match pattern.
+func validateGeneratedFilePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.Wrapf(err, "invalid generated file pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// isGeneratedPath reports whether filePath matches one of the
+// GeneratedFilePatterns.
+func (s *Service) isGeneratedPath(filePath string) bool {
+	return matchesAny(s.GeneratedFilePatterns, filePath)
+}
+
+// matchesAny reports whether filePath matches one of the path.Match patterns.
+// Patterns containing a slash are matched against the whole path, others
+// against the file name.
+func matchesAny(patterns []string, filePath string) bool {
+	for _, p := range patterns {
+		name := path.Base(filePath)
+		if strings.Contains(p, "/") {
+			name = filePath
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGeneratedHeader reports whether the start of a file has a generated code
+// marker.
+func hasGeneratedHeader(start []byte) bool {
+	if len(start) > generatedHeaderBytes {
+		start = start[:generatedHeaderBytes]
+	}
+	return generatedHeader.Match(start)
+}
+
+var generatedFilesSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "symbols",
+	Subsystem: "store",
+	Name:      "generated_files_skipped",
+	Help:      "The total number of generated files not parsed.",
+})
+
+func init() {
+	prometheus.MustRegister(generatedFilesSkipped)
+}
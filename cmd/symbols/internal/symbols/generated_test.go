@@ -0,0 +1,78 @@
+package symbols
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestHasGeneratedHeader(t *testing.T) {
+	for header, want := range map[string]bool{
+		"// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage pb": true,
+		"# Code generated by make; DO NOT EDIT.\n":                       true,
+		"/*\n * @generated by bundler\n */":                              true,
+		"package main\n\n// Code generated by hand would be odd.":        false,
+		"// This file is not @generatedlike.":                            false,
+	} {
+		if got := hasGeneratedHeader([]byte(header)); got != want {
+			t.Errorf("%q: got %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestIsGeneratedPath(t *testing.T) {
+	s := &Service{GeneratedFilePatterns: []string{"*.pb.go", "vendor/*/gen.js"}}
+	for filePath, want := range map[string]bool{
+		"api/service.pb.go":   true,
+		"service.pb.go":       true,
+		"vendor/lib/gen.js":   true,
+		"src/vendor/x/gen.js": false,
+		"gen.js":              false,
+		"service.go":          false,
+	} {
+		if got := s.isGeneratedPath(filePath); got != want {
+			t.Errorf("%q: got %v, want %v", filePath, got, want)
+		}
+	}
+}
+
+func TestService_skipGeneratedFiles(t *testing.T) {
+	files := map[string]string{
+		"a.go":    "package a",
+		"a.pb.go": "package a",
+		"gen.go":  "// Code generated by stringer; DO NOT EDIT.\n\npackage a",
+	}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(files)
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return entriesParser{{Name: "x", Line: 1}}, nil
+		},
+		SkipGeneratedFiles: true,
+	}
+	_, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	skipped := testutil.ToFloat64(generatedFilesSkipped)
+	result, err := service.search(context.Background(), protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Symbols) != 1 || result.Symbols[0].Path != "a.go" {
+		t.Errorf("got %+v, want only the symbols of a.go", result.Symbols)
+	}
+	if n := testutil.ToFloat64(generatedFilesSkipped) - skipped; n != 2 {
+		t.Errorf("got %v generated files skipped, want 2", n)
+	}
+
+	if err := (&Service{GeneratedFilePatterns: []string{"["}}).Start(); err == nil {
+		t.Error("expected an invalid pattern to fail Start")
+	}
+}
@@ -0,0 +1,198 @@
+package symbols
+
+import (
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+)
+
+// gitignoreName is the name of the files whose patterns exclude files of
+// their directory (and its subdirectories) from parsing, if
+// Service.FollowGitignore is set.
+const gitignoreName = ".gitignore"
+
+// maxGitignoreSize is the limit on the size of a .gitignore file; larger
+// files are ignored.
+const maxGitignoreSize = 1 << 20
+
+// ignoreDir is a directory of an archive being fetched.
+type ignoreDir struct {
+	parent *ignoreDir
+	path   []string // path components, empty for the root
+
+	// patterns are the patterns of the directory's .gitignore.
+	patterns []gitignore.Pattern
+
+	// resolved is whether the directory's .gitignore has been read or can no
+	// longer appear in the archive.
+	resolved bool
+
+	// all and matcher are the patterns of the directory and its parents,
+	// built once the first file of the directory is matched.
+	all     []gitignore.Pattern
+	matcher gitignore.Matcher
+}
+
+// ready reports whether the files of the directory can be matched, because
+// it and its parents are resolved.
+func (d *ignoreDir) ready() bool {
+	for ; d != nil; d = d.parent {
+		if !d.resolved {
+			return false
+		}
+	}
+	return true
+}
+
+// ignored reports whether the file at filePath in the directory is ignored.
+// The directory must be ready.
+func (d *ignoreDir) ignored(filePath string) bool {
+	d.build()
+	return d.matcher.Match(strings.Split(filePath, "/"), false)
+}
+
+// build builds the patterns of the directory and its parents, if they are
+// not built yet.
+func (d *ignoreDir) build() {
+	if d.matcher != nil {
+		return
+	}
+	if d.parent != nil {
+		d.parent.build()
+		d.all = append(d.all, d.parent.all...)
+	}
+	d.all = append(d.all, d.patterns...)
+	d.matcher = gitignore.NewMatcher(d.all)
+}
+
+// gitignores leaves out the files of an archive that are ignored by the
+// .gitignore files of their directories, as the archive is read. Archives
+// list the entries of each directory in name order, depth first, so a
+// directory's .gitignore comes before nearly all of its files; the few files
+// sorting before it (such as .github/*) are held back until it has been read
+// or can no longer appear.
+type gitignores struct {
+	// onIgnored is called with the path of each ignored file.
+	onIgnored func(path string)
+
+	stack []*ignoreDir // the directories containing the current entry, the root first
+	held  []heldFile
+}
+
+type heldFile struct {
+	req parseRequest
+	dir *ignoreDir
+}
+
+func newGitignores(onIgnored func(path string)) *gitignores {
+	return &gitignores{onIgnored: onIgnored, stack: []*ignoreDir{{}}}
+}
+
+// visit must be called with the name of every entry of the archive, in
+// order, before any of the other methods for it. It returns the held files
+// that are no longer held back.
+func (g *gitignores) visit(name string) []parseRequest {
+	components := strings.Split(strings.TrimSuffix(name, "/"), "/")
+	parents := components[:len(components)-1]
+
+	// Leave the directories the entry is not in, which are complete.
+	for len(g.stack) > 1 {
+		top := g.stack[len(g.stack)-1]
+		if len(top.path) <= len(parents) && equalComponents(top.path, parents[:len(top.path)]) {
+			break
+		}
+		top.resolved = true
+		g.stack = g.stack[:len(g.stack)-1]
+	}
+	// Enter the directories of the entry that are new.
+	for len(g.stack) <= len(parents) {
+		top := g.stack[len(g.stack)-1]
+		g.stack = append(g.stack, &ignoreDir{parent: top, path: parents[:len(g.stack)]})
+	}
+
+	// Git sorts directories by their name with a trailing slash, so the
+	// entry (or the directory it's in) sorting after .gitignore in each
+	// directory means that the .gitignore is not in the archive.
+	for i, d := range g.stack {
+		child := components[i]
+		if i < len(parents) || strings.HasSuffix(name, "/") {
+			child += "/"
+		}
+		if child > gitignoreName {
+			d.resolved = true
+		}
+	}
+	return g.release()
+}
+
+// ignored reports whether the file at filePath, just visited, is known to be
+// ignored already. Files that are not are to be added with add.
+func (g *gitignores) ignored(filePath string) bool {
+	dir := g.stack[len(g.stack)-1]
+	return dir.ready() && dir.ignored(filePath)
+}
+
+// add adds a file to parse that is not known to be ignored, returning the
+// files to parse now: none if it is held back, otherwise the file.
+func (g *gitignores) add(req parseRequest) []parseRequest {
+	dir := g.stack[len(g.stack)-1]
+	if !dir.ready() {
+		g.held = append(g.held, heldFile{req: req, dir: dir})
+		return nil
+	}
+	return []parseRequest{req}
+}
+
+// read sets the patterns of the .gitignore with the content, just visited,
+// returning the held files that are no longer held back.
+func (g *gitignores) read(content []byte) []parseRequest {
+	dir := g.stack[len(g.stack)-1]
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		dir.patterns = append(dir.patterns, gitignore.ParsePattern(line, dir.path))
+	}
+	dir.resolved = true
+	return g.release()
+}
+
+// finish must be called at the end of the archive. It returns the files that
+// are still held back and not ignored.
+func (g *gitignores) finish() []parseRequest {
+	for _, d := range g.stack {
+		d.resolved = true
+	}
+	return g.release()
+}
+
+// release returns the held files that are ready and not ignored, in order.
+func (g *gitignores) release() []parseRequest {
+	var reqs []parseRequest
+	held := g.held[:0]
+	for _, f := range g.held {
+		switch {
+		case !f.dir.ready():
+			held = append(held, f)
+		case f.dir.ignored(f.req.path):
+			g.onIgnored(f.req.path)
+		default:
+			reqs = append(reqs, f.req)
+		}
+	}
+	g.held = held
+	return reqs
+}
+
+func equalComponents(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package symbols
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags/ctagstest"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_followGitignore(t *testing.T) {
+	// Archives list files in path order, so the files of .github come
+	// before the .gitignore that applies to them.
+	files := [][2]string{
+		{".github/", ""},
+		{".github/ci.log.js", "x"},
+		{".github/main.js", "x"},
+		{".gitignore", "# build output\nbuild/\n*.log.js\n!keep.log.js\n/root-only.js\n"},
+		{"a.js", "x"},
+		{"build/", ""},
+		{"build/out.js", "x"},
+		{"keep.log.js", "x"},
+		{"root-only.js", "x"},
+		{"sub/", ""},
+		{"sub/.b.gen.js", "x"},
+		{"sub/.gitignore", "*.gen.js\n"},
+		{"sub/a.gen.js", "x"},
+		{"sub/build.js", "x"},
+		{"sub/root-only.js", "x"},
+		{"sub2/x.gen.js", "x"},
+		{"trace.log.js", "x"},
+	}
+	parser := &ctagstest.Parser{Default: []ctags.Entry{{Name: "f", Kind: "function"}}}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			var buf bytes.Buffer
+			w := tar.NewWriter(&buf)
+			for _, f := range files {
+				hdr := &tar.Header{Name: f[0], Mode: 0600, Size: int64(len(f[1]))}
+				if f[0][len(f[0])-1] == '/' {
+					hdr.Typeflag, hdr.Mode = tar.TypeDir, 0700
+				}
+				if err := w.WriteHeader(hdr); err != nil {
+					return nil, err
+				}
+				if _, err := io.WriteString(w, f[1]); err != nil {
+					return nil, err
+				}
+			}
+			if err := w.Close(); err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(&buf), nil
+		},
+		NewParser:       parser.New,
+		FollowGitignore: true,
+	}
+	_, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	if _, err := service.search(context.Background(), protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".github/main.js", "a.js", "keep.log.js", "sub/build.js", "sub/root-only.js", "sub2/x.gen.js"}
+	if got := parser.Parsed(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got parsed files %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package symbols
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// idle tracks activity for the idle shutdown (see Service.IdleTimeout).
+type idle struct {
+	active   int64 // requests and warm jobs in progress, accessed atomically
+	lastDone int64 // when the last one finished in Unix nanoseconds, accessed atomically
+
+	ch chan struct{} // closed once the service has been idle for IdleTimeout
+}
+
+func (i *idle) begin() {
+	atomic.AddInt64(&i.active, 1)
+}
+
+func (i *idle) end() {
+	atomic.StoreInt64(&i.lastDone, time.Now().UnixNano())
+	atomic.AddInt64(&i.active, -1)
+}
+
+// idleFor reports how long nothing has been in progress, or 0 if something
+// is.
+func (i *idle) idleFor(now time.Time) time.Duration {
+	if atomic.LoadInt64(&i.active) > 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&i.lastDone)))
+}
+
+// Idle returns a channel that is closed once no requests have been served
+// and no background parses have run for IdleTimeout. It is nil (and so never
+// ready) if IdleTimeout is zero.
+func (s *Service) Idle() <-chan struct{} {
+	return s.idle.ch
+}
+
+// startIdleTimer starts watching for the service becoming idle, if
+// IdleTimeout is non-zero.
+func (s *Service) startIdleTimer() {
+	if s.IdleTimeout <= 0 {
+		return
+	}
+	s.idle.lastDone = time.Now().UnixNano()
+	s.idle.ch = make(chan struct{})
+
+	interval := s.IdleTimeout / 10
+	if interval > time.Second {
+		interval = time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if s.idle.idleFor(now) >= s.IdleTimeout {
+				close(s.idle.ch)
+				return
+			}
+		}
+	}()
+}
+
+// withIdleTracking wraps h so that every request except health checks
+// resets the idle timer.
+func (s *Service) withIdleTracking(h http.Handler) http.Handler {
+	if s.IdleTimeout <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			s.idle.begin()
+			defer s.idle.end()
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Stop closes the parser processes, waiting for those in use to be returned
+// to the pool until ctx is done. It should be called after the HTTP server has
+// shut down; the service can't be used afterwards.
+func (s *Service) Stop(ctx context.Context) error {
+	for i := 0; i < cap(s.parsers); i++ {
+		select {
+		case parser := <-s.parsers:
+			if parser != nil {
+				parser.Close()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package symbols
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+)
+
+func TestService_idle(t *testing.T) {
+	release := make(chan struct{})
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.js": "var x = 1"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return blockingParser(release), nil
+		},
+		IdleTimeout: 50 * time.Millisecond,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	// A request in progress keeps the service from becoming idle, however
+	// long it takes.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := http.Post(server.URL+"/search", "application/json", strings.NewReader(`{"repo":"r","commitID":"c"}`))
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	select {
+	case <-service.Idle():
+		t.Fatal("service became idle during a request")
+	case <-time.After(4 * service.IdleTimeout):
+	}
+	close(release)
+	<-done
+
+	select {
+	case <-service.Idle():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the service to become idle")
+	}
+}
+
+func TestService_Stop(t *testing.T) {
+	var closed int32
+	service := &Service{
+		NewParser: func() (ctags.Parser, error) {
+			return closeCountingParser{&closed}, nil
+		},
+		NumParserProcesses: 3,
+	}
+	_, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	if err := service.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&closed); n != 3 {
+		t.Errorf("got %d parsers closed, want 3", n)
+	}
+}
+
+// closeCountingParser is a parser that counts how often it is closed.
+type closeCountingParser struct {
+	closed *int32
+}
+
+func (closeCountingParser) Parse(name string, content []byte) ([]ctags.Entry, error) {
+	return nil, nil
+}
+
+func (p closeCountingParser) Close() { atomic.AddInt32(p.closed, 1) }
@@ -0,0 +1,180 @@
+package symbols
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// warmJobRetention is how long a finished warm job is remembered so that
+// clients can still learn its outcome.
+const warmJobRetention = 10 * time.Minute
+
+// maxStatusWait is the longest a client may long-poll the status endpoint.
+const maxStatusWait = 60 * time.Second
+
+// warmJob is a background parse of a repo@commit into the cache.
+type warmJob struct {
+	repo     api.RepoName
+	commitID api.CommitID
+
+	done chan struct{} // closed when the job finishes
+	err  error         // set before done is closed
+}
+
+// warmJobs tracks the background parses started by the service. Jobs are
+// identified by a random token, which can't be guessed from the repo@commit
+// it parses. Requesting the same commit again joins the existing job.
+type warmJobs struct {
+	mu     sync.Mutex
+	jobs   map[string]*warmJob // by token
+	tokens map[string]string   // the token of the latest job by cache key
+}
+
+// newWarmToken returns a new random warm job token.
+func newWarmToken() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// get returns the job for token, or nil if there is none.
+func (j *warmJobs) get(token string) *warmJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.jobs[token]
+}
+
+// startWarmJob starts parsing the repo@commit searched by args into the cache
+// in the background, unless a job for it is already running. It returns the
+// job's token.
+func (s *Service) startWarmJob(args protocol.SearchArgs) string {
+	repo, commitID := args.Repo, args.CommitID
+	key := s.searchCacheKey(args)
+
+	s.warmJobs.mu.Lock()
+	defer s.warmJobs.mu.Unlock()
+	if s.warmJobs.jobs == nil {
+		s.warmJobs.jobs = map[string]*warmJob{}
+		s.warmJobs.tokens = map[string]string{}
+	}
+	if token, ok := s.warmJobs.tokens[key]; ok {
+		job := s.warmJobs.jobs[token]
+		select {
+		case <-job.done:
+			if job.err == nil {
+				return token
+			}
+			// Retry failed jobs.
+		default:
+			return token
+		}
+	}
+
+	token := newWarmToken()
+	job := &warmJob{repo: repo, commitID: commitID, done: make(chan struct{})}
+	s.warmJobs.jobs[token] = job
+	s.warmJobs.tokens[key] = token
+	warmJobsRunning.Inc()
+
+	s.idle.begin()
+	go func() {
+		defer s.idle.end()
+		_, job.err = s.getDBFile(context.Background(), protocol.SearchArgs{Repo: repo, CommitID: commitID, IncludeKinds: args.IncludeKinds})
+		if job.err != nil {
+			log15.Error("Background symbols parse failed", "repo", repo, "commit", commitID, "error", job.err)
+		}
+		close(job.done)
+		warmJobsRunning.Dec()
+
+		time.AfterFunc(warmJobRetention, func() {
+			s.warmJobs.mu.Lock()
+			defer s.warmJobs.mu.Unlock()
+			delete(s.warmJobs.jobs, token)
+			if s.warmJobs.tokens[key] == token {
+				delete(s.warmJobs.tokens, key)
+			}
+		})
+	}()
+
+	return token
+}
+
+// handleStatus reports the status of a warm job started by an asynchronous
+// search, to callers allowed to access its repository. If the job is still running it waits up to the "wait" duration
+// (e.g. "30s") for it to finish before responding, so clients can long-poll.
+func (s *Service) handleStatus(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "missing token", http.StatusBadRequest)
+		return
+	}
+
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		var err error
+		wait, err = time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, "invalid wait: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if wait > maxStatusWait {
+			wait = maxStatusWait
+		}
+	}
+
+	job := s.warmJobs.get(token)
+	if job == nil {
+		http.Error(w, "unknown token", http.StatusNotFound)
+		return
+	}
+	if !s.checkRepoAccess(w, r, job.repo) {
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-job.done:
+	case <-timer.C:
+	case <-r.Context().Done():
+		return
+	}
+
+	var status protocol.SearchStatus
+	select {
+	case <-job.done:
+		status.Ready = job.err == nil
+		if job.err != nil {
+			status.Error = job.err.Error()
+		}
+	default:
+	}
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+var warmJobsRunning = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "symbols",
+	Subsystem: "warm",
+	Name:      "jobs_running",
+	Help:      "The number of background parses currently running.",
+})
+
+func init() {
+	prometheus.MustRegister(warmJobsRunning)
+}
@@ -0,0 +1,64 @@
+package symbols
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func newKindsResult(kinds map[string][]ctags.Kind) *protocol.KindsResult {
+	result := &protocol.KindsResult{Languages: make(map[string][]protocol.Kind, len(kinds))}
+	for language, ks := range kinds {
+		pks := make([]protocol.Kind, 0, len(ks))
+		for _, k := range ks {
+			pks = append(pks, protocol.Kind{Letter: k.Letter, Name: k.Name, Description: k.Description})
+		}
+		result.Languages[language] = pks
+	}
+	return result
+}
+
+// handleKinds responds with the kinds of symbols of each language. They are
+// listed once at startup, because they only change with the ctags binary.
+func (s *Service) handleKinds(w http.ResponseWriter, r *http.Request) {
+	if s.kinds == nil {
+		http.Error(w, "ctags kinds are not available", http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.kinds); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// dropKinds returns the kinds of symbols left out of the results of a search
+// that re-includes includeKinds: DropKinds without includeKinds, sorted and
+// without duplicates.
+func (s *Service) dropKinds(includeKinds []string) []string {
+	skip := make(map[string]bool, len(includeKinds))
+	for _, k := range includeKinds {
+		skip[k] = true
+	}
+	var drop []string
+	for _, k := range s.DropKinds {
+		if !skip[k] {
+			drop = append(drop, k)
+			skip[k] = true
+		}
+	}
+	sort.Strings(drop)
+	return drop
+}
+
+func kindSet(kinds []string) map[string]bool {
+	set := make(map[string]bool, len(kinds))
+	for _, k := range kinds {
+		set[k] = true
+	}
+	return set
+}
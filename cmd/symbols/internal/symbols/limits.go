@@ -0,0 +1,113 @@
+package symbols
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+// metaSkippedFiles is the key in the meta table of a symbols database of the
+// number of files of the commit that were not parsed because it has more than
+// Service.MaxFilesPerCommit files.
+const metaSkippedFiles = "skippedfiles"
+
+// metaTooLargeFiles is the key in the meta table of a symbols database of the
+// number of files of the commit that were not parsed because they are larger
+// than maxFileSize.
+const metaTooLargeFiles = "toolargefiles"
+
+// skippedFiles returns the number of files of the commit of db that were not
+// parsed because of Service.MaxFilesPerCommit. Databases written before the
+// limit existed have no meta table; they are complete.
+func skippedFiles(ctx context.Context, db *sqlx.DB) (int, error) {
+	return metaValue(ctx, db, metaSkippedFiles)
+}
+
+// metaValue returns the value of key in the meta table of db, or 0 if it is
+// not set.
+func metaValue(ctx context.Context, db *sqlx.DB, key string) (int, error) {
+	var n int
+	err := db.GetContext(ctx, &n, `SELECT value FROM meta WHERE key = ?`, key)
+	if err == sql.ErrNoRows || (err != nil && strings.Contains(err.Error(), "no such table")) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// truncation is how the result of a search is incomplete.
+type truncation struct {
+	skippedFiles int      // as in protocol.SearchResult
+	reasons      []string // protocol.Truncated* constants
+
+	// noParseableFiles is whether the commit has no parsed files (see
+	// protocol.SearchResult.NoParseableFiles).
+	noParseableFiles bool
+
+	// nextPage is the token of the next page of a paged search, if more
+	// symbols match than its page (see protocol.SearchArgs.PageSize).
+	nextPage string
+}
+
+// add adds a reason for the result to be incomplete.
+func (t *truncation) add(reason string) {
+	t.reasons = append(t.reasons, reason)
+}
+
+// commitTruncation returns how the symbols of the commit of db are
+// incomplete, because some of its files were not parsed.
+func commitTruncation(ctx context.Context, db *sqlx.DB) (truncation, error) {
+	var t truncation
+	var err error
+	if t.skippedFiles, err = skippedFiles(ctx, db); err != nil {
+		return truncation{}, err
+	}
+	if t.skippedFiles > 0 {
+		t.add(protocol.TruncatedFileCount)
+	}
+	tooLarge, err := metaValue(ctx, db, metaTooLargeFiles)
+	if err != nil {
+		return truncation{}, err
+	}
+	if tooLarge > 0 {
+		t.add(protocol.TruncatedFileSize)
+	}
+	if t.noParseableFiles, err = noParseableFiles(ctx, db); err != nil {
+		return truncation{}, err
+	}
+	return t, nil
+}
+
+// noParseableFiles reports whether no files of the commit of db were parsed,
+// because it has none or all of them were skipped (such as binary files).
+// The files table lists every parsed file, even those without symbols.
+func noParseableFiles(ctx context.Context, db *sqlx.DB) (bool, error) {
+	var parsed bool
+	if err := db.GetContext(ctx, &parsed, `SELECT EXISTS (SELECT 1 FROM files)`); err != nil {
+		return false, err
+	}
+	return !parsed, nil
+}
+
+var (
+	partialParses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "store",
+		Name:      "partial_parses",
+		Help:      "The total number of commits that were only partially parsed because they have more files than the maximum.",
+	})
+	searchTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "request",
+		Name:      "search_timeouts",
+		Help:      "The total number of searches that ran out of time and returned only the symbols found until then.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(partialParses)
+	prometheus.MustRegister(searchTimeouts)
+}
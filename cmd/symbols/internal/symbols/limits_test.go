@@ -0,0 +1,316 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags/ctagstest"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_maxFilesPerCommit(t *testing.T) {
+	parser := &ctagstest.Parser{Default: []ctags.Entry{{Name: "x"}}}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.go": "x", "b.go": "x", "c.go": "x", "d.go": "x", "e.go": "x"})
+		},
+		NewParser:         parser.New,
+		MaxFilesPerCommit: 3,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+	var result protocol.SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.SkippedFiles != 2 {
+		t.Errorf("got %d skipped files, want 2", result.SkippedFiles)
+	}
+	if got := parser.Parsed(); len(got) != 3 {
+		t.Errorf("got parsed files %v, want 3 files", got)
+	}
+
+	resp = postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", Count: true})
+	defer resp.Body.Close()
+	var count protocol.SearchCount
+	if err := json.NewDecoder(resp.Body).Decode(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count.Count != 3 || count.SkippedFiles != 2 {
+		t.Errorf("got count %d and %d skipped files, want 3 and 2", count.Count, count.SkippedFiles)
+	}
+}
+
+func TestSkippedFiles_noMetaTable(t *testing.T) {
+	MustRegisterSqlite3WithPcre()
+	db, err := sqlx.Open("sqlite3_with_pcre", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if n, err := skippedFiles(context.Background(), db); n != 0 || err != nil {
+		t.Errorf("got %d skipped files (error %v), want 0", n, err)
+	}
+}
+
+func TestService_maxDepth(t *testing.T) {
+	parser := &ctagstest.Parser{Default: []ctags.Entry{{Name: "x"}}}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.go": "x", "dir/b.go": "x", "dir/sub/c.go": "x"})
+		},
+		NewParser: parser.New,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	search := func(maxDepth int) []string {
+		t.Helper()
+		resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10, MaxDepth: maxDepth})
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d", resp.StatusCode)
+		}
+		var result protocol.SearchResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, symbol := range result.Symbols {
+			paths = append(paths, symbol.Path)
+		}
+		sort.Strings(paths)
+		return paths
+	}
+
+	if got, want := search(2), []string{"a.go", "dir/b.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got symbols in %v, want %v", got, want)
+	}
+	if got, want := parser.Parsed(), []string{"a.go", "dir/b.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got parsed files %v, want %v", got, want)
+	}
+	// The whole commit is cached separately.
+	if got, want := search(0), []string{"a.go", "dir/b.go", "dir/sub/c.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got symbols in %v, want %v", got, want)
+	}
+
+	resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", MaxDepth: -1})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for a negative maxDepth, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestService_truncated(t *testing.T) {
+	files := map[string]string{"a.go": "x", "b.go": "x", "c.go": "x", "d.go": "x", "big.go": strings.Repeat("x", maxFileSize+1)}
+	newService := func(maxFiles int) *Service {
+		return &Service{
+			FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+				return createTar(files)
+			},
+			NewParser:         (&ctagstest.Parser{Default: []ctags.Entry{{Name: "x"}}}).New,
+			MaxFilesPerCommit: maxFiles,
+		}
+	}
+
+	search := func(service *Service, args protocol.SearchArgs) protocol.SearchResult {
+		t.Helper()
+		server, cleanup := startTestService(t, service)
+		defer cleanup()
+		args.Repo, args.CommitID = "r", "c"
+		resp := postJSON(t, server.URL+"/search", args)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d", resp.StatusCode)
+		}
+		var result protocol.SearchResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	delete(files, "big.go")
+	if result := search(newService(0), protocol.SearchArgs{First: 10}); len(result.Symbols) != 4 || result.Truncated != nil {
+		t.Errorf("got %d symbols truncated by %v, want all 4 symbols", len(result.Symbols), result.Truncated)
+	}
+	if result := search(newService(0), protocol.SearchArgs{First: 4}); result.Truncated != nil {
+		t.Errorf("got truncated by %v for exactly First symbols, want complete", result.Truncated)
+	}
+	if result, want := search(newService(0), protocol.SearchArgs{First: 3}), []string{protocol.TruncatedLimit}; len(result.Symbols) != 3 || !reflect.DeepEqual(result.Truncated, want) {
+		t.Errorf("got %d symbols truncated by %v, want 3 truncated by %v", len(result.Symbols), result.Truncated, want)
+	}
+	if result, want := search(newService(2), protocol.SearchArgs{First: 10}), []string{protocol.TruncatedFileCount}; result.SkippedFiles != 2 || !reflect.DeepEqual(result.Truncated, want) {
+		t.Errorf("got %d skipped files and truncated by %v, want 2 and %v", result.SkippedFiles, result.Truncated, want)
+	}
+
+	files["big.go"] = strings.Repeat("x", maxFileSize+1)
+	service := newService(2)
+	want := []string{protocol.TruncatedFileCount, protocol.TruncatedFileSize, protocol.TruncatedLimit}
+	if result := search(service, protocol.SearchArgs{First: 1, GroupByFile: true}); !reflect.DeepEqual(result.Truncated, want) {
+		t.Errorf("got truncated by %v, want %v", result.Truncated, want)
+	}
+	if result := search(service, protocol.SearchArgs{Count: true}); !reflect.DeepEqual(result.Truncated, want[:2]) {
+		t.Errorf("got count truncated by %v, want %v", result.Truncated, want[:2])
+	}
+}
+
+func TestService_noParseableFiles(t *testing.T) {
+	for name, test := range map[string]struct {
+		files   map[string]string
+		entries []ctags.Entry
+		want    bool
+	}{
+		"empty":              {files: map[string]string{}, want: true},
+		"binaries only":      {files: map[string]string{"logo.png": "\x89PNG\x00\x00", "app.bin": "\x7fELF\x00"}, want: true},
+		"no symbols":         {files: map[string]string{"a.go": "package a"}},
+		"symbols":            {files: map[string]string{"a.go": "package a"}, entries: []ctags.Entry{{Name: "x"}}},
+		"binary and sources": {files: map[string]string{"logo.png": "\x89PNG\x00", "a.go": "package a"}},
+	} {
+		files := test.files
+		newService := func(status int) *Service {
+			return &Service{
+				FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+					return createTar(files)
+				},
+				NewParser:              (&ctagstest.Parser{Default: test.entries}).New,
+				NoParseableFilesStatus: status,
+			}
+		}
+
+		for _, args := range []protocol.SearchArgs{
+			{First: 10},
+			{First: 10, GroupByFile: true},
+			{First: 10, Format: protocol.FormatTree},
+			{Count: true},
+		} {
+			server, cleanup := startTestService(t, newService(0))
+			args.Repo, args.CommitID = "r", "c"
+			resp := postJSON(t, server.URL+"/search", args)
+			var result struct{ NoParseableFiles bool }
+			err := json.NewDecoder(resp.Body).Decode(&result)
+			resp.Body.Close()
+			cleanup()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.NoParseableFiles != test.want {
+				t.Errorf("%s: search %+v: got NoParseableFiles %v, want %v", name, args, result.NoParseableFiles, test.want)
+			}
+		}
+
+		server, cleanup := startTestService(t, newService(http.StatusNotFound))
+		resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10})
+		resp.Body.Close()
+		cleanup()
+		if want := map[bool]int{true: http.StatusNotFound, false: http.StatusOK}[test.want]; resp.StatusCode != want {
+			t.Errorf("%s: got status %d with NoParseableFilesStatus set, want %d", name, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestService_searchTimeout(t *testing.T) {
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.go": "x", "b.go": "x"})
+		},
+		NewParser: (&ctagstest.Parser{Default: []ctags.Entry{{Name: "x"}}}).New,
+	}
+	_, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	args := protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10}
+	if _, err := service.search(context.Background(), args); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(timeout time.Duration) { searchTimeout = timeout }(searchTimeout)
+	searchTimeout = 50 * time.Millisecond
+	var symbols int
+	truncated, err := service.searchFunc(context.Background(), args, func(protocol.Symbol) error {
+		symbols++
+		time.Sleep(2 * searchTimeout) // outlast the search
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{protocol.TruncatedTimeout}; symbols != 1 || !reflect.DeepEqual(truncated.reasons, want) {
+		t.Errorf("got %d symbols truncated by %v, want 1 truncated by %v", symbols, truncated.reasons, want)
+	}
+
+	// A client going away is not a timeout.
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := service.searchFunc(ctx, args, func(protocol.Symbol) error {
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}); err == nil {
+		t.Error("expected an error for a canceled search")
+	}
+}
+
+func TestService_maxResponseBytes(t *testing.T) {
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.go": "x", "b.go": "x", "c.go": "x"})
+		},
+		NewParser: (&ctagstest.Parser{Default: []ctags.Entry{{Name: "x"}}}).New,
+	}
+	_, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	args := protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10}
+	all, err := service.search(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Symbols) != 3 {
+		t.Fatalf("got %d symbols, want 3", len(all.Symbols))
+	}
+
+	// The limit fits the first two symbols.
+	service.MaxResponseBytes = symbolResponseSize(all.Symbols[0]) + symbolResponseSize(all.Symbols[1])
+	result, err := service.search(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{protocol.TruncatedResponseSize}; len(result.Symbols) != 2 || !reflect.DeepEqual(result.Truncated, want) {
+		t.Errorf("got %d symbols truncated by %v, want 2 truncated by %v", len(result.Symbols), result.Truncated, want)
+	}
+
+	// A paged search continues after the symbols that fit.
+	args.PageSize = 10
+	result, err = service.search(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Symbols) != 2 || result.NextPageToken == "" {
+		t.Fatalf("got %d symbols and next page %q, want 2 and a next page", len(result.Symbols), result.NextPageToken)
+	}
+	args.PageToken = result.NextPageToken
+	result, err = service.search(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Symbols, all.Symbols[2:]) {
+		t.Errorf("got next page %+v, want %+v", result.Symbols, all.Symbols[2:])
+	}
+}
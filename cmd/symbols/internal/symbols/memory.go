@@ -0,0 +1,86 @@
+package symbols
+
+import (
+	"context"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+// errRequestMemoryExceeded is returned when the symbols accumulated by a
+// request exceed MaxRequestSymbolBytes.
+var errRequestMemoryExceeded = errors.New("request exceeded the symbols memory limit")
+
+// requestMemory approximately accounts for the memory held by the symbols a
+// single request accumulates, so that one huge request fails instead of
+// exhausting the memory of the whole process. It is safe for concurrent use.
+type requestMemory struct {
+	limit   int64 // zero means no limit
+	used    int64 // accessed atomically
+	aborted int32 // accessed atomically
+
+	// budget and charge, if the request is served within the memory budget,
+	// are the budget and the request's charge to it (see withMemoryBudget).
+	budget *memoryBudget
+	charge *budgetCharge
+}
+
+// newRequestMemory returns the memory accounting for a new request with
+// context ctx.
+func (s *Service) newRequestMemory(ctx context.Context) *requestMemory {
+	m := &requestMemory{limit: s.MaxRequestSymbolBytes}
+	if charge, ok := ctx.Value(budgetChargeKey{}).(*budgetCharge); ok {
+		m.budget, m.charge = &s.memory, charge
+	}
+	return m
+}
+
+// add accounts for symbols. It returns errRequestMemoryExceeded once the
+// request's total exceeds the limit, or errMemoryBudgetExceeded once the
+// service's projected memory exceeds its budget; the caller must then discard
+// what it has accumulated.
+func (m *requestMemory) add(symbols ...protocol.Symbol) error {
+	if m.limit <= 0 && m.budget == nil {
+		return nil
+	}
+	var n int64
+	for _, sym := range symbols {
+		n += symbolSize(sym)
+	}
+	if m.budget != nil {
+		atomic.AddInt64(&m.charge.bytes, n)
+		if !m.budget.addSymbols(n) {
+			if atomic.CompareAndSwapInt32(&m.aborted, 0, 1) {
+				memoryBudgetRejections.Inc()
+			}
+			return errMemoryBudgetExceeded
+		}
+	}
+	if m.limit <= 0 || atomic.AddInt64(&m.used, n) <= m.limit {
+		return nil
+	}
+	if atomic.CompareAndSwapInt32(&m.aborted, 0, 1) {
+		requestMemoryAborts.Inc()
+	}
+	return errRequestMemoryExceeded
+}
+
+// symbolSize is the approximate number of bytes sym occupies in memory.
+func symbolSize(sym protocol.Symbol) int64 {
+	return int64(unsafe.Sizeof(sym)) + int64(len(sym.Name)+len(sym.Path)+len(sym.Kind)+len(sym.Language)+
+		len(sym.Parent)+len(sym.ParentKind)+len(sym.Signature)+len(sym.Pattern)+len(sym.Source)+len(sym.URL))
+}
+
+var requestMemoryAborts = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "symbols",
+	Subsystem: "request",
+	Name:      "memory_aborts",
+	Help:      "The total number of requests aborted because their symbols exceeded the per-request memory limit.",
+})
+
+func init() {
+	prometheus.MustRegister(requestMemoryAborts)
+}
@@ -0,0 +1,120 @@
+package symbols
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/keegancsmith/sqlf"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+// pageCursor is the position a paged search continues at, encoded in
+// protocol.SearchResult.NextPageToken. Searches are ordered by path, line,
+// name and kind (see filterSymbols), so the cursor is the key of the last
+// symbol of the previous page. Only the database order of symbols with the
+// same key is arbitrary, so skip counts those already returned.
+type pageCursor struct {
+	Path   string `json:"p"`
+	Line   int    `json:"l"`
+	Name   string `json:"n"`
+	Kind   string `json:"k"`
+	Skip   int    `json:"s,omitempty"`
+	Search string `json:"q"` // searchFingerprint of the search
+}
+
+// errInvalidPageToken is returned for a page token that is malformed or of a
+// different search.
+var errInvalidPageToken = errors.New("invalid page token")
+
+// validatePagination returns an error if the pagination of args is invalid.
+func validatePagination(args protocol.SearchArgs) error {
+	if args.PageSize < 0 {
+		return fmt.Errorf("invalid pageSize %d (must not be negative)", args.PageSize)
+	}
+	if args.PageSize == 0 {
+		if args.PageToken != "" {
+			return errors.New("pageToken requires pageSize")
+		}
+		return nil
+	}
+	if args.GroupByFile || args.Format != "" || args.Count {
+		return errors.New("pageSize is not supported with groupByFile, format or count")
+	}
+	_, err := decodePageToken(args)
+	return err
+}
+
+// searchFingerprint identifies the search of args regardless of the page (and
+// First, which pages ignore), so that a page token is only used for the
+// search it was returned for.
+func searchFingerprint(args protocol.SearchArgs) string {
+	args.PageSize, args.PageToken, args.First = 0, "", 0
+	b, _ := json.Marshal(args)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// decodePageToken returns the cursor of args.PageToken, or nil if it is
+// empty.
+func decodePageToken(args protocol.SearchArgs) (*pageCursor, error) {
+	if args.PageToken == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(args.PageToken)
+	if err != nil {
+		return nil, errInvalidPageToken
+	}
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Search != searchFingerprint(args) || c.Skip < 0 {
+		return nil, errInvalidPageToken
+	}
+	return &c, nil
+}
+
+func (c *pageCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// condition returns the SQL condition for the symbols ordered at or after
+// the cursor.
+func (c *pageCursor) condition() *sqlf.Query {
+	return sqlf.Sprintf("(path, line, name, kind) >= (%s, %s, %s, %s)", c.Path, c.Line, c.Name, c.Kind)
+}
+
+// at reports whether sym has the key of the cursor.
+func (c *pageCursor) at(sym protocol.Symbol) bool {
+	return sym.Path == c.Path && sym.Line == c.Line && sym.Name == c.Name && sym.Kind == c.Kind
+}
+
+// pageTracker follows the symbols returned by a page, to make the cursor of
+// the next page.
+type pageTracker struct {
+	search string
+	last   *pageCursor
+}
+
+func newPageTracker(args protocol.SearchArgs, start *pageCursor) *pageTracker {
+	return &pageTracker{search: searchFingerprint(args), last: start}
+}
+
+// add records that sym was returned.
+func (t *pageTracker) add(sym protocol.Symbol) {
+	if t.last != nil && t.last.at(sym) {
+		t.last.Skip++
+		return
+	}
+	t.last = &pageCursor{Path: sym.Path, Line: sym.Line, Name: sym.Name, Kind: sym.Kind, Skip: 1, Search: t.search}
+}
+
+// next returns the token of the page after the symbols added.
+func (t *pageTracker) next() string {
+	if t.last == nil {
+		return ""
+	}
+	return t.last.encode()
+}
@@ -0,0 +1,123 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags/ctagstest"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_pagination(t *testing.T) {
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.go": "x", "b.go": "x", "c.go": "x"})
+		},
+		// The duplicate entries have the same key, so pages must count
+		// which of them they returned.
+		NewParser: (&ctagstest.Parser{Default: []ctags.Entry{
+			{Name: "x", Line: 1, Kind: "func"},
+			{Name: "y", Line: 2, Kind: "func"},
+			{Name: "y", Line: 2, Kind: "func"},
+			{Name: "y", Line: 2, Kind: "func"},
+			{Name: "z", Line: 3, Kind: "var"},
+		}}).New,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	all, err := service.search(context.Background(), protocol.SearchArgs{Repo: "r", CommitID: "c", First: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Symbols) != 15 {
+		t.Fatalf("got %d symbols, want 15", len(all.Symbols))
+	}
+
+	for _, pageSize := range []int{1, 2, 4, 15, 100} {
+		var (
+			got   []protocol.Symbol
+			args  = protocol.SearchArgs{Repo: "r", CommitID: "c", PageSize: pageSize}
+			pages = 0
+		)
+		for {
+			resp := postJSON(t, server.URL+"/search", args)
+			if resp.StatusCode != http.StatusOK {
+				b, _ := ioutil.ReadAll(resp.Body)
+				t.Fatalf("page size %d: got status %d: %s", pageSize, resp.StatusCode, b)
+			}
+			var result protocol.SearchResult
+			err := json.NewDecoder(resp.Body).Decode(&result)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Symbols) > pageSize {
+				t.Fatalf("page size %d: got a page of %d symbols", pageSize, len(result.Symbols))
+			}
+			if len(result.Truncated) > 0 {
+				t.Errorf("page size %d: got a page truncated by %v", pageSize, result.Truncated)
+			}
+			got = append(got, result.Symbols...)
+			pages++
+			if result.NextPageToken == "" || pages > 20 {
+				break
+			}
+			args.PageToken = result.NextPageToken
+		}
+		if !reflect.DeepEqual(got, all.Symbols) {
+			t.Errorf("page size %d: got symbols %+v, want %+v", pageSize, got, all.Symbols)
+		}
+	}
+}
+
+func TestValidatePagination(t *testing.T) {
+	args := protocol.SearchArgs{Repo: "r", CommitID: "c", Query: "x", PageSize: 10}
+	token := newPageTracker(args, nil)
+	token.add(protocol.Symbol{Name: "x", Path: "a.go", Line: 1})
+	args.PageToken = token.next()
+	if err := validatePagination(args); err != nil {
+		t.Fatalf("unexpected error for a token of the search: %s", err)
+	}
+
+	for name, args := range map[string]protocol.SearchArgs{
+		"negative size":    {PageSize: -1},
+		"token but size":   {PageToken: args.PageToken},
+		"malformed token":  {PageSize: 10, PageToken: "!"},
+		"other search":     {Repo: "r", CommitID: "c", Query: "y", PageSize: 10, PageToken: args.PageToken},
+		"other commit":     {Repo: "r", CommitID: "d", Query: "x", PageSize: 10, PageToken: args.PageToken},
+		"grouped by file":  {PageSize: 10, GroupByFile: true},
+		"with a format":    {PageSize: 10, Format: protocol.FormatTree},
+		"counting symbols": {PageSize: 10, Count: true},
+	} {
+		if err := validatePagination(args); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// The page size may change between pages.
+	args.PageSize = 20
+	if err := validatePagination(args); err != nil {
+		t.Errorf("unexpected error for a different page size: %s", err)
+	}
+}
+
+func TestSearchPaginationStatus(t *testing.T) {
+	service := &Service{NewParser: (&ctagstest.Parser{}).New}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", PageSize: 10, PageToken: "x"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for an invalid page token, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
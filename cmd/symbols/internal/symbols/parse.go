@@ -1,11 +1,17 @@
 package symbols
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
@@ -14,6 +20,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
 	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
 	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
 	"golang.org/x/net/trace"
 	log15 "gopkg.in/inconshreveable/log15.v2"
@@ -34,10 +41,78 @@ func (s *Service) startParsers() error {
 		}
 		s.parsers <- parser
 	}
+
+	if s.MaxConcurrentParses == 0 {
+		s.MaxConcurrentParses = n
+	}
+	if s.MaxConcurrentParses < n {
+		s.parseSem = make(chan struct{}, s.MaxConcurrentParses)
+	}
 	return nil
 }
 
-func (s *Service) parseUncached(ctx context.Context, repo api.RepoName, commitID api.CommitID, callback func(symbol protocol.Symbol) error) (err error) {
+// parseConcurrency is the maximum number of files parsed at once: the number
+// of parsers, or MaxConcurrentParses if it is lower.
+func (s *Service) parseConcurrency() int {
+	if s.parseSem != nil {
+		return cap(s.parseSem)
+	}
+	return cap(s.parsers)
+}
+
+// parseOptions customize a parse of a repository done by parseUncached.
+type parseOptions struct {
+	// onFile, when non-nil, is called after each file is parsed.
+	onFile func(fileParse)
+
+	// fetchTar, when non-nil, is used instead of Service.FetchTar to get the
+	// archive of the repository.
+	fetchTar func(context.Context, gitserver.Repo, api.CommitID) (io.ReadCloser, error)
+
+	// dropKinds are the kinds of symbols to leave out.
+	dropKinds []string
+
+	// checkpointFiles, when positive, makes writeAllSymbolsToNewDB commit
+	// its progress after every checkpointFiles files, so that an interrupted
+	// parse can be resumed. See Service.ParseCheckpointFiles.
+	checkpointFiles int
+
+	// skipPaths are files that are not parsed, because a resumed parse
+	// already has their symbols.
+	skipPaths map[string]bool
+
+	// maxFiles when positive is the maximum number of files to parse
+	// (counting those in skipPaths). See Service.MaxFilesPerCommit.
+	maxFiles int
+
+	// onOverLimit, when non-nil, is called for each file that is not parsed
+	// because maxFiles files already were.
+	onOverLimit func(path string)
+
+	// maxDepth when positive is the maximum number of directory levels of
+	// the files to parse. See protocol.SearchArgs.MaxDepth.
+	maxDepth int
+
+	// onSkip, when non-nil, is called for each file of the commit that is not
+	// parsed because of what it is, with the reason (such as skipBinary). See
+	// fetchRepositoryArchive.
+	onSkip func(path, reason string)
+
+	// batchSize when positive overrides Service.ParseBatchSize.
+	batchSize int
+}
+
+// fileParse describes the parse of a single file.
+type fileParse struct {
+	path     string
+	size     int
+	language string // empty if the file had no symbols
+	symbols  int
+	duration time.Duration
+	err      error
+}
+
+func (s *Service) parseUncached(ctx context.Context, repo api.RepoName, commitID api.CommitID, opts parseOptions, callback func(symbol protocol.Symbol) error) (err error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "parseUncached")
 	defer func() {
 		if err != nil {
@@ -52,7 +127,20 @@ func (s *Service) parseUncached(ctx context.Context, repo api.RepoName, commitID
 	tr := trace.New("parseUncached", string(repo))
 	tr.LazyPrintf("commitID: %s", commitID)
 
-	totalSymbols := 0
+	var (
+		start              = time.Now()
+		totalSymbols       = 0
+		totalParseRequests = 0
+		slowestPath        string
+		slowestDuration    time.Duration
+	)
+	defer func() {
+		duration := time.Since(start)
+		if s.SlowParseThreshold > 0 && duration >= s.SlowParseThreshold {
+			slowParses.Inc()
+			log15.Warn("Slow symbols parse", "repo", repo, "commitID", commitID, "duration", duration, "files", totalParseRequests, "symbols", totalSymbols, "slowestPath", slowestPath, "slowestDuration", slowestDuration, "error", err)
+		}
+	}()
 	defer func() {
 		tr.LazyPrintf("symbols=%d", totalSymbols)
 		if err != nil {
@@ -63,7 +151,11 @@ func (s *Service) parseUncached(ctx context.Context, repo api.RepoName, commitID
 	}()
 
 	tr.LazyPrintf("fetch")
-	parseRequests, errChan, err := s.fetchRepositoryArchive(ctx, repo, commitID)
+	fetchTar := s.FetchTar
+	if opts.fetchTar != nil {
+		fetchTar = opts.fetchTar
+	}
+	parseRequests, errChan, err := s.fetchRepositoryArchive(ctx, fetchTar, repo, commitID, opts)
 	tr.LazyPrintf("fetch (returned chans)")
 	if err != nil {
 		return err
@@ -72,82 +164,246 @@ func (s *Service) parseUncached(ctx context.Context, repo api.RepoName, commitID
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	dropKinds := kindSet(opts.dropKinds)
+
 	var (
-		mu  sync.Mutex // protects symbols and err
-		wg  sync.WaitGroup
-		sem = make(chan struct{}, runtime.GOMAXPROCS(0))
+		mu       sync.Mutex // protects symbols, err and fatalErr
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, runtime.GOMAXPROCS(0))
+		fatalErr error // an error that aborts the whole parse
 	)
+	// abortErr returns the error that aborted the parse, defaulting to err.
+	abortErr := func(err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fatalErr != nil {
+			return fatalErr
+		}
+		return err
+	}
+
+	batchSize := s.ParseBatchSize
+	if opts.batchSize > 0 {
+		batchSize = opts.batchSize
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	// handleFile calls callback with the symbols of a parsed file, reporting
+	// whether it succeeded.
+	handleFile := func(req parseRequest, entries []ctags.Entry, parseDuration time.Duration, parseErr error) bool {
+		mu.Lock()
+		if parseDuration > slowestDuration {
+			slowestPath, slowestDuration = req.path, parseDuration
+		}
+		mu.Unlock()
+		if parseErr != nil && parseErr != context.Canceled && parseErr != context.DeadlineExceeded {
+			log15.Error("Error parsing symbols.", "repo", repo, "commitID", commitID, "path", req.path, "dataSize", len(req.data), "error", parseErr)
+		}
+		if len(entries) > 0 {
+			lines := newLineIndex(req.data)
+			mu.Lock()
+			for _, e := range entries {
+				if shouldSkipEntry(e) || dropKinds[e.Kind] || req.dropKinds[e.Kind] {
+					continue
+				}
+				totalSymbols++
+				symbol := entryToSymbol(e)
+				symbol.Source = lines.sourceLine(e.Line)
+				err = callback(symbol)
+				if err != nil {
+					log15.Error("Failed to add symbol", "symbol", e, "error", err)
+					mu.Unlock()
+					return false
+				}
+			}
+			mu.Unlock()
+		}
+		// onFile is called once the file's symbols are written, so that
+		// writeAllSymbolsToNewDB can record it as done.
+		if opts.onFile != nil {
+			fp := fileParse{path: req.path, size: len(req.data), symbols: len(entries), duration: parseDuration, err: parseErr}
+			if len(entries) > 0 {
+				fp.language = entries[0].Language
+			}
+			opts.onFile(fp)
+		}
+		return true
+	}
+
 	tr.LazyPrintf("parse")
-	totalParseRequests := 0
-	for req := range parseRequests {
+	files := 0 // including those in opts.skipPaths
+	// accept reports whether req is to be parsed, releasing it if not.
+	accept := func(req parseRequest) bool {
+		if opts.maxFiles > 0 && files >= opts.maxFiles {
+			s.releaseFetchBytes(len(req.data))
+			if opts.onOverLimit != nil {
+				opts.onOverLimit(req.path)
+			}
+			return false
+		}
+		files++
+		if opts.skipPaths[req.path] {
+			s.releaseFetchBytes(len(req.data))
+			return false
+		}
 		totalParseRequests++
+		return true
+	}
+	for req := range parseRequests {
+		if !accept(req) {
+			continue
+		}
+		// Batch the files that are already fetched, without waiting for
+		// more.
+		batch := []parseRequest{req}
+	fill:
+		for len(batch) < batchSize {
+			select {
+			case req, ok := <-parseRequests:
+				if !ok {
+					break fill
+				}
+				if accept(req) {
+					batch = append(batch, req)
+				}
+			default:
+				break fill
+			}
+		}
+
 		if ctx.Err() != nil {
 			// Drain parseRequests
 			go func() {
-				for range parseRequests {
+				for req := range parseRequests {
+					s.releaseFetchBytes(len(req.data))
 				}
 			}()
-			return ctx.Err()
+			for _, req := range batch {
+				s.releaseFetchBytes(len(req.data))
+			}
+			wg.Wait()
+			return abortErr(ctx.Err())
 		}
 		sem <- struct{}{}
 		wg.Add(1)
-		go func(req parseRequest) {
+		go func(batch []parseRequest) {
 			defer func() {
+				for _, req := range batch {
+					s.releaseFetchBytes(len(req.data))
+				}
 				wg.Done()
 				<-sem
 			}()
-			entries, parseErr := s.parse(ctx, req)
-			if parseErr != nil && parseErr != context.Canceled && parseErr != context.DeadlineExceeded {
-				log15.Error("Error parsing symbols.", "repo", repo, "commitID", commitID, "path", req.path, "dataSize", len(req.data), "error", parseErr)
-			}
-			if len(entries) > 0 {
+			entries, parseDuration, parseErr := s.parseBatch(ctx, batch)
+			// The files of a batch share its duration, since how long each
+			// of them took is not known.
+			parseDuration /= time.Duration(len(batch))
+			if parseErr == errParseQueueTimeout {
+				// The service is overloaded, don't keep queueing the rest
+				// of the files.
 				mu.Lock()
-				defer mu.Unlock()
-				for _, e := range entries {
-					if e.Name == "" || strings.HasPrefix(e.Name, "__anon") || strings.HasPrefix(e.Parent, "__anon") || strings.HasPrefix(e.Name, "AnonymousFunction") || strings.HasPrefix(e.Parent, "AnonymousFunction") {
-						continue
-					}
-					totalSymbols++
-					err = callback(entryToSymbol(e))
-					if err != nil {
-						log15.Error("Failed to add symbol", "symbol", e, "error", err)
-						return
-					}
+				if fatalErr == nil {
+					fatalErr = parseErr
 				}
+				mu.Unlock()
+				cancel()
+				return
 			}
-		}(req)
+			for i, req := range batch {
+				var fileEntries []ctags.Entry
+				if entries != nil {
+					fileEntries = entries[i]
+				}
+				if !handleFile(req, fileEntries, parseDuration, parseErr) {
+					return
+				}
+			}
+		}(batch)
 	}
 	wg.Wait()
 	tr.LazyPrintf("parse (done) totalParseRequests=%d symbols=%d", totalParseRequests, totalSymbols)
 
-	return <-errChan
+	return abortErr(<-errChan)
 }
 
+// errParseQueueTimeout is returned when a parse job waited longer than
+// ParseQueueTimeout for a parser.
+var errParseQueueTimeout = errors.New("timed out waiting for a symbols parser")
+
 // parse gets a parser from the pool and uses it to satisfy the parse request.
-func (s *Service) parse(ctx context.Context, req parseRequest) (entries []ctags.Entry, err error) {
-	parseQueueSize.Inc()
+// If MaxConcurrentParses is lower than the number of parsers, it first waits
+// for one of that many parse slots.
+func (s *Service) parse(ctx context.Context, req parseRequest) ([]ctags.Entry, error) {
+	entries, _, err := s.parseBatch(ctx, []parseRequest{req})
+	if entries == nil {
+		return nil, err
+	}
+	return entries[0], err
+}
 
-	select {
-	case <-ctx.Done():
-		parseQueueSize.Dec()
-		if ctx.Err() == context.DeadlineExceeded {
+// parseBatch is like parse, but parses all of reqs with the same parser (see
+// ctags.ParseBatch) and returns the entries of each, in order, and how long the
+// parser took, not counting the wait for it. They count as len(reqs) parse
+// jobs waiting in the queue. If it fails, the entries are nil.
+func (s *Service) parseBatch(ctx context.Context, reqs []parseRequest) (entries [][]ctags.Entry, duration time.Duration, err error) {
+	jobs := len(reqs)
+	parseQueueSize.Add(float64(jobs))
+	atomic.AddInt64(&s.parseQueue.depth, int64(jobs))
+
+	var queueTimeout <-chan time.Time
+	if s.ParseQueueTimeout > 0 {
+		timer := time.NewTimer(s.ParseQueueTimeout)
+		defer timer.Stop()
+		queueTimeout = timer.C
+	}
+
+	// waitFailed ends the wait for a parse slot or a parser without one.
+	waitFailed := func(err error) error {
+		parseQueueSize.Sub(float64(jobs))
+		atomic.AddInt64(&s.parseQueue.depth, -int64(jobs))
+		if err == errParseQueueTimeout || err == context.DeadlineExceeded {
 			parseQueueTimeouts.Inc()
 		}
-		return nil, ctx.Err()
+		return err
+	}
+
+	// The number of concurrent parses may be limited to fewer than the
+	// parsers of the pool.
+	if s.parseSem != nil {
+		select {
+		case <-queueTimeout:
+			return nil, 0, waitFailed(errParseQueueTimeout)
+		case <-ctx.Done():
+			return nil, 0, waitFailed(ctx.Err())
+		case s.parseSem <- struct{}{}:
+			defer func() { <-s.parseSem }()
+		}
+	}
+
+	select {
+	case <-queueTimeout:
+		return nil, 0, waitFailed(errParseQueueTimeout)
+	case <-ctx.Done():
+		return nil, 0, waitFailed(ctx.Err())
 	case parser, ok := <-s.parsers:
-		parseQueueSize.Dec()
+		parseQueueSize.Sub(float64(jobs))
+		atomic.AddInt64(&s.parseQueue.depth, -int64(jobs))
 
 		if !ok {
-			return nil, nil
+			return nil, 0, nil
 		}
 
 		if parser == nil {
 			// The parser failed for some previous receiver (who returned a nil parser to the channel). Try
 			// creating a parser.
 			var err error
-			parser, err = s.NewParser()
+			parser, err = s.spawnParser(ctx)
 			if err != nil {
-				return nil, err
+				// Keep the pool at its size, so that the next receiver tries again.
+				s.parsers <- nil
+				return nil, 0, err
 			}
 		}
 
@@ -163,18 +419,150 @@ func (s *Service) parse(ctx context.Context, req parseRequest) (entries []ctags.
 			} else {
 				// Close parser and return nil to pool, indicating that the next receiver should create a new
 				// parser.
-				log15.Error("Closing failed parser and creating a new one.", "path", req.path, "error", err)
+				log15.Error("Closing failed parser and creating a new one.", "path", reqs[0].path, "files", len(reqs), "error", err)
 				parseFailed.Inc()
+				if errors.Cause(err) == ctags.ErrMemoryLimitExceeded {
+					parserMemoryLimitExceeded.Inc()
+				}
 				parser.Close()
+				s.parserDied()
 				s.parsers <- nil
 			}
 		}()
 		parsing.Inc()
 		defer parsing.Dec()
-		return parser.Parse(req.path, req.data)
+		files := make([]ctags.File, len(reqs))
+		for i, req := range reqs {
+			files[i] = ctags.File{Path: req.path, Content: req.data}
+			if !s.PreserveLineEndings {
+				files[i].Content = normalizeLineEndings(req.data)
+			}
+			if req.language != "" {
+				// ctags detects the language by the file name, so name the
+				// file like a file of the language.
+				files[i].Path += ctags.ExtensionForLanguage(req.language)
+			}
+		}
+		start := time.Now()
+		if len(files) == 1 {
+			var fileEntries []ctags.Entry
+			fileEntries, err = parser.Parse(files[0].Path, files[0].Content)
+			entries = [][]ctags.Entry{fileEntries}
+		} else {
+			entries, err = ctags.ParseBatch(parser, files)
+		}
+		duration = time.Since(start)
+		for i := 0; i < jobs; i++ {
+			s.parseQueue.observe(duration / time.Duration(jobs))
+		}
+		if entries == nil {
+			return nil, duration, err
+		}
+		for i, req := range reqs {
+			if req.language != "" {
+				for j := range entries[i] {
+					entries[i][j].Path = req.path
+				}
+			}
+			sortEntries(entries[i])
+		}
+		return entries, duration, err
 	}
 }
 
+// sortEntries sorts entries by line, then name, then kind. ctags does not
+// order symbols defined on the same line consistently.
+func sortEntries(entries []ctags.Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Kind < b.Kind
+	})
+}
+
+// shouldSkipEntry reports whether e is an anonymous or unnamed symbol, which
+// are not useful to return.
+func shouldSkipEntry(e ctags.Entry) bool {
+	return e.Name == "" || strings.HasPrefix(e.Name, "__anon") || strings.HasPrefix(e.Parent, "__anon") || strings.HasPrefix(e.Name, "AnonymousFunction") || strings.HasPrefix(e.Parent, "AnonymousFunction")
+}
+
+// maxSourceLength is the limit on the length in bytes of a symbol's source
+// snippet.
+const maxSourceLength = 200
+
+// normalizeLineEndings returns data with CRLF and lone CR line endings
+// replaced by LF, and a final LF if it is missing, so that parsers count lines
+// like sourceLine does whatever the line ending style (some ctags parsers
+// don't treat a lone CR as a line ending, or miss a symbol on a last line
+// without one). The line numbers of data are unchanged. data itself is
+// returned if it needs no changes.
+func normalizeLineEndings(data []byte) []byte {
+	if len(data) == 0 || (bytes.IndexByte(data, '\r') < 0 && data[len(data)-1] == '\n') {
+		return data
+	}
+	normalized := make([]byte, 0, len(data)+1)
+	for len(data) > 0 {
+		line, rest := nextLine(data)
+		normalized = append(append(normalized, line...), '\n')
+		data = rest
+	}
+	return normalized
+}
+
+// nextLine splits data after its first line, returning the line without its
+// line ending (LF, CRLF or a lone CR) and the rest of data.
+func nextLine(data []byte) (line, rest []byte) {
+	i := bytes.IndexAny(data, "\r\n")
+	if i < 0 {
+		return data, nil
+	}
+	if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+		return data[:i], data[i+2:]
+	}
+	return data[:i], data[i+1:]
+}
+
+// lineIndex finds the lines of a file by their number, so that the source
+// lines of a file's symbols are found without scanning the file for each.
+type lineIndex struct {
+	data   []byte
+	starts []int // the offset in data of the start of each line
+}
+
+// newLineIndex returns the lineIndex of data. Lines may end with LF, CRLF or
+// a lone CR.
+func newLineIndex(data []byte) *lineIndex {
+	x := &lineIndex{data: data}
+	for rest := data; len(rest) > 0; {
+		x.starts = append(x.starts, len(data)-len(rest))
+		_, rest = nextLine(rest)
+	}
+	return x
+}
+
+// sourceLine returns the 1-indexed line of the file, without surrounding
+// whitespace and truncated to maxSourceLength bytes.
+func (x *lineIndex) sourceLine(line int) string {
+	if line < 1 || line > len(x.starts) {
+		return ""
+	}
+	data, _ := nextLine(x.data[x.starts[line-1]:])
+	data = bytes.TrimSpace(data)
+	if len(data) > maxSourceLength {
+		data = data[:maxSourceLength]
+		// Don't cut a multi-byte character in half.
+		for len(data) > 0 && !utf8.Valid(data) {
+			data = data[:len(data)-1]
+		}
+	}
+	return string(data)
+}
+
 func entryToSymbol(e ctags.Entry) protocol.Symbol {
 	return protocol.Symbol{
 		Name:        e.Name,
@@ -215,6 +603,12 @@ var (
 		Name:      "parse_failed",
 		Help:      "The total number of parse jobs that failed.",
 	})
+	slowParses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "parse",
+		Name:      "slow_parses",
+		Help:      "The total number of repository parses that took longer than the slow parse threshold.",
+	})
 )
 
 func init() {
@@ -222,4 +616,5 @@ func init() {
 	prometheus.MustRegister(parseQueueSize)
 	prometheus.MustRegister(parseQueueTimeouts)
 	prometheus.MustRegister(parseFailed)
+	prometheus.MustRegister(slowParses)
 }
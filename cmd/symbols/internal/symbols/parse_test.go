@@ -0,0 +1,231 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestLineIndex(t *testing.T) {
+	data := []byte("package a\n\n\tfunc F() {}\r\n" + strings.Repeat("é", maxSourceLength))
+	tests := []struct {
+		line int
+		want string
+	}{
+		{line: 0, want: ""},
+		{line: 1, want: "package a"},
+		{line: 2, want: ""},
+		{line: 3, want: "func F() {}"},
+		{line: 4, want: strings.Repeat("é", maxSourceLength/2)},
+		{line: 5, want: ""},
+	}
+	lines := newLineIndex(data)
+	for _, test := range tests {
+		if got := lines.sourceLine(test.line); got != test.want {
+			t.Errorf("line %d: got %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestLineIndex_lineEndings(t *testing.T) {
+	for _, data := range []string{
+		"a\nb\nc",
+		"a\r\nb\r\nc\r\n",
+		"a\rb\rc\r",
+		"a\r\nb\rc\n",
+	} {
+		lines := newLineIndex([]byte(data))
+		for line, want := range []string{"", "a", "b", "c", ""} {
+			if got := lines.sourceLine(line); got != want {
+				t.Errorf("%q line %d: got %q, want %q", data, line, got, want)
+			}
+		}
+	}
+}
+
+func TestNormalizeLineEndings(t *testing.T) {
+	tests := map[string]string{
+		"":                  "",
+		"a\nb\n":            "a\nb\n",
+		"a\nb":              "a\nb\n",
+		"a\r\nb\r\n":        "a\nb\n",
+		"a\rb":              "a\nb\n",
+		"a\r\n\r\nb\r\r\nc": "a\n\nb\n\nc\n",
+	}
+	for data, want := range tests {
+		if got := string(normalizeLineEndings([]byte(data))); got != want {
+			t.Errorf("%q: got %q, want %q", data, got, want)
+		}
+	}
+}
+
+func TestService_lineEndings(t *testing.T) {
+	// The parser counts lines by LF only and finds "func" declarations, like
+	// ctags parsers that don't know about other line endings.
+	parser := parserFunc(func(name string, content []byte) ([]ctags.Entry, error) {
+		var entries []ctags.Entry
+		for i, line := range strings.Split(string(content), "\n") {
+			if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "func" {
+				entries = append(entries, ctags.Entry{Name: strings.TrimSuffix(fields[1], "()"), Path: name, Line: i + 1})
+			}
+		}
+		return entries, nil
+	})
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{
+				"crlf.go":       "package a\r\n\r\nfunc crlf() {}\r\n",
+				"cr.go":         "package a\r\rfunc cr() {}\r",
+				"noeol.go":      "package a\n\nfunc noEOL() {}",
+				"mixed.go":      "package a\r\n\rfunc mixed() {}\n",
+				"trailingcr.go": "package a\n\nfunc trailingCR() {}\r\n",
+			})
+		},
+		NewParser: func() (ctags.Parser, error) { return parser, nil },
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10, IncludeSource: true})
+	defer resp.Body.Close()
+	var result protocol.SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Symbols) != 5 {
+		t.Fatalf("got symbols %+v, want 5", result.Symbols)
+	}
+	for _, symbol := range result.Symbols {
+		if want := "func " + symbol.Name + "() {}"; symbol.Line != 3 || symbol.Source != want {
+			t.Errorf("%s: got line %d with source %q, want line 3 with source %q", symbol.Path, symbol.Line, symbol.Source, want)
+		}
+	}
+}
+
+// batchParser is a ctags.BatchParser returning an entry named like each file,
+// recording the size of each batch.
+type batchParser struct {
+	mu      sync.Mutex
+	batches []int
+}
+
+func (p *batchParser) Parse(name string, content []byte) ([]ctags.Entry, error) {
+	entries, err := p.ParseBatch([]ctags.File{{Path: name, Content: content}})
+	return entries[0], err
+}
+
+func (p *batchParser) ParseBatch(files []ctags.File) ([][]ctags.Entry, error) {
+	time.Sleep(10 * time.Millisecond) // let the fetch get ahead
+	p.mu.Lock()
+	p.batches = append(p.batches, len(files))
+	p.mu.Unlock()
+	entries := make([][]ctags.Entry, len(files))
+	for i, f := range files {
+		entries[i] = []ctags.Entry{{Name: path.Base(f.Path), Path: f.Path, Line: 1}}
+	}
+	return entries, nil
+}
+
+func (p *batchParser) Close() {}
+
+func TestService_parseBatchSize(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 40; i++ {
+		files[fmt.Sprintf("f%d.go", i)] = "package a"
+	}
+	parser := &batchParser{}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(files)
+		},
+		NewParser:          func() (ctags.Parser, error) { return parser, nil },
+		NumParserProcesses: 4,
+		ParseBatchSize:     8,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", First: 100})
+	defer resp.Body.Close()
+	var result protocol.SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Symbols) != len(files) {
+		t.Fatalf("got %d symbols, want one for each of the %d files", len(result.Symbols), len(files))
+	}
+	for _, symbol := range result.Symbols {
+		if symbol.Name != symbol.Path {
+			t.Errorf("got symbol %s of %s, want the files' symbols to stay with their files", symbol.Name, symbol.Path)
+		}
+	}
+
+	parser.mu.Lock()
+	defer parser.mu.Unlock()
+	largest := 0
+	for _, n := range parser.batches {
+		if n > largest {
+			largest = n
+		}
+	}
+	if largest < 2 || largest > 8 {
+		t.Errorf("got batches of %v files, want batches of up to 8 files", parser.batches)
+	}
+}
+
+func TestParseDuration_excludesQueueWait(t *testing.T) {
+	// Parse several files at once, so that they queue for the one parser.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	const parseTime = 20 * time.Millisecond
+	files := map[string]string{}
+	for i := 0; i < 8; i++ {
+		files[fmt.Sprintf("%d.go", i)] = "x"
+	}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(files)
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return parserFunc(func(name string, content []byte) ([]ctags.Entry, error) {
+				time.Sleep(parseTime)
+				return nil, nil
+			}), nil
+		},
+		NumParserProcesses: 1,
+	}
+	_, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	var (
+		mu    sync.Mutex
+		total time.Duration
+	)
+	err := service.parseUncached(context.Background(), "r", "c", parseOptions{
+		onFile: func(fp fileParse) {
+			mu.Lock()
+			total += fp.duration
+			mu.Unlock()
+		},
+	}, func(protocol.Symbol) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Counting the wait for the parser, the files would take about
+	// (1+2+...+8)*parseTime = 36*parseTime.
+	if max := time.Duration(len(files)) * parseTime * 5 / 2; total > max {
+		t.Errorf("got a total parse time of %s, want at most %s", total, max)
+	}
+}
@@ -0,0 +1,295 @@
+package symbols
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-diff/diff"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+// maxPatchFiles is the maximum number of files a patch sent to the patch
+// endpoint may change.
+const maxPatchFiles = 1000
+
+// patchConflictError is returned when a patch does not apply cleanly to the
+// base commit.
+type patchConflictError struct {
+	path   string
+	hunk   int // 1-indexed
+	reason string
+}
+
+func (e *patchConflictError) Error() string {
+	return fmt.Sprintf("patch does not apply to %s: hunk %d: %s", e.path, e.hunk, e.reason)
+}
+
+// handlePatch returns the symbols of the files resulting from applying a
+// unified diff to a base commit. Files deleted by the patch are omitted.
+func (s *Service) handlePatch(w http.ResponseWriter, r *http.Request) {
+	var args protocol.PatchArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.FetchFile == nil {
+		http.Error(w, "fetching files is not supported", http.StatusNotImplemented)
+		return
+	}
+	fileDiffs, err := diff.ParseMultiFileDiff([]byte(args.Patch))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid patch: %s", err), http.StatusBadRequest)
+		return
+	}
+	if len(fileDiffs) > maxPatchFiles {
+		http.Error(w, fmt.Sprintf("patch changes too many files (maximum is %d)", maxPatchFiles), http.StatusBadRequest)
+		return
+	}
+
+	accessLog := accessLogFromContext(r.Context())
+	accessLog.Repo, accessLog.CommitID = args.Repo, args.CommitID
+
+	if !s.checkRepoAccess(w, r, args.Repo) {
+		return
+	}
+	release, ok := s.acquireCommitRequest(w, args.Repo, args.CommitID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// The patched files are always parsed, as they aren't in any commit.
+	if s.rejectIfSaturated(w) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var (
+		result   protocol.PatchResult
+		files    = make([]*protocol.FileSymbols, len(fileDiffs))
+		mem      = s.newRequestMemory(ctx)
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, s.parseConcurrency())
+	)
+	for i, fd := range fileDiffs {
+		if diffPath(fd.NewName) == "" {
+			continue // deleted
+		}
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int, fd *diff.FileDiff) {
+			defer func() {
+				wg.Done()
+				<-sem
+			}()
+			symbols, err := s.parsePatchedFile(ctx, args.Repo, args.CommitID, fd)
+			if err == nil {
+				err = mem.add(symbols...)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				exceeded := isMemoryExceeded(err)
+				if firstErr == nil || exceeded {
+					firstErr = err
+				}
+				if exceeded {
+					cancel() // stop parsing the remaining files
+				}
+				return
+			}
+			files[i] = &protocol.FileSymbols{Path: diffPath(fd.NewName), Symbols: symbols}
+		}(i, fd)
+	}
+	wg.Wait()
+
+	if err := r.Context().Err(); err != nil {
+		return // client went away
+	}
+	if firstErr != nil {
+		if _, ok := errors.Cause(firstErr).(*patchConflictError); ok {
+			http.Error(w, firstErr.Error(), http.StatusConflict)
+			return
+		}
+		if isMemoryExceeded(firstErr) {
+			http.Error(w, firstErr.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, firstErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, f := range files {
+		if f != nil {
+			result.Files = append(result.Files, *f)
+			accessLog.Symbols += len(f.Symbols)
+		}
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parsePatchedFile applies fd to its file in repo@commitID and returns the
+// symbols of the result.
+func (s *Service) parsePatchedFile(ctx context.Context, repo api.RepoName, commitID api.CommitID, fd *diff.FileDiff) ([]protocol.Symbol, error) {
+	var base []byte
+	if origPath := diffPath(fd.OrigName); origPath != "" {
+		var err error
+		base, err = s.readBaseFile(ctx, repo, commitID, origPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", origPath)
+		}
+	}
+
+	newPath := diffPath(fd.NewName)
+	data, err := applyHunks(base, fd.Hunks)
+	if err != nil {
+		err.path = newPath
+		return nil, err
+	}
+	if len(data) > maxFileSize || isBinary(data) {
+		return nil, nil
+	}
+
+	entries, parseErr := s.parse(ctx, parseRequest{path: newPath, data: data})
+	if parseErr != nil {
+		return nil, errors.Wrapf(parseErr, "parsing %s", newPath)
+	}
+	var (
+		symbols []protocol.Symbol
+		drop    = kindSet(s.dropKinds(nil))
+	)
+	for _, e := range entries {
+		if !shouldSkipEntry(e) && !drop[e.Kind] {
+			symbols = append(symbols, entryToSymbol(e))
+		}
+	}
+	return symbols, nil
+}
+
+// readBaseFile returns the contents of the file at filePath in
+// repo@commitID. Since the contents at a commit never change they are cached,
+// so that repeated patches against the same base don't fetch them again.
+func (s *Service) readBaseFile(ctx context.Context, repo api.RepoName, commitID api.CommitID, filePath string) ([]byte, error) {
+	key := fmt.Sprintf("file-%d-%s@%s-%s", symbolsDBVersion, repo, commitID, filePath)
+	f, err := s.cache.Open(ctx, key, func(ctx context.Context) (io.ReadCloser, error) {
+		rc, err := s.FetchFile(ctx, gitserver.Repo{Name: repo}, commitID, filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		// Only read up to the limit; larger files aren't parsed anyway.
+		data, err := ioutil.ReadAll(io.LimitReader(rc, maxFileSize+1))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f.File)
+}
+
+// diffPath returns the path of a file named in a diff header, without the
+// "a/" or "b/" prefix. It returns "" for /dev/null, i.e. a file that is
+// created or deleted.
+func diffPath(name string) string {
+	if name == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(name, "a/") || strings.HasPrefix(name, "b/") {
+		return name[2:]
+	}
+	return name
+}
+
+// applyHunks applies hunks to base. Every context and removed line of a hunk
+// must match base exactly; otherwise a *patchConflictError (without a path) is
+// returned.
+func applyHunks(base []byte, hunks []*diff.Hunk) ([]byte, *patchConflictError) {
+	lines := splitLines(base)
+
+	var (
+		out bytes.Buffer
+		pos int // index in lines of the next line to copy
+	)
+	for i, h := range hunks {
+		conflict := func(format string, args ...interface{}) *patchConflictError {
+			return &patchConflictError{hunk: i + 1, reason: fmt.Sprintf(format, args...)}
+		}
+
+		// OrigStartLine is 1-indexed, except that a hunk that only adds
+		// lines starts after the line it is at.
+		start := int(h.OrigStartLine) - 1
+		if h.OrigLines == 0 {
+			start = int(h.OrigStartLine)
+		}
+		if start < pos || start > len(lines) {
+			return nil, conflict("starts at line %d, which is out of range", h.OrigStartLine)
+		}
+		for _, line := range lines[pos:start] {
+			out.Write(line)
+		}
+		pos = start
+
+		for _, line := range splitLines(h.Body) {
+			if len(line) == 0 {
+				continue
+			}
+			switch line[0] {
+			case ' ', '-':
+				if pos >= len(lines) {
+					return nil, conflict("expected line %d to exist", pos+1)
+				}
+				if !bytes.Equal(bytes.TrimSuffix(lines[pos], []byte("\n")), bytes.TrimSuffix(line[1:], []byte("\n"))) {
+					return nil, conflict("line %d does not match", pos+1)
+				}
+				if line[0] == ' ' {
+					out.Write(line[1:])
+				}
+				pos++
+			case '+':
+				out.Write(line[1:])
+			default:
+				return nil, conflict("unexpected line %q", line)
+			}
+		}
+	}
+	for _, line := range lines[pos:] {
+		out.Write(line)
+	}
+	return out.Bytes(), nil
+}
+
+// splitLines splits data into lines, each including its trailing newline
+// (except possibly the last).
+func splitLines(data []byte) [][]byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,156 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestApplyHunks(t *testing.T) {
+	tests := map[string]struct {
+		base, patch, want string
+		wantErr           bool
+	}{
+		"modify": {
+			base: "a\nb\nc\n",
+			patch: `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ a
+-b
++x
+ c
+`,
+			want: "a\nx\nc\n",
+		},
+		"insert at start": {
+			base: "a\n",
+			patch: `--- a/f
++++ b/f
+@@ -0,0 +1 @@
++x
+`,
+			want: "x\na\n",
+		},
+		"no newline at end": {
+			base: "a\nb",
+			patch: `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++c
+\ No newline at end of file
+`,
+			want: "a\nc",
+		},
+		"create": {
+			patch: `--- /dev/null
++++ b/f
+@@ -0,0 +1,2 @@
++a
++b
+`,
+			want: "a\nb\n",
+		},
+		"conflict": {
+			base: "a\nb\nc\n",
+			patch: `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ a
+-y
++x
+ c
+`,
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fd, err := diff.ParseFileDiff([]byte(test.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, conflict := applyHunks([]byte(test.base), fd.Hunks)
+			if test.wantErr {
+				if conflict == nil {
+					t.Fatalf("expected conflict, got %q", got)
+				}
+				return
+			}
+			if conflict != nil {
+				t.Fatal(conflict)
+			}
+			if string(got) != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestService_patch(t *testing.T) {
+	service := &Service{
+		FetchFile: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, path string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("var x = 1\n")), nil
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x"}, nil
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	post := func(patch string) *http.Response {
+		return postJSON(t, server.URL+"/patch", protocol.PatchArgs{Repo: "r", CommitID: "c", Patch: patch})
+	}
+
+	resp := post(`diff --git a/a.js b/a.js
+--- a/a.js
++++ b/a.js
+@@ -1 +1 @@
+-var x = 1
++var x = 2
+diff --git a/b.js b/b.js
+deleted file mode 100644
+--- a/b.js
++++ /dev/null
+@@ -1 +0,0 @@
+-var x = 1
+`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+	var result protocol.PatchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	want := protocol.PatchResult{Files: []protocol.FileSymbols{{Path: "a.js", Symbols: []protocol.Symbol{{Name: "x", Path: "a.js"}}}}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %+v, want %+v", result, want)
+	}
+
+	conflict := post(`--- a/a.js
++++ b/a.js
+@@ -1 +1 @@
+-var y = 1
++var y = 2
+`)
+	conflict.Body.Close()
+	if conflict.StatusCode != http.StatusConflict {
+		t.Errorf("got status %d for a patch that doesn't apply, want %d", conflict.StatusCode, http.StatusConflict)
+	}
+}
@@ -0,0 +1,202 @@
+package symbols
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/debugserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+// parseProfileSizeBuckets are the upper bounds (exclusive) of the file size
+// buckets in a parse profile. Files at least as large as the last bound are
+// put in a final bucket.
+var parseProfileSizeBuckets = []struct {
+	name  string
+	limit int
+}{
+	{"<1KB", 1 << 10},
+	{"1KB-10KB", 10 << 10},
+	{"10KB-100KB", 100 << 10},
+	{">=100KB", maxFileSize + 1},
+}
+
+// maxParseProfileSlowestFiles is the number of slowest files listed in a
+// parse profile.
+const maxParseProfileSlowestFiles = 20
+
+// parseProfile is a breakdown of where the time parsing a commit went.
+type parseProfile struct {
+	Repo     api.RepoName
+	CommitID api.CommitID
+
+	Files       int
+	Symbols     int
+	WallTimeMS  float64 // time taken for the whole parse
+	ParseTimeMS float64 // sum of the time a parser took on each file
+
+	Languages    []*parseProfileBucket
+	SizeBuckets  []*parseProfileBucket
+	SlowestFiles []parseProfileFile
+}
+
+// parseProfileBucket is the parse time of a group of files.
+type parseProfileBucket struct {
+	Name        string
+	Files       int
+	Bytes       int64
+	Symbols     int
+	ParseTimeMS float64
+	Percent     float64 // percentage of the total parse time
+}
+
+type parseProfileFile struct {
+	Path        string
+	Size        int
+	Language    string
+	Symbols     int
+	ParseTimeMS float64
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// DebugEndpoints returns the endpoints the service adds to the debug server.
+func (s *Service) DebugEndpoints() []debugserver.Endpoint {
+	return []debugserver.Endpoint{
+		{
+			Name:    "Parse profile",
+			Path:    "/parse-profile",
+			Handler: http.HandlerFunc(s.handleParseProfile),
+		},
+		{
+			Name:    "Parse coverage",
+			Path:    "/parse-coverage",
+			Handler: http.HandlerFunc(s.handleParseCoverage),
+		},
+		{
+			Name:    "Benchmark",
+			Path:    "/benchmark",
+			Handler: http.HandlerFunc(s.handleBenchmark),
+		},
+	}
+}
+
+// handleParseProfile parses the commit given by the repo and commit query
+// parameters (bypassing the cache) and responds with a breakdown of the parse
+// time per language and per file size.
+func (s *Service) handleParseProfile(w http.ResponseWriter, r *http.Request) {
+	repo, commitID := api.RepoName(r.URL.Query().Get("repo")), api.CommitID(r.URL.Query().Get("commit"))
+	if repo == "" || commitID == "" {
+		http.Error(w, "repo and commit query parameters are required", http.StatusBadRequest)
+		return
+	}
+	if !s.checkRepoAccess(w, r, repo) {
+		return
+	}
+
+	var (
+		mu    sync.Mutex
+		files []fileParse
+	)
+	start := time.Now()
+	err := s.parseUncached(r.Context(), repo, commitID, parseOptions{
+		onFile: func(fp fileParse) {
+			mu.Lock()
+			files = append(files, fp)
+			mu.Unlock()
+		},
+	}, func(protocol.Symbol) error { return nil })
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	profile := newParseProfile(files)
+	profile.Repo = repo
+	profile.CommitID = commitID
+	profile.WallTimeMS = milliseconds(time.Since(start))
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(profile); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func newParseProfile(files []fileParse) *parseProfile {
+	profile := &parseProfile{Files: len(files)}
+
+	var total time.Duration
+	for _, f := range files {
+		total += f.duration
+		profile.Symbols += f.symbols
+	}
+	profile.ParseTimeMS = milliseconds(total)
+
+	languages := map[string]*parseProfileBucket{}
+	sizes := make([]*parseProfileBucket, len(parseProfileSizeBuckets))
+	for i, b := range parseProfileSizeBuckets {
+		sizes[i] = &parseProfileBucket{Name: b.name}
+	}
+	add := func(b *parseProfileBucket, f fileParse) {
+		b.Files++
+		b.Bytes += int64(f.size)
+		b.Symbols += f.symbols
+		b.ParseTimeMS += milliseconds(f.duration)
+	}
+	for _, f := range files {
+		language := f.language
+		if language == "" {
+			language = "unknown (" + path.Ext(f.path) + ")"
+		}
+		if languages[language] == nil {
+			languages[language] = &parseProfileBucket{Name: language}
+		}
+		add(languages[language], f)
+
+		for i, b := range parseProfileSizeBuckets {
+			if f.size < b.limit || i == len(parseProfileSizeBuckets)-1 {
+				add(sizes[i], f)
+				break
+			}
+		}
+	}
+
+	for _, b := range languages {
+		profile.Languages = append(profile.Languages, b)
+	}
+	sort.Slice(profile.Languages, func(i, j int) bool {
+		return profile.Languages[i].ParseTimeMS > profile.Languages[j].ParseTimeMS
+	})
+	profile.SizeBuckets = sizes
+	for _, b := range append(profile.Languages, profile.SizeBuckets...) {
+		if profile.ParseTimeMS > 0 {
+			b.Percent = 100 * b.ParseTimeMS / profile.ParseTimeMS
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].duration > files[j].duration })
+	if len(files) > maxParseProfileSlowestFiles {
+		files = files[:maxParseProfileSlowestFiles]
+	}
+	for _, f := range files {
+		profile.SlowestFiles = append(profile.SlowestFiles, parseProfileFile{
+			Path:        f.path,
+			Size:        f.size,
+			Language:    f.language,
+			Symbols:     f.symbols,
+			ParseTimeMS: milliseconds(f.duration),
+		})
+	}
+
+	return profile
+}
@@ -0,0 +1,90 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+)
+
+func TestNewParseProfile(t *testing.T) {
+	profile := newParseProfile([]fileParse{
+		{path: "a.go", size: 100, language: "Go", symbols: 2, duration: 1 * time.Millisecond},
+		{path: "b.go", size: 20 << 10, language: "Go", symbols: 3, duration: 2 * time.Millisecond},
+		{path: "c.js", size: 200 << 10, language: "JavaScript", symbols: 5, duration: 5 * time.Millisecond},
+		{path: "d.txt", size: 10, duration: 2 * time.Millisecond},
+	})
+
+	if profile.Files != 4 || profile.Symbols != 10 || profile.ParseTimeMS != 10 {
+		t.Errorf("got totals files=%d symbols=%d parseTimeMS=%v", profile.Files, profile.Symbols, profile.ParseTimeMS)
+	}
+
+	var languages []string
+	for _, b := range profile.Languages {
+		languages = append(languages, b.Name)
+	}
+	if got, want := languages[0], "JavaScript"; got != want {
+		t.Errorf("got slowest language %q, want %q", got, want)
+	}
+	if got, want := profile.Languages[0].Percent, 50.0; got != want {
+		t.Errorf("got JavaScript percent %v, want %v", got, want)
+	}
+
+	wantFiles := map[string]int{"<1KB": 2, "1KB-10KB": 0, "10KB-100KB": 1, ">=100KB": 1}
+	for _, b := range profile.SizeBuckets {
+		if b.Files != wantFiles[b.Name] {
+			t.Errorf("got %d files in size bucket %s, want %d", b.Files, b.Name, wantFiles[b.Name])
+		}
+	}
+
+	if got, want := profile.SlowestFiles[0].Path, "c.js"; got != want {
+		t.Errorf("got slowest file %q, want %q", got, want)
+	}
+}
+
+func TestService_parseProfileExcludesQueueWait(t *testing.T) {
+	// Parse several files at once, so that they queue for the one parser.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	files := map[string]string{}
+	for i := 0; i < 8; i++ {
+		files[fmt.Sprintf("%d.go", i)] = "x"
+	}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(files)
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return parserFunc(func(name string, content []byte) ([]ctags.Entry, error) {
+				time.Sleep(20 * time.Millisecond)
+				return nil, nil
+			}), nil
+		},
+		NumParserProcesses: 1,
+	}
+	_, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	service.handleParseProfile(w, httptest.NewRequest("GET", "/parse-profile?repo=r&commit=c", nil))
+	if w.Code != 200 {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	var profile parseProfile
+	if err := json.NewDecoder(w.Body).Decode(&profile); err != nil {
+		t.Fatal(err)
+	}
+	// With one parser, the files can't have taken longer to parse than the
+	// whole parse, unless their waits for the parser are counted.
+	if profile.Files != len(files) || profile.ParseTimeMS > profile.WallTimeMS {
+		t.Errorf("got files=%d parseTimeMS=%v wallTimeMS=%v, want files=%d and parseTimeMS at most wallTimeMS", profile.Files, profile.ParseTimeMS, profile.WallTimeMS, len(files))
+	}
+}
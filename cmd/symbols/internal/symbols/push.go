@@ -0,0 +1,116 @@
+package symbols
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+// pendingPush is a push notification waiting out the debounce delay.
+type pendingPush struct {
+	commitID api.CommitID
+	timer    *time.Timer
+}
+
+// pushes debounces push notifications per repository, so that a burst of
+// pushes to the same repository only parses its newest commit.
+type pushes struct {
+	mu      sync.Mutex
+	pending map[api.RepoName]*pendingPush
+}
+
+// handlePush accepts a notification that a repository has a new commit and
+// parses the commit in the background, like an asynchronous search. The parse
+// starts once no further notification for the repository has arrived for
+// PushDebounce; only the newest commit is then parsed.
+func (s *Service) handlePush(w http.ResponseWriter, r *http.Request) {
+	var args protocol.PushArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if args.Repo == "" || args.CommitID == "" {
+		http.Error(w, "repo and commitID are required", http.StatusBadRequest)
+		return
+	}
+
+	accessLog := accessLogFromContext(r.Context())
+	accessLog.Repo, accessLog.CommitID = args.Repo, args.CommitID
+
+	if !s.checkRepoAccess(w, r, args.Repo) {
+		return
+	}
+
+	cached := s.cache.Exists(s.searchCacheKey(protocol.SearchArgs{Repo: args.Repo, CommitID: args.CommitID}))
+	accessLog.setCacheHit(cached)
+	if cached {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if s.rejectIfSaturated(w) {
+		return
+	}
+
+	s.schedulePush(args.Repo, args.CommitID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// schedulePush starts a warm job for repo@commitID after PushDebounce,
+// replacing any notification for repo that is still waiting.
+func (s *Service) schedulePush(repo api.RepoName, commitID api.CommitID) {
+	pushNotifications.Inc()
+
+	s.pushes.mu.Lock()
+	defer s.pushes.mu.Unlock()
+	if s.pushes.pending == nil {
+		s.pushes.pending = map[api.RepoName]*pendingPush{}
+	}
+	if p, ok := s.pushes.pending[repo]; ok {
+		if p.timer.Stop() {
+			// The earlier notification is dropped in favor of this one.
+			pushNotificationsDebounced.Inc()
+			p.commitID = commitID
+			p.timer.Reset(s.PushDebounce)
+			return
+		}
+		// The timer already fired; the earlier commit is being parsed.
+	}
+
+	p := &pendingPush{commitID: commitID}
+	p.timer = time.AfterFunc(s.PushDebounce, func() {
+		s.pushes.mu.Lock()
+		commitID := p.commitID
+		if s.pushes.pending[repo] == p {
+			delete(s.pushes.pending, repo)
+		}
+		s.pushes.mu.Unlock()
+
+		s.startWarmJob(protocol.SearchArgs{Repo: repo, CommitID: commitID})
+	})
+	s.pushes.pending[repo] = p
+}
+
+var (
+	pushNotifications = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "push",
+		Name:      "notifications",
+		Help:      "The total number of push notifications of uncached commits received.",
+	})
+	pushNotificationsDebounced = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "push",
+		Name:      "notifications_debounced",
+		Help:      "The total number of push notifications superseded by a later one for the same repository.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(pushNotifications)
+	prometheus.MustRegister(pushNotificationsDebounced)
+}
@@ -0,0 +1,74 @@
+package symbols
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_push(t *testing.T) {
+	fetched := make(chan api.CommitID, 10)
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			fetched <- commit
+			return createTar(map[string]string{"a.js": "var x = 1"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x"}, nil
+		},
+		PushDebounce: 50 * time.Millisecond,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	push := func(commitID api.CommitID) int {
+		resp := postJSON(t, server.URL+"/push", protocol.PushArgs{Repo: "r", CommitID: commitID})
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Rapid pushes to the same repository only parse the newest commit.
+	for _, commitID := range []api.CommitID{"c1", "c2"} {
+		if status := push(commitID); status != http.StatusAccepted {
+			t.Fatalf("got status %d for push of %s, want %d", status, commitID, http.StatusAccepted)
+		}
+	}
+	select {
+	case commitID := <-fetched:
+		if commitID != "c2" {
+			t.Errorf("got fetch of %s, want c2", commitID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the pushed commit to be fetched")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !service.cache.Exists(service.cacheKey("r", "c2", nil)) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the pushed commit to be cached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := push("c2"); status != http.StatusOK {
+		t.Errorf("got status %d for push of a cached commit, want %d", status, http.StatusOK)
+	}
+
+	select {
+	case commitID := <-fetched:
+		t.Errorf("unexpected fetch of %s", commitID)
+	case <-time.After(2 * service.PushDebounce):
+	}
+
+	resp := postJSON(t, server.URL+"/push", protocol.PushArgs{Repo: "r"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for push without a commit, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,90 @@
+package symbols
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// handleRange returns the symbols defined in a range of lines of a file, such
+// as the part of the file visible in an editor. It responds with a
+// protocol.SearchResult.
+func (s *Service) handleRange(w http.ResponseWriter, r *http.Request) {
+	var args protocol.RangeArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if args.Path == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+	if args.StartLine < 1 || args.StartLine > args.EndLine {
+		http.Error(w, "startLine must be at least 1 and at most endLine", http.StatusBadRequest)
+		return
+	}
+
+	accessLog := accessLogFromContext(r.Context())
+	accessLog.Repo, accessLog.CommitID = args.Repo, args.CommitID
+
+	if !s.checkRepoAccess(w, r, args.Repo) {
+		return
+	}
+	release, ok := s.acquireCommitRequest(w, args.Repo, args.CommitID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	searchArgs := protocol.SearchArgs{Repo: args.Repo, CommitID: args.CommitID, IncludeKinds: args.IncludeKinds}
+	cached := s.cache.Exists(s.searchCacheKey(searchArgs))
+	accessLog.setCacheHit(cached)
+	if !cached && s.rejectIfSaturated(w) {
+		return
+	}
+
+	db, err := s.openDB(r.Context(), searchArgs)
+	if err != nil {
+		writeSearchError(w, r, searchArgs, err)
+		return
+	}
+	defer db.Close()
+
+	var exists int
+	err = db.QueryRowContext(r.Context(), `SELECT 1 FROM files WHERE path = ?`, args.Path).Scan(&exists)
+	if err == sql.ErrNoRows {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeSearchError(w, r, searchArgs, err)
+		return
+	}
+
+	var rows []symbolInDB
+	err = db.SelectContext(r.Context(), &rows,
+		`SELECT * FROM symbols WHERE path = ? AND line >= ? AND line <= ? ORDER BY line, name, kind`,
+		args.Path, args.StartLine, args.EndLine)
+	if err != nil {
+		writeSearchError(w, r, searchArgs, err)
+		return
+	}
+
+	var result protocol.SearchResult
+	for _, row := range rows {
+		symbol := symbolInDBToSymbol(row)
+		if !args.IncludeSource {
+			symbol.Source = ""
+		}
+		result.Symbols = append(result.Symbols, symbol)
+	}
+	accessLog.Symbols = len(result.Symbols)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log15.Error("Failed to write symbol range response", "error", err)
+	}
+}
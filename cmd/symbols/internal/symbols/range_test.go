@@ -0,0 +1,74 @@
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_range(t *testing.T) {
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.go": "package a", "empty.go": "package empty"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return parserFunc(func(name string, content []byte) ([]ctags.Entry, error) {
+				if name == "empty.go" {
+					return nil, nil
+				}
+				return []ctags.Entry{
+					{Name: "a", Path: name, Line: 1},
+					{Name: "b", Path: name, Line: 5},
+					{Name: "c", Path: name, Line: 10},
+				}, nil
+			}), nil
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	get := func(path string, start, end int) (int, []protocol.Symbol) {
+		resp := postJSON(t, server.URL+"/range", protocol.RangeArgs{Repo: "r", CommitID: "c", Path: path, StartLine: start, EndLine: end})
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, nil
+		}
+		var result protocol.SearchResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, result.Symbols
+	}
+
+	for _, test := range []struct {
+		path       string
+		start, end int
+		status     int
+		want       []string
+	}{
+		{path: "a.go", start: 1, end: 10, status: http.StatusOK, want: []string{"a", "b", "c"}},
+		{path: "a.go", start: 2, end: 5, status: http.StatusOK, want: []string{"b"}},
+		{path: "a.go", start: 6, end: 9, status: http.StatusOK},
+		{path: "empty.go", start: 1, end: 1, status: http.StatusOK},
+		{path: "missing.go", start: 1, end: 1, status: http.StatusNotFound},
+		{path: "a.go", start: 5, end: 4, status: http.StatusBadRequest},
+		{path: "a.go", start: 0, end: 4, status: http.StatusBadRequest},
+	} {
+		status, symbols := get(test.path, test.start, test.end)
+		var names []string
+		for _, s := range symbols {
+			names = append(names, s.Name)
+		}
+		if status != test.status || !reflect.DeepEqual(names, test.want) {
+			t.Errorf("%s lines %d-%d: got status %d and symbols %v, want %d and %v", test.path, test.start, test.end, status, names, test.status, test.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package symbols
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// repoConfigPath is the path of the optional file in which a repository tunes
+// how its symbols are parsed (see repoConfig).
+const repoConfigPath = ".sourcegraph/symbols.yaml"
+
+// maxRepoConfigSize is the limit on the size of a repository's configuration
+// file; larger files are ignored.
+const maxRepoConfigSize = 64 * 1024
+
+// repoConfig is the configuration a repository may provide in repoConfigPath.
+// It is applied on top of the service's configuration, for example:
+//
+//	exclude: [testdata/*, "*.snap"]
+//	languages: {.tmpl: Go}
+//	dropKinds: [local]
+type repoConfig struct {
+	// Exclude are file name patterns (as in Service.GeneratedFilePatterns) of
+	// files not to parse.
+	Exclude []string `yaml:"exclude"`
+
+	// Languages maps file extensions (such as ".tmpl") to the language to
+	// parse files with that extension as, overriding the detected language.
+	Languages map[string]string `yaml:"languages"`
+
+	// DropKinds are kinds of symbols to leave out, in addition to
+	// Service.DropKinds.
+	DropKinds []string `yaml:"dropKinds"`
+
+	dropKinds map[string]bool
+}
+
+// parseRepoConfig parses and validates the contents of a repository's
+// configuration file.
+func parseRepoConfig(data []byte) (*repoConfig, error) {
+	var c repoConfig
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, err
+	}
+	for _, p := range c.Exclude {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid exclude pattern %q", p)
+		}
+	}
+	languages := make(map[string]string, len(c.Languages))
+	for ext, language := range c.Languages {
+		if !strings.HasPrefix(ext, ".") {
+			return nil, errors.Errorf("invalid extension %q (must start with a dot)", ext)
+		}
+		if ctags.ExtensionForLanguage(language) == "" {
+			return nil, errors.Errorf("unsupported language %q for %s", language, ext)
+		}
+		languages[strings.ToLower(ext)] = language
+	}
+	c.Languages = languages
+	c.dropKinds = kindSet(c.DropKinds)
+	return &c, nil
+}
+
+// apply applies the configuration to a file of the repository. It returns
+// false if the file should not be parsed. A nil *repoConfig applies nothing.
+func (c *repoConfig) apply(req *parseRequest) bool {
+	if c == nil {
+		return true
+	}
+	if matchesAny(c.Exclude, req.path) {
+		repoConfigExcludedFiles.Inc()
+		return false
+	}
+	req.language = c.Languages[strings.ToLower(path.Ext(req.path))]
+	req.dropKinds = c.dropKinds
+	return true
+}
+
+var repoConfigExcludedFiles = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "symbols",
+	Subsystem: "store",
+	Name:      "repo_config_excluded_files",
+	Help:      "The total number of files not parsed because a repository's " + repoConfigPath + " excludes them.",
+})
+
+func init() {
+	prometheus.MustRegister(repoConfigExcludedFiles)
+}
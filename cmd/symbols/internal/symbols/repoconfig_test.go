@@ -0,0 +1,96 @@
+package symbols
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags/ctagstest"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestParseRepoConfig(t *testing.T) {
+	c, err := parseRepoConfig([]byte("exclude: [testdata/*]\nlanguages: {.TMPL: go}\ndropKinds: [local]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{".tmpl": "go"}; !reflect.DeepEqual(c.Languages, want) {
+		t.Errorf("got languages %v, want %v", c.Languages, want)
+	}
+
+	for _, invalid := range []string{
+		"exclude: ['[']",
+		"languages: {tmpl: Go}",
+		"languages: {.tmpl: NoSuchLanguage}",
+		"excludes: [a]",
+	} {
+		if _, err := parseRepoConfig([]byte(invalid)); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestService_repoConfig(t *testing.T) {
+	// Archives list files in path order.
+	files := [][2]string{
+		{".a.snap", "x"},
+		{".babelrc.js", "x"},
+		{repoConfigPath, "exclude: ['*.snap', testdata/*]\nlanguages: {.tmpl: Go}\ndropKinds: [local]\n"},
+		{"a.js", "x"},
+		{"a.tmpl", "x"},
+		{"testdata/b.js", "x"},
+		{"z.snap", "x"},
+	}
+	parser := &ctagstest.Parser{Default: []ctags.Entry{{Name: "f", Kind: "function"}, {Name: "l", Kind: "local"}}}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			var buf bytes.Buffer
+			w := tar.NewWriter(&buf)
+			for _, f := range files {
+				if err := w.WriteHeader(&tar.Header{Name: f[0], Mode: 0600, Size: int64(len(f[1]))}); err != nil {
+					return nil, err
+				}
+				if _, err := io.WriteString(w, f[1]); err != nil {
+					return nil, err
+				}
+			}
+			if err := w.Close(); err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(&buf), nil
+		},
+		NewParser: parser.New,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+	var result protocol.SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := parser.Parsed(), []string{".babelrc.js", "a.js", "a.tmpl.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got parsed files %v, want %v", got, want)
+	}
+	var got []string
+	for _, s := range result.Symbols {
+		got = append(got, s.Path+":"+s.Name)
+	}
+	if want := []string{".babelrc.js:f", "a.js:f", "a.tmpl:f"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got symbols %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,76 @@
+package symbols
+
+import (
+	"strings"
+
+	"github.com/gobwas/glob"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// RepoFilter decides which repositories the symbols service is allowed to
+// index, based on glob patterns matched against the repository name. In the
+// patterns "*" does not match across "/", but "**" does.
+type RepoFilter struct {
+	allow []glob.Glob
+	deny  []glob.Glob
+}
+
+// NewRepoFilter returns a RepoFilter for the given patterns. A repository is
+// allowed if it matches none of the deny patterns and, when there are any
+// allow patterns, at least one of them.
+func NewRepoFilter(allow, deny []string) (*RepoFilter, error) {
+	compile := func(patterns []string) ([]glob.Glob, error) {
+		globs := make([]glob.Glob, 0, len(patterns))
+		for _, pattern := range patterns {
+			g, err := glob.Compile(pattern, '/')
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid repository pattern %q", pattern)
+			}
+			globs = append(globs, g)
+		}
+		return globs, nil
+	}
+
+	var (
+		f   RepoFilter
+		err error
+	)
+	if f.allow, err = compile(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = compile(deny); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// ParseRepoPatterns splits a comma or whitespace separated list of patterns,
+// as accepted in environment variables.
+func ParseRepoPatterns(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// Allowed reports whether repo may be indexed. A nil RepoFilter allows all
+// repositories.
+func (f *RepoFilter) Allowed(repo api.RepoName) bool {
+	if f == nil {
+		return true
+	}
+	for _, g := range f.deny {
+		if g.Match(string(repo)) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, g := range f.allow {
+		if g.Match(string(repo)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package symbols
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestRepoFilter(t *testing.T) {
+	tests := map[string]struct {
+		allow, deny []string
+		want        map[api.RepoName]bool
+	}{
+		"nil": {
+			want: map[api.RepoName]bool{"github.com/foo/bar": true},
+		},
+		"deny": {
+			deny: []string{"github.com/huge/*"},
+			want: map[api.RepoName]bool{
+				"github.com/huge/repo":      false,
+				"github.com/huge/repo/nest": true,
+				"github.com/small/repo":     true,
+			},
+		},
+		"allow": {
+			allow: []string{"github.com/sourcegraph/**"},
+			want: map[api.RepoName]bool{
+				"github.com/sourcegraph/sourcegraph": true,
+				"github.com/sourcegraph/a/b":         true,
+				"github.com/other/repo":              false,
+			},
+		},
+		"deny wins over allow": {
+			allow: []string{"github.com/sourcegraph/*"},
+			deny:  []string{"github.com/sourcegraph/secret"},
+			want: map[api.RepoName]bool{
+				"github.com/sourcegraph/sourcegraph": true,
+				"github.com/sourcegraph/secret":      false,
+			},
+		},
+	}
+	for label, test := range tests {
+		t.Run(label, func(t *testing.T) {
+			var f *RepoFilter
+			if test.allow != nil || test.deny != nil {
+				var err error
+				f, err = NewRepoFilter(test.allow, test.deny)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for repo, want := range test.want {
+				if got := f.Allowed(repo); got != want {
+					t.Errorf("Allowed(%q) = %t, want %t", repo, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRepoFilter_invalid(t *testing.T) {
+	if _, err := NewRepoFilter([]string{"github.com/[foo"}, nil); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,63 @@
+package symbols
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+// errResponseSizeExceeded is returned by the function limitResponseSize
+// wraps once a symbol would take the response over its maximum size.
+var errResponseSizeExceeded = errors.New("response size limit exceeded")
+
+// limitResponseSize returns fn limited to symbols that add up to at most max
+// bytes of response (see symbolResponseSize). It returns
+// errResponseSizeExceeded, without calling fn, for the first symbol that
+// doesn't fit.
+func limitResponseSize(fn func(protocol.Symbol) error, max int64) func(protocol.Symbol) error {
+	var size int64
+	return func(symbol protocol.Symbol) error {
+		size += symbolResponseSize(symbol)
+		if size > max {
+			return errResponseSizeExceeded
+		}
+		return fn(symbol)
+	}
+}
+
+// emptySymbolResponseSize and enclosingResponseSize are the sizes of the JSON
+// encodings of a symbol without any fields set and of an enclosing symbol
+// with all fields set but its strings.
+var (
+	emptySymbolResponseSize = jsonSize(protocol.Symbol{})
+	enclosingResponseSize   = jsonSize(protocol.EnclosingSymbol{Line: 1<<31 - 1})
+)
+
+func jsonSize(v interface{}) int64 {
+	b, _ := json.Marshal(v)
+	return int64(len(b))
+}
+
+// symbolResponseSize is the approximate number of bytes sym takes in an
+// uncompressed response, regardless of its format.
+func symbolResponseSize(sym protocol.Symbol) int64 {
+	n := emptySymbolResponseSize + int64(len(sym.Name)+len(sym.Path)+len(sym.Kind)+len(sym.Language)+
+		len(sym.Parent)+len(sym.ParentKind)+len(sym.Signature)+len(sym.Pattern)+len(sym.Source)+len(sym.URL))
+	for _, enclosing := range sym.Enclosing {
+		n += enclosingResponseSize + int64(len(enclosing.Name)+len(enclosing.Kind))
+	}
+	return n
+}
+
+var responseSizeTruncations = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "symbols",
+	Subsystem: "request",
+	Name:      "response_size_truncations",
+	Help:      "The total number of searches whose results were truncated at the maximum response size.",
+})
+
+func init() {
+	prometheus.MustRegister(responseSizeTruncations)
+}
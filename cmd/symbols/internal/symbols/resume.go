@@ -0,0 +1,181 @@
+package symbols
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/diskcache"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// maxPartialParseAge is how old an interrupted parse may get before it is
+// removed instead of being left to be resumed.
+const maxPartialParseAge = 24 * time.Hour
+
+// partialParseDir returns the directory holding the databases of
+// checkpointed parses that have not completed yet.
+func (s *Service) partialParseDir() string {
+	return filepath.Join(s.Path, "partial")
+}
+
+// partialDBPath returns the path of the database of the checkpointed parse of
+// the cache entry key. Unlike the temporary files of the cache it survives
+// restarts, so that an interrupted parse can be resumed.
+func (s *Service) partialDBPath(key string) string {
+	return filepath.Join(s.partialParseDir(), diskcache.EncodeKey(key)+".sqlite3")
+}
+
+// partialParse is the database of a checkpointed parse in partialParseDir.
+type partialParse struct {
+	path    string
+	size    int64 // including its sqlite journal
+	modTime time.Time
+}
+
+// listPartialParses returns the databases of the checkpointed parses that
+// have not completed yet, oldest first.
+func (s *Service) listPartialParses() ([]partialParse, error) {
+	list, err := ioutil.ReadDir(s.partialParseDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	byPath := make(map[string]*partialParse)
+	for _, fi := range list {
+		if !strings.Contains(fi.Name(), ".sqlite3") {
+			continue
+		}
+		path := filepath.Join(s.partialParseDir(), strings.TrimSuffix(fi.Name(), "-journal"))
+		p, ok := byPath[path]
+		if !ok {
+			p = &partialParse{path: path}
+			byPath[path] = p
+		}
+		p.size += fi.Size()
+		if fi.ModTime().After(p.modTime) {
+			p.modTime = fi.ModTime()
+		}
+	}
+	parses := make([]partialParse, 0, len(byPath))
+	for _, p := range byPath {
+		parses = append(parses, *p)
+	}
+	sort.Slice(parses, func(i, j int) bool { return parses[i].modTime.Before(parses[j].modTime) })
+	return parses, nil
+}
+
+// prunePartialParses removes the databases (and sqlite journals) of
+// interrupted parses older than maxPartialParseAge, which are unlikely to be
+// resumed, and then the oldest of the rest until they take at most maxBytes
+// (if positive). Parses in progress are left alone. It returns the number of
+// parses removed and the size of those left.
+func (s *Service) prunePartialParses(maxBytes int64) (removed int, size int64, err error) {
+	parses, err := s.listPartialParses()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, p := range parses {
+		size += p.size
+	}
+	for _, p := range parses {
+		if time.Since(p.modTime) < maxPartialParseAge && (maxBytes <= 0 || size <= maxBytes) {
+			continue
+		}
+		if _, active := s.activePartialParses.Load(p.path); active {
+			continue
+		}
+		if err := removePartialDB(p.path); err != nil {
+			return removed, size, err
+		}
+		removed++
+		size -= p.size
+	}
+	return removed, size, nil
+}
+
+// writeResumableDB writes the symbols database of the cache entry key to
+// dbFile, resuming the parse from a previous attempt that was interrupted. The
+// parse is written to partialDBPath(key) with checkpoints and moved to dbFile
+// once it completes, so an interrupted parse leaves its progress behind.
+func (s *Service) writeResumableDB(ctx context.Context, key, dbFile string, repo api.RepoName, commitID api.CommitID, opts parseOptions) error {
+	partial := s.partialDBPath(key)
+	s.activePartialParses.Store(partial, struct{}{})
+	defer s.activePartialParses.Delete(partial)
+	if err := os.MkdirAll(filepath.Dir(partial), 0700); err != nil {
+		return err
+	}
+	err := s.writeAllSymbolsToNewDB(ctx, partial, repo, commitID, opts)
+	if err != nil && isCorruptDBError(err) {
+		// The interrupted parse can't be resumed, so start over.
+		log15.Warn("Discarding unreadable interrupted symbols parse", "repo", repo, "commit", commitID, "error", err)
+		if err := removePartialDB(partial); err != nil {
+			return err
+		}
+		err = s.writeAllSymbolsToNewDB(ctx, partial, repo, commitID, opts)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(partial, dbFile)
+}
+
+// removePartialDB removes the database of an interrupted parse and its sqlite
+// journal.
+func removePartialDB(partial string) error {
+	for _, name := range []string{partial, partial + "-journal"} {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareResume readies the database of an interrupted checkpointed parse to
+// be resumed, and returns the files it already contains. A file is complete
+// once its row in the files table is committed, which happens after all its
+// symbols are written; symbols of files that were interrupted half way are
+// deleted so that they can be written again.
+func prepareResume(tx *sqlx.Tx) (map[string]bool, error) {
+	if _, err := tx.Exec(`DELETE FROM symbols WHERE path NOT IN (SELECT path FROM files)`); err != nil {
+		return nil, err
+	}
+	var paths []string
+	if err := tx.Select(&paths, `SELECT path FROM files`); err != nil {
+		return nil, err
+	}
+	done := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		done[p] = true
+	}
+	return done, nil
+}
+
+var (
+	resumedParses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "store",
+		Name:      "resumed_parses",
+		Help:      "The total number of interrupted repository parses that were resumed from a checkpoint.",
+	})
+	partialParseBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "symbols",
+		Subsystem: "store",
+		Name:      "partial_parse_bytes",
+		Help:      "The total size of the databases of interrupted repository parses kept to be resumed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(resumedParses)
+	prometheus.MustRegister(partialParseBytes)
+}
@@ -0,0 +1,196 @@
+package symbols
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+// failingReader returns err once the reader it wraps is exhausted.
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		err = f.err
+	}
+	return n, err
+}
+
+func TestService_resumeInterruptedParse(t *testing.T) {
+	// tarOf returns a tar archive of files, in order. If interrupted, reading
+	// fails after the last file instead of ending the archive.
+	tarOf := func(interrupted bool, files ...string) io.ReadCloser {
+		var buf bytes.Buffer
+		w := tar.NewWriter(&buf)
+		for _, name := range files {
+			if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if interrupted {
+			w.Flush()
+			return ioutil.NopCloser(failingReader{&buf, errors.New("connection reset")})
+		}
+		w.Close()
+		return ioutil.NopCloser(&buf)
+	}
+
+	var (
+		mu      sync.Mutex
+		fetches int
+		parsed  []string
+	)
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			fetches++
+			if fetches == 1 {
+				return tarOf(true, "a.js", "b.js"), nil
+			}
+			return tarOf(false, "a.js", "b.js", "c.js"), nil
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return parserFunc(func(name string, content []byte) ([]ctags.Entry, error) {
+				mu.Lock()
+				parsed = append(parsed, name)
+				mu.Unlock()
+				return []ctags.Entry{{Name: name, Path: name}}, nil
+			}), nil
+		},
+		ParseCheckpointFiles: 1,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	search := func() (int, []string) {
+		resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10})
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, nil
+		}
+		var result protocol.SearchResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, s := range result.Symbols {
+			names = append(names, s.Name)
+		}
+		return resp.StatusCode, names
+	}
+	parsedFiles := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		files := parsed
+		parsed = nil
+		sort.Strings(files)
+		return files
+	}
+
+	// The first parse is interrupted after some of the files.
+	if status, _ := search(); status != http.StatusInternalServerError {
+		t.Fatalf("got status %d for the interrupted parse, want %d", status, http.StatusInternalServerError)
+	}
+	if got, want := parsedFiles(), []string{"a.js", "b.js"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("interrupted parse: got parsed files %v, want %v", got, want)
+	}
+
+	// The next one only parses the remaining file, and the result has every
+	// symbol exactly once.
+	resumed := testutil.ToFloat64(resumedParses)
+	status, names := search()
+	if status != http.StatusOK {
+		t.Fatalf("got status %d for the resumed parse", status)
+	}
+	if want := []string{"a.js", "b.js", "c.js"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got symbols %v, want %v", names, want)
+	}
+	if got, want := parsedFiles(), []string{"c.js"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed parse: got parsed files %v, want %v", got, want)
+	}
+	if n := testutil.ToFloat64(resumedParses) - resumed; n != 1 {
+		t.Errorf("got %v resumed parses, want 1", n)
+	}
+	if fi, err := ioutil.ReadDir(service.partialParseDir()); err != nil || len(fi) != 0 {
+		t.Errorf("expected no interrupted parses to be left behind, got %d (error %v)", len(fi), err)
+	}
+}
+
+func TestService_prunePartialParses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	service := &Service{Path: dir}
+	if err := os.MkdirAll(service.partialParseDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each parse takes 100 bytes, counting its journal.
+	write := func(key string, age time.Duration) string {
+		path := service.partialDBPath(key)
+		for name, size := range map[string]int{path: 60, path + "-journal": 40} {
+			if err := ioutil.WriteFile(name, make([]byte, size), 0600); err != nil {
+				t.Fatal(err)
+			}
+			mtime := time.Now().Add(-age)
+			if err := os.Chtimes(name, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	stale := write("stale", 2*maxPartialParseAge)
+	oldest := write("oldest", 3*time.Hour)
+	active := write("active", 2*time.Hour)
+	newest := write("newest", time.Hour)
+	service.activePartialParses.Store(active, struct{}{})
+
+	// Without a size limit, only stale parses are removed.
+	removed, size, err := service.prunePartialParses(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 || size != 300 || exists(stale) || exists(stale+"-journal") {
+		t.Errorf("got %d removed and %d bytes left, want the stale parse removed and 300 bytes left", removed, size)
+	}
+
+	// The oldest parses not in progress are removed to fit the limit.
+	removed, size, err = service.prunePartialParses(150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 || size != 100 || exists(oldest) || exists(newest) || !exists(active) {
+		t.Errorf("got %d removed and %d bytes left, want all but the parse in progress removed and 100 bytes left", removed, size)
+	}
+}
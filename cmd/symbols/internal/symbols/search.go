@@ -2,18 +2,26 @@ package symbols
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"regexp"
 	"regexp/syntax"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sourcegraph/sourcegraph/internal/env"
 
 	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/diskcache"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/keegancsmith/sqlf"
@@ -21,6 +29,8 @@ import (
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/internal/routevar"
 	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
 	"golang.org/x/net/trace"
 	log15 "gopkg.in/inconshreveable/log15.v2"
@@ -31,14 +41,19 @@ const maxFileSize = 1 << 19 // 512KB
 
 var libSqlite3Pcre = env.Get("LIBSQLITE3_PCRE", "", "path to the libsqlite3-pcre library")
 
+var registerSqlite3WithPcre sync.Once
+
 // MustRegisterSqlite3WithPcre registers a sqlite3 driver with PCRE support and
-// panics if it can't.
+// panics if it can't. Only the first call registers it, so it may be called
+// more than once.
 func MustRegisterSqlite3WithPcre() {
-	if libSqlite3Pcre == "" {
-		env.PrintHelp()
-		log.Fatal("can't find the libsqlite3-pcre library because LIBSQLITE3_PCRE was not set")
-	}
-	sql.Register("sqlite3_with_pcre", &sqlite3.SQLiteDriver{Extensions: []string{libSqlite3Pcre}})
+	registerSqlite3WithPcre.Do(func() {
+		if libSqlite3Pcre == "" {
+			env.PrintHelp()
+			log.Fatal("can't find the libsqlite3-pcre library because LIBSQLITE3_PCRE was not set")
+		}
+		sql.Register("sqlite3_with_pcre", &sqlite3.SQLiteDriver{Extensions: []string{libSqlite3Pcre}})
+	})
 }
 
 func (s *Service) handleSearch(w http.ResponseWriter, r *http.Request) {
@@ -48,24 +63,278 @@ func (s *Service) handleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := s.search(r.Context(), args)
+	if err := validateNameFilter(args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if args.Format != "" && args.Format != protocol.FormatLSP && args.Format != protocol.FormatTree {
+		http.Error(w, fmt.Sprintf("invalid format %q (must be empty, %s or %s)", args.Format, protocol.FormatLSP, protocol.FormatTree), http.StatusBadRequest)
+		return
+	}
+	if args.MaxDepth < 0 {
+		http.Error(w, fmt.Sprintf("invalid maxDepth %d (must not be negative)", args.MaxDepth), http.StatusBadRequest)
+		return
+	}
+	if err := validatePagination(args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accessLog := accessLogFromContext(r.Context())
+	accessLog.Repo, accessLog.CommitID = args.Repo, args.CommitID
+
+	if !s.checkRepoAccess(w, r, args.Repo) {
+		return
+	}
+	release, ok := s.acquireCommitRequest(w, args.Repo, args.CommitID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	cached := s.cache.Exists(s.searchCacheKey(args))
+	accessLog.setCacheHit(cached)
+
+	if args.Async && !cached {
+		pending := protocol.SearchPending{Token: s.startWarmJob(args)}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(pending); err != nil {
+			log15.Error("Failed to write pending search response", "error", err)
+		}
+		return
+	}
+
+	if !cached && s.rejectIfSaturated(w) {
+		return
+	}
+
+	if args.Count {
+		count, err := s.count(r.Context(), args)
+		if err != nil {
+			writeSearchError(w, r, args, err)
+			return
+		}
+		if s.rejectNoParseableFiles(w, count.NoParseableFiles) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Symbols-Count", strconv.Itoa(count.Count))
+		accessLog.Symbols = count.Count
+		if err := json.NewEncoder(w).Encode(count); err != nil {
+			log15.Error("Failed to write symbol count response", "error", err)
+		}
+		return
+	}
+
+	if args.Format == protocol.FormatLSP {
+		s.writeFormattedSearch(w, r, args, func(symbols []protocol.Symbol) formattedSearchResult {
+			result := protocol.DocumentSymbols(symbols)
+			return &result
+		})
+		return
+	}
+
+	if args.Format == protocol.FormatTree {
+		s.writeFormattedSearch(w, r, args, func(symbols []protocol.Symbol) formattedSearchResult {
+			result := protocol.SymbolTree(symbols)
+			return &result
+		})
+		return
+	}
+
+	if args.GroupByFile {
+		s.writeFormattedSearch(w, r, args, func(symbols []protocol.Symbol) formattedSearchResult {
+			result := groupByFile(symbols)
+			return &result
+		})
+		return
+	}
+
+	// Symbols are encoded as they are read from the database so that large
+	// results don't have to be held in memory before being written.
+	stream := &symbolStream{w: w}
+	truncated, err := s.searchFunc(r.Context(), args, stream.write)
 	if err != nil {
-		if err == context.Canceled && r.Context().Err() == context.Canceled {
-			return // client went away
+		if stream.started {
+			// The status line has already been sent, so all we can do is log
+			// and leave the response truncated.
+			log15.Error("Symbol search failed while streaming results", "args", args, "error", err)
+			return
 		}
-		log15.Error("Symbol search failed", "args", args, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeSearchError(w, r, args, err)
+		return
+	}
+	// A commit without parseable files has no symbols, so nothing has been
+	// written yet.
+	if !stream.started && s.rejectNoParseableFiles(w, truncated.noParseableFiles) {
+		return
+	}
+
+	accessLog.Symbols = stream.symbols
+	if err := stream.close(truncated); err != nil {
+		log15.Error("Failed to write symbol search response", "error", err)
+	}
+}
+
+// formattedSearchResult is a search result in a shape other than
+// protocol.SearchResult, such as grouped by file.
+type formattedSearchResult interface {
+	SetTruncation(protocol.SearchResult)
+}
+
+// writeFormattedSearch responds with the result of the search args, shaped by
+// format. Unlike the default format, the whole result is held in memory.
+func (s *Service) writeFormattedSearch(w http.ResponseWriter, r *http.Request, args protocol.SearchArgs, format func([]protocol.Symbol) formattedSearchResult) {
+	result, err := s.search(r.Context(), args)
+	if err != nil {
+		writeSearchError(w, r, args, err)
+		return
+	}
+	if s.rejectNoParseableFiles(w, result.NoParseableFiles) {
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	accessLogFromContext(r.Context()).Symbols = len(result.Symbols)
+	formatted := format(result.Symbols)
+	formatted.SetTruncation(*result)
+	if err := json.NewEncoder(w).Encode(formatted); err != nil {
+		log15.Error("Failed to write symbol search response", "args", args, "error", err)
+	}
+}
+
+// rejectNoParseableFiles responds with NoParseableFilesStatus and returns
+// true if it is set and the searched commit has no parseable files.
+func (s *Service) rejectNoParseableFiles(w http.ResponseWriter, noParseableFiles bool) bool {
+	if !noParseableFiles || s.NoParseableFilesStatus == 0 {
+		return false
+	}
+	http.Error(w, "the commit has no files the symbols service parses", s.NoParseableFilesStatus)
+	return true
+}
 
-	if err := json.NewEncoder(w).Encode(result); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// writeSearchError responds with the status for a failed search.
+func writeSearchError(w http.ResponseWriter, r *http.Request, args protocol.SearchArgs, err error) {
+	if err == context.Canceled && r.Context().Err() == context.Canceled {
+		return // client went away
+	}
+	if errors.Cause(err) == errParseQueueTimeout || isMemoryExceeded(err) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
+	log15.Error("Symbol search failed", "args", args, "error", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// symbolStream incrementally writes a protocol.SearchResult as JSON. The
+// output decodes identically to encoding the whole result at once.
+type symbolStream struct {
+	w       io.Writer
+	started bool
+	symbols int // the number of symbols written
 }
 
-func (s *Service) search(ctx context.Context, args protocol.SearchArgs) (result *protocol.SearchResult, err error) {
-	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+func (s *symbolStream) write(symbol protocol.Symbol) error {
+	b, err := json.Marshal(symbol)
+	if err != nil {
+		return err
+	}
+	s.symbols++
+	prefix := ","
+	if !s.started {
+		prefix = `{"Symbols":[`
+		s.started = true
+	}
+	if _, err := io.WriteString(s.w, prefix); err != nil {
+		return err
+	}
+	_, err = s.w.Write(b)
+	return err
+}
+
+// close ends the result, whose SkippedFiles, Truncated, NoParseableFiles and
+// NextPageToken are those of t.
+func (s *symbolStream) close(t truncation) error {
+	end := "]"
+	if !s.started {
+		end = `{"Symbols":null`
+	}
+	if t.skippedFiles > 0 {
+		end += `,"SkippedFiles":` + strconv.Itoa(t.skippedFiles)
+	}
+	if len(t.reasons) > 0 {
+		b, err := json.Marshal(t.reasons)
+		if err != nil {
+			return err
+		}
+		end += `,"Truncated":` + string(b)
+	}
+	if t.noParseableFiles {
+		end += `,"NoParseableFiles":true`
+	}
+	if t.nextPage != "" {
+		b, err := json.Marshal(t.nextPage)
+		if err != nil {
+			return err
+		}
+		end += `,"NextPageToken":` + string(b)
+	}
+	_, err := io.WriteString(s.w, end+"}\n")
+	return err
+}
+
+func (s *Service) search(ctx context.Context, args protocol.SearchArgs) (*protocol.SearchResult, error) {
+	result := &protocol.SearchResult{}
+	mem := s.newRequestMemory(ctx)
+	truncated, err := s.searchFunc(ctx, args, func(symbol protocol.Symbol) error {
+		if err := mem.add(symbol); err != nil {
+			return err
+		}
+		result.Symbols = append(result.Symbols, symbol)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.SkippedFiles, result.Truncated, result.NextPageToken = truncated.skippedFiles, truncated.reasons, truncated.nextPage
+	result.NoParseableFiles = truncated.noParseableFiles
+	return result, nil
+}
+
+// groupByFile groups symbols by their path. Symbols are read ordered by path,
+// so each file's symbols are consecutive.
+func groupByFile(symbols []protocol.Symbol) protocol.SearchFilesResult {
+	var result protocol.SearchFilesResult
+	for _, symbol := range symbols {
+		if n := len(result.Files); n == 0 || result.Files[n-1].Path != symbol.Path {
+			result.Files = append(result.Files, protocol.FileSymbols{Path: symbol.Path})
+		}
+		f := &result.Files[len(result.Files)-1]
+		f.Symbols = append(f.Symbols, symbol)
+	}
+	return result
+}
+
+// symbolURL returns the URL of the line of symbol in repo@commitID in the app
+// (see protocol.Symbol.URL).
+func (s *Service) symbolURL(repo api.RepoName, commitID api.CommitID, symbol protocol.Symbol) string {
+	u := url.URL{Path: strings.TrimRight(s.URLBasePath, "/") + routevar.TreeEntryPath(repo, string(commitID), symbol.Path)}
+	if symbol.Line > 0 {
+		u.Fragment = fmt.Sprintf("L%d", symbol.Line)
+	}
+	return u.String()
+}
+
+// searchTimeout is how long a search may take. A search that runs out of time
+// once the symbols database is open returns the symbols found so far (see
+// protocol.TruncatedTimeout).
+var searchTimeout = 60 * time.Second
+
+// searchFunc calls fn for each symbol matching args, in the order they are read
+// from the repo@commit's symbols database. It returns how the symbols passed to
+// fn are incomplete.
+func (s *Service) searchFunc(parent context.Context, args protocol.SearchArgs, fn func(protocol.Symbol) error) (truncated truncation, err error) {
+	ctx, cancel := context.WithTimeout(parent, searchTimeout)
 	defer cancel()
 
 	log15.Debug("Symbol search", "repo", args.Repo, "query", args.Query)
@@ -92,31 +361,157 @@ func (s *Service) search(ctx context.Context, args protocol.SearchArgs) (result
 		tr.Finish()
 	}()
 
-	dbFile, err := s.getDBFile(ctx, args)
+	db, err := s.openDB(ctx, args)
 	if err != nil {
-		return nil, err
+		return truncation{}, err
+	}
+	defer db.Close()
+
+	if truncated, err = commitTruncation(ctx, db); err != nil {
+		return truncation{}, err
+	}
+	var page *pageTracker
+	if args.PageSize > 0 {
+		start, err := decodePageToken(args)
+		if err != nil {
+			return truncation{}, err
+		}
+		page = newPageTracker(args, start)
+		next := fn
+		fn = func(symbol protocol.Symbol) error {
+			if err := next(symbol); err != nil {
+				return err
+			}
+			page.add(symbol)
+			return nil
+		}
+	}
+	if s.MaxResponseBytes > 0 {
+		fn = limitResponseSize(fn, s.MaxResponseBytes)
+	}
+	if args.IncludeURL {
+		next := fn
+		fn = func(symbol protocol.Symbol) error {
+			symbol.URL = s.symbolURL(args.Repo, args.CommitID, symbol)
+			return next(symbol)
+		}
+	}
+	limited, err := filterSymbols(ctx, db, args, fn)
+	if errors.Cause(err) == errResponseSizeExceeded {
+		responseSizeTruncations.Inc()
+		truncated.add(protocol.TruncatedResponseSize)
+		if page != nil {
+			truncated.nextPage = page.next()
+		}
+		return truncated, nil
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		searchTimeouts.Inc()
+		truncated.add(protocol.TruncatedTimeout)
+		if page != nil {
+			// The next page continues after the symbols found in time.
+			truncated.nextPage = page.next()
+		}
+		return truncated, nil
 	}
-	db, err := sqlx.Open("sqlite3_with_pcre", dbFile)
+	if err != nil {
+		return truncation{}, err
+	}
+	if limited && page != nil {
+		// The rest of the symbols are on the next pages, so the result is
+		// not truncated by the limit.
+		truncated.nextPage = page.next()
+	} else if limited {
+		truncated.add(protocol.TruncatedLimit)
+	}
+	return truncated, nil
+}
+
+// count returns the number of symbols matching args, ignoring args.First.
+func (s *Service) count(ctx context.Context, args protocol.SearchArgs) (result *protocol.SearchCount, err error) {
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "count")
+	span.SetTag("repo", args.Repo)
+	span.SetTag("commitID", args.CommitID)
+	span.SetTag("query", args.Query)
+	defer func() {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+		}
+		span.Finish()
+	}()
+
+	db, err := s.openDB(ctx, args)
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
 
-	result = &protocol.SearchResult{}
-	res, err := filterSymbols(ctx, db, args)
+	truncated, err := commitTruncation(ctx, db)
 	if err != nil {
 		return nil, err
 	}
-	result.Symbols = res
+	result, err = countSymbols(ctx, db, args)
+	if err != nil {
+		return nil, err
+	}
+	result.SkippedFiles, result.Truncated, result.NoParseableFiles = truncated.skippedFiles, truncated.reasons, truncated.noParseableFiles
 	return result, nil
 }
 
+// openDB opens the sqlite3 database for the repo@commit specified in args,
+// creating it if necessary (see getDBFile). If the cached database is corrupt
+// it is removed and parsed again.
+func (s *Service) openDB(ctx context.Context, args protocol.SearchArgs) (*sqlx.DB, error) {
+	for attempt := 0; ; attempt++ {
+		dbFile, err := s.getDBFile(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		db, err := sqlx.Open("sqlite3_with_pcre", dbFile)
+		if err != nil {
+			return nil, err
+		}
+		err = checkDB(ctx, db)
+		if err == nil {
+			return db, nil
+		}
+		db.Close()
+		if attempt > 0 || !isCorruptDBError(err) {
+			return nil, err
+		}
+		s.removeCorruptCacheEntry(s.searchCacheKey(args), "db", args.Repo, args.CommitID, err)
+	}
+}
+
 // getDBFile returns the path to the sqlite3 database for the repo@commit
 // specified in `args`. If the database doesn't already exist in the disk cache,
 // it will create a new one and write all the symbols into it.
 func (s *Service) getDBFile(ctx context.Context, args protocol.SearchArgs) (string, error) {
-	diskcacheFile, err := s.cache.OpenWithPath(ctx, fmt.Sprintf("%d-%s@%s", symbolsDBVersion, args.Repo, args.CommitID), func(fetcherCtx context.Context, tempDBFile string) error {
-		err := s.writeAllSymbolsToNewDB(fetcherCtx, tempDBFile, args.Repo, args.CommitID)
+	diskcacheFile, err := s.openDBFile(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	defer diskcacheFile.File.Close()
+
+	return diskcacheFile.File.Name(), err
+}
+
+// openDBFile opens the cached sqlite3 database file for the repo@commit
+// specified in args, creating it if necessary. The caller must close it.
+func (s *Service) openDBFile(ctx context.Context, args protocol.SearchArgs) (*diskcache.File, error) {
+	key := s.searchCacheKey(args)
+	return s.cache.OpenWithPath(ctx, key, func(fetcherCtx context.Context, tempDBFile string) error {
+		opts := parseOptions{dropKinds: s.dropKinds(args.IncludeKinds), checkpointFiles: s.ParseCheckpointFiles, maxFiles: s.MaxFilesPerCommit, maxDepth: args.MaxDepth}
+		var err error
+		if opts.checkpointFiles > 0 {
+			err = s.writeResumableDB(fetcherCtx, key, tempDBFile, args.Repo, args.CommitID, opts)
+		} else {
+			err = s.writeAllSymbolsToNewDB(fetcherCtx, tempDBFile, args.Repo, args.CommitID, opts)
+		}
 		if err != nil {
 			if err == context.Canceled {
 				log15.Error("Unable to parse repository symbols within the context", "repo", args.Repo, "commit", args.CommitID, "query", args.Query)
@@ -125,12 +520,26 @@ func (s *Service) getDBFile(ctx context.Context, args protocol.SearchArgs) (stri
 		}
 		return nil
 	})
-	if err != nil {
-		return "", err
+}
+
+// cacheKey returns the disk cache key for the symbols database of
+// repo@commitID without the symbols of dropKinds.
+func (s *Service) cacheKey(repo api.RepoName, commitID api.CommitID, dropKinds []string) string {
+	key := fmt.Sprintf("%s-%s@%s", s.cacheVersion, repo, commitID)
+	if len(dropKinds) > 0 {
+		key += "-drop-" + strings.Join(dropKinds, ",")
 	}
-	defer diskcacheFile.File.Close()
+	return key
+}
 
-	return diskcacheFile.File.Name(), err
+// searchCacheKey returns the disk cache key for the symbols database searched
+// by args.
+func (s *Service) searchCacheKey(args protocol.SearchArgs) string {
+	key := s.cacheKey(args.Repo, args.CommitID, s.dropKinds(args.IncludeKinds))
+	if args.MaxDepth > 0 {
+		key += fmt.Sprintf("-depth-%d", args.MaxDepth)
+	}
+	return key
 }
 
 // isLiteralEquality checks if the given regex matches literal strings exactly.
@@ -151,7 +560,10 @@ func isLiteralEquality(expr string) (ok bool, lit string, err error) {
 	return true, string(r.Sub[1].Rune), nil
 }
 
-func filterSymbols(ctx context.Context, db *sqlx.DB, args protocol.SearchArgs) (res []protocol.Symbol, err error) {
+// filterSymbols calls fn for each symbol in db matching args. Rows are
+// scanned one at a time; if fn returns an error the rest are not read. It
+// reports whether more symbols match than the limit of args.
+func filterSymbols(ctx context.Context, db *sqlx.DB, args protocol.SearchArgs, fn func(protocol.Symbol) error) (limited bool, err error) {
 	span, _ := opentracing.StartSpanFromContext(ctx, "filterSymbols")
 	defer func() {
 		if err != nil {
@@ -162,10 +574,87 @@ func filterSymbols(ctx context.Context, db *sqlx.DB, args protocol.SearchArgs) (
 	}()
 
 	const maxFirst = 500
+	if args.PageSize > 0 {
+		args.First = args.PageSize
+	}
 	if args.First < 0 || args.First > maxFirst {
 		args.First = maxFirst
 	}
 
+	conditions := symbolConditions(args)
+
+	// A page starts at the symbol after the last one of the previous page,
+	// skipping those with the same key that it already returned.
+	cursor, err := decodePageToken(args)
+	if err != nil {
+		return false, err
+	}
+	skip := 0
+	if cursor != nil {
+		conditions = append(conditions, cursor.condition())
+		skip = cursor.Skip
+	}
+
+	// Symbols are inserted in whatever order files finish parsing, so order
+	// them to make results (and which results are cut off by the limit)
+	// deterministic.
+	const orderBy = "ORDER BY path, line, name, kind"
+
+	// One more symbol than the limit is read to tell whether the limit cut
+	// off any.
+	var sqlQuery *sqlf.Query
+	if len(conditions) == 0 {
+		sqlQuery = sqlf.Sprintf("SELECT * FROM symbols "+orderBy+" LIMIT %s", args.First+1)
+	} else {
+		sqlQuery = sqlf.Sprintf("SELECT * FROM symbols WHERE %s "+orderBy+" LIMIT %s", sqlf.Join(conditions, "AND"), skip+args.First+1)
+	}
+
+	rows, err := db.QueryxContext(ctx, sqlQuery.Query(sqlf.PostgresBindVar), sqlQuery.Args()...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	hits := 0
+	for rows.Next() {
+		if hits == args.First {
+			limited = true
+			break
+		}
+		var symbolInDB symbolInDB
+		if err := rows.StructScan(&symbolInDB); err != nil {
+			return false, err
+		}
+		symbol := symbolInDBToSymbol(symbolInDB)
+		if skip > 0 && cursor.at(symbol) {
+			skip--
+			continue
+		}
+		if !args.IncludeSource {
+			symbol.Source = ""
+		}
+		if args.IncludeEnclosing {
+			if symbol.Enclosing, err = enclosingSymbols(ctx, db, symbol); err != nil {
+				return false, err
+			}
+		}
+		if err := fn(symbol); err != nil {
+			return false, err
+		}
+		hits++
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	span.SetTag("hits", hits)
+	span.SetTag("limited", limited)
+	return limited, nil
+}
+
+// symbolConditions returns the SQL conditions a symbol must satisfy to match
+// args.
+func symbolConditions(args protocol.SearchArgs) []*sqlf.Query {
 	makeCondition := func(column string, regex string) []*sqlf.Query {
 		conditions := []*sqlf.Query{}
 
@@ -207,33 +696,129 @@ func filterSymbols(ctx context.Context, db *sqlx.DB, args protocol.SearchArgs) (
 		conditions = append(conditions, makeCondition("path", includePattern)...)
 	}
 	conditions = append(conditions, negateAll(makeCondition("path", args.ExcludePattern))...)
+	if args.Name != "" {
+		conditions = append(conditions, nameCondition(args))
+	}
+	if args.TopLevelOnly {
+		conditions = append(conditions, sqlf.Sprintf("parent = ''"))
+	}
+	if args.ExportedOnly {
+		conditions = append(conditions, exportedConditions...)
+	}
+	return conditions
+}
+
+// exportedConditions are the SQL conditions for symbols that are exported, as
+// documented on protocol.SearchArgs.ExportedOnly.
+var exportedConditions = []*sqlf.Query{
+	sqlf.Sprintf("kind NOT IN (%s, %s, %s)", "local", "parameter", "label"),
+	sqlf.Sprintf("(language <> %s OR name GLOB %s)", "Go", "[A-Z]*"),
+	sqlf.Sprintf("(language <> %s OR name NOT GLOB %s)", "Python", "_*"),
+}
+
+// validateNameFilter returns an error if args.Name and args.NameMatch are not
+// a valid name filter.
+func validateNameFilter(args protocol.SearchArgs) error {
+	switch args.NameMatch {
+	case "", protocol.NameMatchExact, protocol.NameMatchPrefix:
+		return nil
+	case protocol.NameMatchRegex:
+		if _, err := regexp.Compile(args.Name); err != nil {
+			return errors.Wrap(err, "invalid name regex")
+		}
+		return nil
+	default:
+		return errors.Errorf("invalid name match mode %q (must be %s, %s or %s)", args.NameMatch, protocol.NameMatchExact, protocol.NameMatchPrefix, protocol.NameMatchRegex)
+	}
+}
+
+// nameCondition returns the SQL condition for the name filter of args, which
+// must be valid (see validateNameFilter).
+func nameCondition(args protocol.SearchArgs) *sqlf.Query {
+	var regex string
+	switch args.NameMatch {
+	case protocol.NameMatchRegex:
+		regex = args.Name
+	case protocol.NameMatchPrefix:
+		regex = "^" + regexp.QuoteMeta(args.Name)
+	default:
+		// Use `=` to get the speed boost from the index on the column.
+		if args.NameCaseSensitive {
+			return sqlf.Sprintf("name = %s", args.Name)
+		}
+		return sqlf.Sprintf("namelowercase = %s", strings.ToLower(args.Name))
+	}
+	if !args.NameCaseSensitive {
+		regex = "(?i:" + regex + ")"
+	}
+	return sqlf.Sprintf("name REGEXP %s", regex)
+}
+
+// countSymbols returns the number of symbols in db matching args, in total and
+// per kind.
+func countSymbols(ctx context.Context, db *sqlx.DB, args protocol.SearchArgs) (*protocol.SearchCount, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "countSymbols")
+	defer span.Finish()
+
+	conditions := symbolConditions(args)
 
 	var sqlQuery *sqlf.Query
 	if len(conditions) == 0 {
-		sqlQuery = sqlf.Sprintf("SELECT * FROM symbols LIMIT %s", args.First)
+		sqlQuery = sqlf.Sprintf("SELECT kind, COUNT(*) AS count FROM symbols GROUP BY kind")
 	} else {
-		sqlQuery = sqlf.Sprintf("SELECT * FROM symbols WHERE %s LIMIT %s", sqlf.Join(conditions, "AND"), args.First)
+		sqlQuery = sqlf.Sprintf("SELECT kind, COUNT(*) AS count FROM symbols WHERE %s GROUP BY kind", sqlf.Join(conditions, "AND"))
 	}
 
-	var symbolsInDB []symbolInDB
-	err = db.Select(&symbolsInDB, sqlQuery.Query(sqlf.PostgresBindVar), sqlQuery.Args()...)
-	if err != nil {
+	var kinds []struct {
+		Kind  string
+		Count int
+	}
+	if err := db.SelectContext(ctx, &kinds, sqlQuery.Query(sqlf.PostgresBindVar), sqlQuery.Args()...); err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
 		return nil, err
 	}
 
-	for _, symbolInDB := range symbolsInDB {
-		res = append(res, symbolInDBToSymbol(symbolInDB))
+	result := &protocol.SearchCount{Kinds: make(map[string]int, len(kinds))}
+	for _, k := range kinds {
+		result.Count += k.Count
+		result.Kinds[k.Kind] = k.Count
 	}
-
-	span.SetTag("hits", len(res))
-	return res, nil
+	span.SetTag("count", result.Count)
+	return result, nil
 }
 
 // The version of the symbols database schema. This is included in the database
 // filenames to prevent a newer version of the symbols service from attempting
 // to read from a database created by an older (and likely incompatible) symbols
 // service. Increment this when you change the database schema.
-const symbolsDBVersion = 3
+const symbolsDBVersion = 6
+
+// parseConfig returns ParseConfig together with the options of the service
+// that determine which symbols are parsed from a commit.
+func (s *Service) parseConfig() string {
+	var b strings.Builder
+	b.WriteString(s.ParseConfig)
+	fmt.Fprintf(&b, "\nskip generated files: %v", s.SkipGeneratedFiles)
+	if s.SkipGeneratedFiles {
+		fmt.Fprintf(&b, " %q", s.GeneratedFilePatterns)
+	}
+	fmt.Fprintf(&b, "\nfollow gitignore: %v", s.FollowGitignore)
+	fmt.Fprintf(&b, "\npreserve line endings: %v", s.PreserveLineEndings)
+	fmt.Fprintf(&b, "\nmax files per commit: %d", s.MaxFilesPerCommit)
+	return b.String()
+}
+
+// parseConfigVersion returns the version of the cache keys of a service with
+// the parse configuration config (see parseConfig).
+func parseConfigVersion(config string) string {
+	version := strconv.Itoa(symbolsDBVersion)
+	if config != "" {
+		sum := sha256.Sum256([]byte(config))
+		version += "." + hex.EncodeToString(sum[:6])
+	}
+	return version
+}
 
 // symbolInDB is the same as `protocol.Symbol`, but with two additional columns:
 // namelowercase and pathlowercase, which enable indexed case insensitive
@@ -250,6 +835,7 @@ type symbolInDB struct {
 	ParentKind    string
 	Signature     string
 	Pattern       string
+	Source        string
 
 	FileLimited bool
 }
@@ -267,6 +853,7 @@ func symbolToSymbolInDB(symbol protocol.Symbol) symbolInDB {
 		ParentKind:    symbol.ParentKind,
 		Signature:     symbol.Signature,
 		Pattern:       symbol.Pattern,
+		Source:        symbol.Source,
 
 		FileLimited: symbol.FileLimited,
 	}
@@ -283,14 +870,17 @@ func symbolInDBToSymbol(symbolInDB symbolInDB) protocol.Symbol {
 		ParentKind: symbolInDB.ParentKind,
 		Signature:  symbolInDB.Signature,
 		Pattern:    symbolInDB.Pattern,
+		Source:     symbolInDB.Source,
 
 		FileLimited: symbolInDB.FileLimited,
 	}
 }
 
 // writeAllSymbolsToNewDB fetches the repo@commit from gitserver, parses all the
-// symbols, and writes them to the blank database file `dbFile`.
-func (s *Service) writeAllSymbolsToNewDB(ctx context.Context, dbFile string, repoName api.RepoName, commitID api.CommitID) error {
+// symbols, and writes them to the blank database file `dbFile`. If
+// opts.checkpointFiles is set, dbFile may instead hold an interrupted parse
+// written with the same options, which is resumed (see prepareResume).
+func (s *Service) writeAllSymbolsToNewDB(ctx context.Context, dbFile string, repoName api.RepoName, commitID api.CommitID, opts parseOptions) (err error) {
 	db, err := sqlx.Open("sqlite3_with_pcre", dbFile)
 	if err != nil {
 		return err
@@ -302,6 +892,11 @@ func (s *Service) writeAllSymbolsToNewDB(ctx context.Context, dbFile string, rep
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
 
 	// The column names are the lowercase version of fields in `symbolInDB`
 	// because sqlx lowercases struct fields by default. See
@@ -319,52 +914,160 @@ func (s *Service) writeAllSymbolsToNewDB(ctx context.Context, dbFile string, rep
 			parentkind VARCHAR(255) NOT NULL,
 			signature VARCHAR(255) NOT NULL,
 			pattern VARCHAR(255) NOT NULL,
+			source VARCHAR(255) NOT NULL,
 			filelimited BOOLEAN NOT NULL
 		)`)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(`CREATE INDEX name_index ON symbols(name);`)
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS name_index ON symbols(name);`)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(`CREATE INDEX path_index ON symbols(path);`)
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS path_index ON symbols(path);`)
 	if err != nil {
 		return err
 	}
 
 	// `*lowercase_index` enables indexed case insensitive queries.
-	_, err = tx.Exec(`CREATE INDEX namelowercase_index ON symbols(namelowercase);`)
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS namelowercase_index ON symbols(namelowercase);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS pathlowercase_index ON symbols(pathlowercase);`)
+	if err != nil {
+		return err
+	}
+
+	// `order_index` matches the order of search results, so that a search
+	// reads only the symbols up to its limit instead of sorting them all.
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS order_index ON symbols(path, line, name, kind);`)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(`CREATE INDEX pathlowercase_index ON symbols(pathlowercase);`)
+	// files lists every file that was parsed, including those without
+	// symbols, so that requests for a file can tell whether it exists.
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS files (path VARCHAR(4096) PRIMARY KEY NOT NULL)`)
 	if err != nil {
 		return err
 	}
 
-	insertStatement, err := tx.PrepareNamed(
-		fmt.Sprintf(
-			"INSERT INTO symbols %s VALUES %s",
-			"( name,  namelowercase,  path,  pathlowercase,  line,  kind,  language,  parent,  parentkind,  signature,  pattern,  filelimited)",
-			"(:name, :namelowercase, :path, :pathlowercase, :line, :kind, :language, :parent, :parentkind, :signature, :pattern, :filelimited)"))
+	// meta holds facts about the parse as a whole (see metaSkippedFiles).
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS meta (key VARCHAR(255) PRIMARY KEY NOT NULL, value INT NOT NULL)`)
 	if err != nil {
 		return err
 	}
 
-	err = s.parseUncached(ctx, repoName, commitID, func(symbol protocol.Symbol) error {
+	if opts.checkpointFiles > 0 {
+		done, err := prepareResume(tx)
+		if err != nil {
+			return err
+		}
+		if len(done) > 0 {
+			resumedParses.Inc()
+			log15.Info("Resuming interrupted symbols parse", "repo", repoName, "commit", commitID, "files", len(done))
+		}
+		opts.skipPaths = done
+	}
+
+	const insertQuery = "INSERT INTO symbols " +
+		"( name,  namelowercase,  path,  pathlowercase,  line,  kind,  language,  parent,  parentkind,  signature,  pattern,  source,  filelimited) VALUES " +
+		"(:name, :namelowercase, :path, :pathlowercase, :line, :kind, :language, :parent, :parentkind, :signature, :pattern, :source, :filelimited)"
+	insertStatement, err := tx.PrepareNamed(insertQuery)
+	if err != nil {
+		return err
+	}
+
+	// checkpoint commits what has been written so far and starts a new
+	// transaction.
+	checkpoint := func() error {
+		insertStatement.Close()
+		err := tx.Commit()
+		tx = nil
+		if err != nil {
+			return err
+		}
+		if tx, err = db.Beginx(); err != nil {
+			return err
+		}
+		insertStatement, err = tx.PrepareNamed(insertQuery)
+		return err
+	}
+
+	var (
+		dbMu        sync.Mutex // protects tx, insertStatement, filesErr and uncommitted
+		filesErr    error
+		uncommitted int // files written since the last checkpoint
+		onFile      = opts.onFile
+	)
+	opts.onFile = func(fp fileParse) {
+		// A file that was interrupted is not done, so that a resumed parse
+		// parses it again.
+		if fp.err != context.Canceled && fp.err != context.DeadlineExceeded {
+			dbMu.Lock()
+			if filesErr == nil {
+				if _, err := tx.Exec(`INSERT OR IGNORE INTO files (path) VALUES (?)`, fp.path); err != nil {
+					filesErr = err
+				}
+				uncommitted++
+				if opts.checkpointFiles > 0 && uncommitted >= opts.checkpointFiles && filesErr == nil {
+					filesErr = checkpoint()
+					uncommitted = 0
+				}
+			}
+			dbMu.Unlock()
+		}
+		if onFile != nil {
+			onFile(fp)
+		}
+	}
+	skipped := 0
+	opts.onOverLimit = func(string) { skipped++ }
+	tooLarge, onSkip := 0, opts.onSkip
+	opts.onSkip = func(path, reason string) {
+		if reason == skipTooLarge {
+			tooLarge++
+		}
+		if onSkip != nil {
+			onSkip(path, reason)
+		}
+	}
+
+	err = s.parseUncached(ctx, repoName, commitID, opts, func(symbol protocol.Symbol) error {
 		symbolInDBValue := symbolToSymbolInDB(symbol)
+		dbMu.Lock()
+		defer dbMu.Unlock()
+		if filesErr != nil {
+			return filesErr
+		}
 		_, err := insertStatement.Exec(&symbolInDBValue)
 		return err
 	})
 	if err != nil {
 		return err
 	}
+	if filesErr != nil {
+		return filesErr
+	}
+	if skipped > 0 {
+		partialParses.Inc()
+		log15.Warn("Parsed only some files of a commit with too many files", "repo", repoName, "commit", commitID, "maxFiles", opts.maxFiles, "skippedFiles", skipped)
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)`, metaSkippedFiles, skipped); err != nil {
+			return err
+		}
+	}
+	if tooLarge > 0 {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)`, metaTooLargeFiles, tooLarge); err != nil {
+			return err
+		}
+	}
 
 	err = tx.Commit()
+	tx = nil
 	if err != nil {
 		return err
 	}
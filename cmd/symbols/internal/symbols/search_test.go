@@ -1,14 +1,22 @@
 package symbols
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"testing"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags/ctagstest"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
 	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/testutil"
 	log15 "gopkg.in/inconshreveable/log15.v2"
@@ -54,7 +62,7 @@ func BenchmarkSearch(b *testing.B) {
 					b.Fatal(err)
 				}
 				defer os.Remove(tempFile.Name())
-				err = service.writeAllSymbolsToNewDB(ctx, tempFile.Name(), test.Repo, test.CommitID)
+				err = service.writeAllSymbolsToNewDB(ctx, tempFile.Name(), test.Repo, test.CommitID, parseOptions{})
 				if err != nil {
 					b.Fatal(err)
 				}
@@ -86,3 +94,139 @@ func BenchmarkSearch(b *testing.B) {
 		runQueryTest(test)
 	}
 }
+
+// BenchmarkFilterSymbols measures searches of a commit with many symbols,
+// without ctags or network access. A search without conditions must read
+// only its limit of symbols in order, not sort them all.
+func BenchmarkFilterSymbols(b *testing.B) {
+	const files, symbolsPerFile = 2000, 50
+	parser := &ctagstest.Parser{}
+	for i := 0; i < symbolsPerFile; i++ {
+		parser.Default = append(parser.Default, ctags.Entry{Name: fmt.Sprintf("sym%d", i), Line: symbolsPerFile - i, Kind: "func", Language: "Go"})
+	}
+	tarFiles := make(map[string]string, files)
+	for i := 0; i < files; i++ {
+		tarFiles[fmt.Sprintf("dir%d/file%d.go", i%10, i)] = "package a\n"
+	}
+	service := Service{
+		FetchTar: func(context.Context, gitserver.Repo, api.CommitID) (io.ReadCloser, error) {
+			return createTar(tarFiles)
+		},
+		NewParser: parser.New,
+		fetchSem:  make(chan int, 1),
+	}
+	if err := service.startParsers(); err != nil {
+		b.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "symbols")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dbFile := path.Join(dir, "symbols.db")
+	if err := service.writeAllSymbolsToNewDB(context.Background(), dbFile, "r", "c", parseOptions{}); err != nil {
+		b.Fatal(err)
+	}
+	db, err := sqlx.Open("sqlite3_with_pcre", dbFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, args := range []protocol.SearchArgs{
+		{First: 10},
+		{First: 500},
+		{Query: "^sym7$", First: 10},
+		{Query: "sym1", First: 100},
+	} {
+		b.Run(fmt.Sprintf("query=%q first=%d", args.Query, args.First), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if _, err := filterSymbols(context.Background(), db, args, func(protocol.Symbol) error { return nil }); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupByFile(t *testing.T) {
+	a1 := protocol.Symbol{Name: "a1", Path: "a.go"}
+	a2 := protocol.Symbol{Name: "a2", Path: "a.go"}
+	b := protocol.Symbol{Name: "b", Path: "b.go"}
+
+	got := groupByFile([]protocol.Symbol{a1, a2, b})
+	want := protocol.SearchFilesResult{Files: []protocol.FileSymbols{
+		{Path: "a.go", Symbols: []protocol.Symbol{a1, a2}},
+		{Path: "b.go", Symbols: []protocol.Symbol{b}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got := groupByFile(nil); got.Files != nil {
+		t.Errorf("got %+v for no symbols, want no files", got)
+	}
+}
+
+func TestSymbolStream(t *testing.T) {
+	for _, result := range []protocol.SearchResult{
+		{},
+		{Symbols: []protocol.Symbol{{Name: "a", Path: "a.go", Line: 1}}},
+		{Symbols: []protocol.Symbol{{Name: "a", Path: "a.go", Line: 1}, {Name: "b", Path: "b.go", Line: 2, Kind: "func"}}},
+		{SkippedFiles: 3},
+		{Symbols: []protocol.Symbol{{Name: "a", Path: "a.go", Line: 1}}, SkippedFiles: 3},
+		{Symbols: []protocol.Symbol{{Name: "a", Path: "a.go", Line: 1}}, SkippedFiles: 3, Truncated: []string{protocol.TruncatedFileCount, protocol.TruncatedLimit}},
+		{Truncated: []string{protocol.TruncatedTimeout}},
+		{Symbols: []protocol.Symbol{{Name: "a", Path: "a.go", Line: 1}}, NextPageToken: "abc"},
+		{NoParseableFiles: true},
+	} {
+		var got bytes.Buffer
+		stream := &symbolStream{w: &got}
+		for _, symbol := range result.Symbols {
+			if err := stream.write(symbol); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := stream.close(truncation{skippedFiles: result.SkippedFiles, reasons: result.Truncated, nextPage: result.NextPageToken, noParseableFiles: result.NoParseableFiles}); err != nil {
+			t.Fatal(err)
+		}
+
+		var want bytes.Buffer
+		if err := json.NewEncoder(&want).Encode(result); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("got %q, want %q", got.String(), want.String())
+		}
+	}
+}
+
+func TestService_includeURL(t *testing.T) {
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a b/c.go": "x"})
+		},
+		NewParser:   (&ctagstest.Parser{Default: []ctags.Entry{{Name: "x", Line: 12}}}).New,
+		URLBasePath: "/sourcegraph/",
+	}
+	_, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	args := protocol.SearchArgs{Repo: "github.com/a/r", CommitID: "deadbeef", First: 10}
+	result, err := service.search(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Symbols) != 1 || result.Symbols[0].URL != "" {
+		t.Fatalf("got symbols %+v, want one without a URL", result.Symbols)
+	}
+
+	args.IncludeURL = true
+	result, err = service.search(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/sourcegraph/github.com/a/r@deadbeef/-/tree/a%20b/c.go#L12"; len(result.Symbols) != 1 || result.Symbols[0].URL != want {
+		t.Errorf("got symbols %+v, want one with URL %q", result.Symbols, want)
+	}
+}
@@ -3,9 +3,13 @@ package symbols
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,6 +17,8 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/diskcache"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	"golang.org/x/sync/semaphore"
 )
 
 // Service is the symbols service.
@@ -22,15 +28,199 @@ type Service struct {
 	// determine if the error is a bad request (eg invalid repo).
 	FetchTar func(context.Context, gitserver.Repo, api.CommitID) (io.ReadCloser, error)
 
+	// FetchBlob returns an io.ReadCloser to the contents of the Git blob with
+	// the given hash in a repository. It is optional; without it the blobs
+	// endpoint is disabled.
+	FetchBlob func(ctx context.Context, repo gitserver.Repo, hash string) (io.ReadCloser, error)
+
+	// FetchFile returns an io.ReadCloser to the contents of a file in a
+	// repository at the specified commit ID. It is optional; without it the
+	// patch endpoint is disabled.
+	FetchFile func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, path string) (io.ReadCloser, error)
+
+	// ListBlobs returns the hashes of the blobs at the given paths in a
+	// repository at the specified commit ID, by path. Paths that don't exist
+	// or aren't files are left out. It is optional; without it (or FetchBlob)
+	// the files endpoint is disabled.
+	ListBlobs func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, paths []string) (map[string]string, error)
+
 	// MaxConcurrentFetchTar is the maximum number of concurrent calls allowed
 	// to FetchTar. It defaults to 15.
 	MaxConcurrentFetchTar int
 
+	// MaxConcurrentFetchTarBytes is the maximum number of bytes read from
+	// FetchTar archives that may be held in memory waiting to be parsed, summed
+	// across all concurrent fetches. Fetches wait while the budget is full.
+	// Zero means no limit.
+	MaxConcurrentFetchTarBytes int64
+
 	NewParser func() (ctags.Parser, error)
 
+	// ParseConfig describes the configuration of the parsers returned by
+	// NewParser that determines the symbols they return, such as the ctags
+	// version and the languages it parses. Cached symbols are keyed by a hash
+	// of it and of the options of the service that determine the symbols
+	// parsed (such as SkipGeneratedFiles), so that when they change commits
+	// and blobs are parsed again instead of serving symbols parsed with the
+	// old configuration.
+	ParseConfig string
+
+	// PreserveLineEndings if true passes files to parsers as they are.
+	// Otherwise CRLF and lone CR line endings are replaced by LF and a missing
+	// final newline is added first, so that symbol line numbers are correct
+	// whatever the line ending style and parser.
+	PreserveLineEndings bool
+
+	// ListKinds returns the kinds of symbols ctags reports for each language.
+	// It is called once by Start. It is optional; without it the kinds
+	// endpoint is disabled.
+	ListKinds func() (map[string][]ctags.Kind, error)
+
+	// DropKinds are kinds of symbols (as in protocol.Symbol.Kind) that are
+	// left out of parse results before they are cached or returned, such as
+	// local variables. A search may re-include them with
+	// SearchArgs.IncludeKinds, at the cost of parsing the commit again into a
+	// separate database.
+	DropKinds []string
+
+	// SkipGeneratedFiles skips generated files when parsing a commit: files
+	// matching GeneratedFilePatterns, and files starting with a marker such as
+	// "// Code generated ... DO NOT EDIT.".
+	SkipGeneratedFiles bool
+
+	// GeneratedFilePatterns are path.Match patterns of generated files,
+	// matched against the file name (or the whole path, if the pattern has a
+	// slash). It defaults to DefaultGeneratedFilePatterns.
+	GeneratedFilePatterns []string
+
+	// FollowGitignore skips the files of a commit that are ignored by the
+	// .gitignore files of their directories (such as checked in build
+	// output) when parsing it.
+	FollowGitignore bool
+
 	// NumParserProcesses is the maximum number of ctags parser child processes to run.
 	NumParserProcesses int
 
+	// MaxConcurrentParses is the maximum number of files (or batches of
+	// files, see ParseBatchSize) parsed at once. It can be lower than
+	// NumParserProcesses to throttle parsing (such as when ctags is I/O
+	// bound or memory is short) without shrinking the pool. It defaults to
+	// the number of parser processes.
+	MaxConcurrentParses int
+
+	// ParseBatchSize if greater than 1 is the maximum number of files of a
+	// commit sent to a parser at once (see ctags.BatchParser), which saves a
+	// round trip to ctags for every file. Files are only batched while they
+	// are fetched faster than they are parsed. Otherwise, and for the files
+	// of the blobs, files and patch endpoints, each file is parsed on its
+	// own.
+	ParseBatchSize int
+
+	// ParserSpawnBackoff is how long to wait before trying again when a
+	// parser could not be started in place of one that failed. It doubles with
+	// every consecutive failure up to MaxParserSpawnBackoff, and resets once a
+	// parser starts. While it fails the health check reports the service as
+	// degraded. It defaults to 1 second.
+	ParserSpawnBackoff time.Duration
+
+	// MaxParserSpawnBackoff is the maximum of ParserSpawnBackoff. It defaults
+	// to 1 minute.
+	MaxParserSpawnBackoff time.Duration
+
+	// MaxParseQueueDepth when non-zero rejects searches of uncached commits
+	// with 429 Too Many Requests while every parser is busy and at least this
+	// many parse jobs are waiting for one.
+	MaxParseQueueDepth int
+
+	// ParseQueueTimeout when non-zero is the maximum time a file may wait for a
+	// parser. When it is exceeded the parse of the whole commit is aborted and
+	// searches fail with 503 Service Unavailable.
+	ParseQueueTimeout time.Duration
+
+	// ParseCheckpointFiles when non-zero makes the parse of a commit commit
+	// its progress to disk after every ParseCheckpointFiles files, so that a
+	// parse interrupted (e.g. by a restart) resumes where it left off instead
+	// of starting over.
+	ParseCheckpointFiles int
+
+	// MaxFilesPerCommit when non-zero is the maximum number of files parsed
+	// in a commit. The parse of a commit with more files stops after this
+	// many (in path order), and search results report the number of files
+	// that were skipped (as in protocol.SearchResult.SkippedFiles).
+	MaxFilesPerCommit int
+
+	// SlowParseThreshold when non-zero logs every repository parse that takes
+	// at least this long, along with the slowest file in it.
+	SlowParseThreshold time.Duration
+
+	// MaxRequestSymbolBytes when non-zero is the approximate maximum memory
+	// the symbols accumulated by a single request may occupy. Requests that
+	// exceed it are aborted with 503 Service Unavailable. Searches in the
+	// default format are exempt, however many symbols they return, because
+	// their symbols are written out as they are read rather than
+	// accumulated; so are counts. MaxResponseBytes can bound those instead.
+	MaxRequestSymbolBytes int64
+
+	// MaxResponseBytes when non-zero is the approximate maximum number of
+	// bytes of symbols (uncompressed, regardless of the compression of the
+	// response) a search responds with. Searches that find more return the
+	// symbols that fit, truncated with protocol.TruncatedResponseSize.
+	MaxResponseBytes int64
+
+	// URLBasePath is the path prefix the app is served under (the BASE_PATH
+	// of the frontend, such as "/sourcegraph"), which the URLs of symbols
+	// start with (see protocol.SearchArgs.IncludeURL).
+	URLBasePath string
+
+	// MemoryBudgetBytes when non-zero is the memory the service is projected
+	// to use at most: ParserMemoryLimitBytes for each parser process, the
+	// archive bytes fetched and waiting to be parsed, and the symbols held by
+	// requests. While the projection is over it requests are shed with 503
+	// Service Unavailable, and requests whose symbols take it over are
+	// aborted with 503.
+	MemoryBudgetBytes int64
+
+	// ParserMemoryLimitBytes is the memory each parser process is limited
+	// to, which is reserved from MemoryBudgetBytes for every process.
+	// NewParser must enforce it on the processes it starts (see
+	// ctags.ParserOptions.MemoryLimit). A parser that fails because it hit
+	// the limit is closed and replaced like any failed parser, and counted
+	// by the symbols_memory_parser_limit_exceeded metric.
+	ParserMemoryLimitBytes int64
+
+	// NoParseableFilesStatus if non-zero is the HTTP status (such as 404 Not
+	// Found) that searches of a commit without parseable files respond with,
+	// instead of an empty result with NoParseableFiles set (see
+	// protocol.SearchResult.NoParseableFiles).
+	NoParseableFilesStatus int
+
+	// PushDebounce is how long the push endpoint waits for further
+	// notifications for a repository before parsing its newest commit. It
+	// defaults to 10 seconds.
+	PushDebounce time.Duration
+
+	// IdleTimeout when non-zero closes the channel returned by Idle once no
+	// requests (other than health checks) have been served and no background
+	// parses have run for this long, so that the service can exit and be
+	// scaled to zero.
+	IdleTimeout time.Duration
+
+	// MaxRequestsPerCommit if non-zero is the maximum number of requests for
+	// the symbols of the same commit of a repository that are served at
+	// once. Further requests are rejected with 429 Too Many Requests.
+	MaxRequestsPerCommit int
+
+	// WriteTimeout if non-zero is how long a write of a response may block
+	// before the client is considered stalled and the response abandoned, so
+	// that a client that stops reading doesn't hold a request (and in
+	// streaming mode, its symbols) forever. It only takes effect if the
+	// server's ConnContext is Service.ConnContext.
+	WriteTimeout time.Duration
+
+	// AccessLogFormat when non-empty writes a line to stderr for every
+	// request, in the format AccessLogCommon or AccessLogJSON.
+	AccessLogFormat string
+
 	// Path is the directory in which to store the cache.
 	Path string
 
@@ -40,6 +230,52 @@ type Service struct {
 	// MaxCacheSizeBytes.
 	MaxCacheSizeBytes int64
 
+	// CacheTTL if non-zero is how long a cache item may go unused before it
+	// is evicted regardless of the size of the cache, such as the symbols of
+	// commits on abandoned branches.
+	CacheTTL time.Duration
+
+	// CacheSnapshot if non-empty is the path of a snapshot of exported
+	// symbols databases (see loadCacheSnapshot) to load into the cache at
+	// startup, so that a new replica starts with the symbols of popular
+	// commits. A missing or corrupt snapshot is skipped.
+	CacheSnapshot string
+
+	// CacheLockTimeout if non-zero makes writes to the cache take a lock
+	// file per item, for replicas that share Path (such as on NFS): only one
+	// of them parses a commit at a time, and the others wait and then use its
+	// symbols. A lock not refreshed for longer than CacheLockTimeout is
+	// considered left behind by a crashed replica and broken (see
+	// diskcache.Store.LockTimeout).
+	CacheLockTimeout time.Duration
+
+	// Authorize if non-nil is called with each request for the symbols (or
+	// anything else) of a repository before the repository is fetched,
+	// parsed or looked up in the cache. If it returns false the request is
+	// denied with 403 Forbidden. It lets a deployment check that the caller
+	// may access the repository, e.g. by a token in the request's headers;
+	// if it is nil all callers may access all repositories.
+	Authorize func(r *http.Request, repo api.RepoName) bool
+
+	// repoFilter holds the *RepoFilter deciding which repositories may be
+	// indexed. It is set via SetRepoFilter and may be replaced at any time.
+	repoFilter atomic.Value
+
+	// warmJobs are the background parses started by asynchronous searches.
+	warmJobs warmJobs
+
+	// pushes are the push notifications waiting to start a warm job.
+	pushes pushes
+
+	// commitRequests counts the requests being served per commit.
+	commitRequests commitRequests
+
+	// idle tracks activity for the idle shutdown.
+	idle idle
+
+	// memory accounts for the projected memory against MemoryBudgetBytes.
+	memory memoryBudget
+
 	// cache is the disk backed cache.
 	cache *diskcache.Store
 
@@ -47,12 +283,58 @@ type Service struct {
 	// semaphore size is controlled by MaxConcurrentFetchTar
 	fetchSem chan int
 
+	// fetchBytesSem limits the bytes held from FetchTar archives. The
+	// semaphore size is controlled by MaxConcurrentFetchTarBytes.
+	fetchBytesSem *semaphore.Weighted
+
 	// pool of ctags parser child processes
 	parsers chan ctags.Parser
+
+	// parseSem limits the number of concurrent parses to
+	// MaxConcurrentParses. It is nil if that is not lower than the number of
+	// parsers, which then are the limit.
+	parseSem chan struct{}
+
+	// spawns tracks failed parsers and the backoff of replacing them.
+	spawns parserSpawns
+
+	// parseQueue tracks jobs waiting for a parser from the pool.
+	parseQueue parseQueue
+
+	// accessLogOut is where the access log is written, if not stderr.
+	accessLogOut io.Writer
+
+	// cacheVersion is the version of the cache keys: symbolsDBVersion, and
+	// the hash of the parse configuration (see parseConfig).
+	cacheVersion string
+
+	// activePartialParses is the set of the paths of the databases of
+	// checkpointed parses in progress (see writeResumableDB).
+	activePartialParses sync.Map
+
+	// kinds is the result of ListKinds, or nil if it is unavailable.
+	kinds *protocol.KindsResult
 }
 
 // Start must be called before any requests are handled.
 func (s *Service) Start() error {
+	if s.GeneratedFilePatterns == nil {
+		s.GeneratedFilePatterns = DefaultGeneratedFilePatterns
+	}
+	if err := validateGeneratedFilePatterns(s.GeneratedFilePatterns); err != nil {
+		return err
+	}
+
+	if s.URLBasePath != "" && !strings.HasPrefix(s.URLBasePath, "/") {
+		return fmt.Errorf("invalid URL base path %q (must start with \"/\")", s.URLBasePath)
+	}
+
+	if s.ParserSpawnBackoff == 0 {
+		s.ParserSpawnBackoff = time.Second
+	}
+	if s.MaxParserSpawnBackoff == 0 {
+		s.MaxParserSpawnBackoff = time.Minute
+	}
 	if err := s.startParsers(); err != nil {
 		return err
 	}
@@ -61,13 +343,66 @@ func (s *Service) Start() error {
 		s.MaxConcurrentFetchTar = 15
 	}
 	s.fetchSem = make(chan int, s.MaxConcurrentFetchTar)
+	if s.PushDebounce == 0 {
+		s.PushDebounce = 10 * time.Second
+	}
+	if s.MaxConcurrentFetchTarBytes > 0 {
+		s.fetchBytesSem = semaphore.NewWeighted(s.MaxConcurrentFetchTarBytes)
+	}
+	if s.MemoryBudgetBytes > 0 {
+		reserved := s.ParserMemoryLimitBytes * int64(cap(s.parsers))
+		if reserved >= s.MemoryBudgetBytes {
+			return fmt.Errorf("the memory budget of %d bytes leaves no room beyond the %d bytes of the parser processes", s.MemoryBudgetBytes, reserved)
+		}
+		if reserved == 0 {
+			log.Printf("the memory budget doesn't count the parser processes, which have no memory limit")
+		}
+		s.memory.set(s.MemoryBudgetBytes, reserved)
+	}
 
+	s.cacheVersion = parseConfigVersion(s.parseConfig())
 	s.cache = &diskcache.Store{
 		Dir:               s.Path,
 		Component:         "symbols",
 		BackgroundTimeout: 20 * time.Minute,
+		RecordKeys:        true,
+		LockTimeout:       s.CacheLockTimeout,
+	}
+
+	// A crash while writing a symbols database leaves behind a temporary file
+	// (and possibly a sqlite journal next to it). These are never read, but a
+	// stale journal could be replayed onto the next database written to the
+	// same temporary path, so remove them before serving any requests.
+	if removed, err := s.cache.RemoveTempFiles(); err != nil {
+		log.Printf("failed to remove temporary cache files: %s", err)
+	} else if removed > 0 {
+		log.Printf("removed %d temporary cache files left behind by a previous run", removed)
+	}
+
+	if removed, _, err := s.prunePartialParses(0); err != nil {
+		log.Printf("failed to remove stale interrupted parses: %s", err)
+	} else if removed > 0 {
+		log.Printf("removed %d interrupted parses older than %s", removed, maxPartialParseAge)
+	}
+
+	if s.CacheSnapshot != "" {
+		if loaded, err := s.loadCacheSnapshot(context.Background()); err != nil {
+			log.Printf("failed to load the symbols cache snapshot %s (loaded %d databases): %s", s.CacheSnapshot, loaded, err)
+		} else if loaded > 0 {
+			log.Printf("loaded %d symbols databases from the cache snapshot %s", loaded, s.CacheSnapshot)
+		}
+	}
+
+	if s.ListKinds != nil {
+		if kinds, err := s.ListKinds(); err != nil {
+			log.Printf("failed to list ctags kinds: %s", err)
+		} else {
+			s.kinds = newKindsResult(kinds)
+		}
 	}
+
 	go s.watchAndEvict()
+	s.startIdleTimer()
 
 	return nil
 }
@@ -81,12 +416,59 @@ func (s *Service) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/search", s.handleSearch)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/blobs", s.handleBlobs)
+	mux.HandleFunc("/patch", s.handlePatch)
+	mux.HandleFunc("/files", s.handleFiles)
+	mux.HandleFunc("/push", s.handlePush)
+	mux.HandleFunc("/range", s.handleRange)
+	mux.HandleFunc("/definition", s.handleDefinition)
+	mux.HandleFunc("/export", s.handleExport)
+	mux.HandleFunc("/fingerprint", s.handleFingerprint)
+	mux.HandleFunc("/kinds", s.handleKinds)
+	mux.HandleFunc("/cached", s.handleCached)
 	mux.HandleFunc("/healthz", s.handleHealthCheck)
 
-	return mux
+	return s.withIdleTracking(s.withAccessLog(s.withWriteTimeout(s.withMemoryBudget(mux))))
+}
+
+// SetRepoFilter replaces the filter deciding which repositories the service
+// will index. It is safe to call while requests are being served. A nil
+// filter allows all repositories.
+func (s *Service) SetRepoFilter(f *RepoFilter) {
+	s.repoFilter.Store(f)
+}
+
+// repoAllowed reports whether the current repository filter allows repo.
+func (s *Service) repoAllowed(repo api.RepoName) bool {
+	f, _ := s.repoFilter.Load().(*RepoFilter)
+	return f.Allowed(repo)
+}
+
+// checkRepoAccess responds with 403 Forbidden and returns false if the caller
+// of r may not access repo (see Authorize) or the service doesn't index it. It
+// must be called before anything of repo is fetched, parsed or read from the
+// cache.
+func (s *Service) checkRepoAccess(w http.ResponseWriter, r *http.Request, repo api.RepoName) bool {
+	if s.Authorize != nil && !s.Authorize(r, repo) {
+		// Don't tell whether the repository exists or is indexed.
+		http.Error(w, "forbidden", http.StatusForbidden)
+		authorizationDenials.Inc()
+		return false
+	}
+	if !s.repoAllowed(repo) {
+		http.Error(w, "repository is not indexed by the symbols service", http.StatusForbidden)
+		return false
+	}
+	return true
 }
 
 func (s *Service) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	if err := s.parserPoolHealth(); err != nil {
+		http.Error(w, "Degraded: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 
 	_, err := w.Write([]byte("Ok"))
@@ -96,15 +478,32 @@ func (s *Service) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 }
 
 // watchAndEvict is a loop which periodically checks the size of the cache and
-// evicts/deletes items if the store gets too large.
+// evicts/deletes items if the store gets too large, or have not been used for
+// longer than CacheTTL. The databases of interrupted parses count towards the
+// size of the cache; they are removed once they are older than
+// maxPartialParseAge, or (oldest first) when they alone would take the cache
+// over MaxCacheSizeBytes.
 func (s *Service) watchAndEvict() {
-	if s.MaxCacheSizeBytes == 0 {
-		return
-	}
-
 	for {
 		time.Sleep(10 * time.Second)
-		stats, err := s.cache.Evict(s.MaxCacheSizeBytes)
+		_, partialSize, err := s.prunePartialParses(s.MaxCacheSizeBytes)
+		if err != nil {
+			log.Printf("failed to remove interrupted parses: %s", err)
+		}
+		partialParseBytes.Set(float64(partialSize))
+		if s.CacheTTL > 0 {
+			stats, err := s.cache.EvictExpired(s.CacheTTL)
+			if err != nil {
+				log.Printf("failed to EvictExpired: %s", err)
+			} else {
+				cacheSizeBytes.Set(float64(stats.CacheSize))
+				expirations.Add(float64(stats.Evicted))
+			}
+		}
+		if s.MaxCacheSizeBytes == 0 {
+			continue
+		}
+		stats, err := s.cache.Evict(s.MaxCacheSizeBytes - partialSize)
 		if err != nil {
 			log.Printf("failed to Evict: %s", err)
 			continue
@@ -127,9 +526,23 @@ var (
 		Name:      "evictions",
 		Help:      "The total number of items evicted from the cache.",
 	})
+	expirations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "store",
+		Name:      "expirations",
+		Help:      "The total number of items evicted from the cache because they were not used for longer than the TTL.",
+	})
+	authorizationDenials = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "request",
+		Name:      "authorization_denials",
+		Help:      "The total number of requests denied because Authorize did not allow the caller to access the repository.",
+	})
 )
 
 func init() {
 	prometheus.MustRegister(cacheSizeBytes)
 	prometheus.MustRegister(evictions)
+	prometheus.MustRegister(expirations)
+	prometheus.MustRegister(authorizationDenials)
 }
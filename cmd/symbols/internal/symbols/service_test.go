@@ -4,9 +4,12 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
@@ -14,9 +17,13 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags/ctagstest"
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
 	"github.com/sourcegraph/sourcegraph/internal/search"
@@ -75,7 +82,6 @@ func TestIsLiteralEquality(t *testing.T) {
 
 func TestService(t *testing.T) {
 	MustRegisterSqlite3WithPcre()
-
 	tmpDir, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Fatal(err)
@@ -146,6 +152,26 @@ func TestService(t *testing.T) {
 			args: search.SymbolsParameters{ExcludePattern: "a.js", IsCaseSensitive: true, First: 10},
 			want: protocol.SearchResult{},
 		},
+		"caseinsensitivenameexact": {
+			args: search.SymbolsParameters{Name: "X", First: 10},
+			want: protocol.SearchResult{Symbols: []protocol.Symbol{x}},
+		},
+		"casesensitivenameexact": {
+			args: search.SymbolsParameters{Name: "X", NameCaseSensitive: true, First: 10},
+			want: protocol.SearchResult{},
+		},
+		"nameprefix": {
+			args: search.SymbolsParameters{Name: "Y", NameMatch: protocol.NameMatchPrefix, First: 10},
+			want: protocol.SearchResult{Symbols: []protocol.Symbol{y}},
+		},
+		"nameregex": {
+			args: search.SymbolsParameters{Name: "^[xy]$", NameMatch: protocol.NameMatchRegex, NameCaseSensitive: true, First: 10},
+			want: protocol.SearchResult{Symbols: []protocol.Symbol{x, y}},
+		},
+		"nameandquery": {
+			args: search.SymbolsParameters{Query: "x", Name: "y", First: 10},
+			want: protocol.SearchResult{},
+		},
 	}
 	for label, test := range tests {
 		t.Run(label, func(t *testing.T) {
@@ -158,6 +184,662 @@ func TestService(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("groupbyfile", func(t *testing.T) {
+		result, err := client.SearchByFile(context.Background(), search.SymbolsParameters{First: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := protocol.SearchFilesResult{Files: []protocol.FileSymbols{{Path: "a.js", Symbols: []protocol.Symbol{x, y}}}}
+		if !reflect.DeepEqual(*result, want) {
+			t.Errorf("got %+v, want %+v", *result, want)
+		}
+	})
+
+	t.Run("lsp", func(t *testing.T) {
+		result, err := client.SearchDocumentSymbols(context.Background(), search.SymbolsParameters{First: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Files) != 1 || result.Files[0].Path != "a.js" || len(result.Files[0].Symbols) != 2 {
+			t.Errorf("got %+v, want the 2 symbols of a.js", *result)
+		}
+
+		resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Format: "xml"})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d for an invalid format, want %d", resp.StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("tree", func(t *testing.T) {
+		result, err := client.SearchTree(context.Background(), search.SymbolsParameters{First: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := protocol.SearchTreeResult{Files: []protocol.FileSymbolTree{{Path: "a.js", Symbols: []protocol.SymbolNode{{Symbol: x}, {Symbol: y}}}}}
+		if !reflect.DeepEqual(*result, want) {
+			t.Errorf("got %+v, want %+v", *result, want)
+		}
+	})
+
+	t.Run("invalidname", func(t *testing.T) {
+		for _, args := range []protocol.SearchArgs{
+			{Name: "(", NameMatch: protocol.NameMatchRegex},
+			{Name: "x", NameMatch: "fuzzy"},
+		} {
+			resp := postJSON(t, server.URL+"/search", args)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("got status %d for %+v, want %d", resp.StatusCode, args, http.StatusBadRequest)
+			}
+		}
+	})
+
+	t.Run("count", func(t *testing.T) {
+		count, err := client.Count(context.Background(), search.SymbolsParameters{Query: "x|y", First: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (protocol.SearchCount{Count: 2, Kinds: map[string]int{"": 2}}); !reflect.DeepEqual(*count, want) {
+			t.Errorf("got %+v, want %+v", *count, want)
+		}
+
+		resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Query: "x", Count: true})
+		resp.Body.Close()
+		if got := resp.Header.Get("X-Symbols-Count"); got != "1" {
+			t.Errorf("got X-Symbols-Count %q, want 1", got)
+		}
+	})
+}
+
+func TestService_async(t *testing.T) {
+	release := make(chan struct{})
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			<-release
+			return createTar(map[string]string{"a.js": "var x = 1"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x"}, nil
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	post := func(args protocol.SearchArgs) *http.Response {
+		return postJSON(t, server.URL+"/search", args)
+	}
+	status := func(token, wait string) protocol.SearchStatus {
+		resp, err := http.Get(server.URL + "/status?token=" + token + "&wait=" + wait)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d from /status", resp.StatusCode)
+		}
+		var s protocol.SearchStatus
+		if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	args := protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10, Async: true}
+	resp := post(args)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+	var pending protocol.SearchPending
+	if err := json.NewDecoder(resp.Body).Decode(&pending); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if s := status(pending.Token, "0s"); s.Ready {
+		t.Fatal("expected parse to still be pending")
+	}
+	close(release)
+	if s := status(pending.Token, "10s"); !s.Ready || s.Error != "" {
+		t.Fatalf("expected parse to be ready, got %+v", s)
+	}
+
+	resp = post(args)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	var result protocol.SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if want := []protocol.Symbol{{Name: "x", Path: "a.js"}}; !reflect.DeepEqual(result.Symbols, want) {
+		t.Errorf("got %+v, want %+v", result.Symbols, want)
+	}
+}
+
+func TestService_asyncStatusAccess(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			<-release
+			return createTar(map[string]string{"a.js": "var x = 1"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x"}, nil
+		},
+		Authorize: func(r *http.Request, repo api.RepoName) bool {
+			return r.Header.Get("X-Caller") == "trusted"
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	start := func() string {
+		body, _ := json.Marshal(protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10, Async: true})
+		req, _ := http.NewRequest("POST", server.URL+"/search", bytes.NewReader(body))
+		req.Header.Set("X-Caller", "trusted")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var pending protocol.SearchPending
+		if err := json.NewDecoder(resp.Body).Decode(&pending); err != nil {
+			t.Fatal(err)
+		}
+		return pending.Token
+	}
+	token := start()
+	if again := start(); again != token {
+		t.Errorf("got token %q for the running job, want %q", again, token)
+	}
+
+	for caller, want := range map[string]int{"trusted": http.StatusOK, "other": http.StatusForbidden} {
+		req, _ := http.NewRequest("GET", server.URL+"/status?token="+token, nil)
+		req.Header.Set("X-Caller", caller)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s caller: got status %d, want %d", caller, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestService_blobs(t *testing.T) {
+	var fetched []string
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return nil, errors.New("FetchTar should not be called")
+		},
+		FetchBlob: func(ctx context.Context, repo gitserver.Repo, hash string) (io.ReadCloser, error) {
+			fetched = append(fetched, hash)
+			if repo.Name != "r" {
+				return nil, errors.New("blob not found")
+			}
+			return ioutil.NopCloser(strings.NewReader("var x = 1")), nil
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x"}, nil
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	hash := strings.Repeat("a", 40)
+	get := func(p string) protocol.BlobsResult {
+		resp := postJSON(t, server.URL+"/blobs", protocol.BlobsArgs{Repo: "r", Blobs: []protocol.BlobArg{{Hash: hash, Path: p}}})
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d", resp.StatusCode)
+		}
+		var result protocol.BlobsResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	want := protocol.BlobsResult{Blobs: []protocol.BlobSymbols{{Hash: hash, Path: "a.js", Symbols: []protocol.Symbol{{Name: "x", Path: "a.js"}}}}}
+	for i := 0; i < 2; i++ {
+		if got := get("a.js"); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+	if len(fetched) != 1 {
+		t.Errorf("expected blob to be fetched once, got %d fetches", len(fetched))
+	}
+
+	// The cached symbols of the blob are not served for another repository,
+	// which doesn't have it.
+	resp := postJSON(t, server.URL+"/blobs", protocol.BlobsArgs{Repo: "other", Blobs: []protocol.BlobArg{{Hash: hash, Path: "a.js"}}})
+	var other protocol.BlobsResult
+	err := json.NewDecoder(resp.Body).Decode(&other)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.Blobs) != 1 || len(other.Blobs[0].Symbols) != 0 || other.Blobs[0].Error == "" {
+		t.Errorf("got %+v for another repository, want an error", other)
+	}
+
+	resp = postJSON(t, server.URL+"/blobs", protocol.BlobsArgs{Repo: "r", Blobs: []protocol.BlobArg{{Hash: "--output=x", Path: "a.js"}}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for invalid hash, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestService_requestMemory(t *testing.T) {
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.js": "var x = 1", "b.js": "var x = 2", "c.js": "var x = 3"})
+		},
+		FetchBlob: func(ctx context.Context, repo gitserver.Repo, hash string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("var x = 1")), nil
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x", "y"}, nil
+		},
+		// Room for the symbols of one file, but not two.
+		MaxRequestSymbolBytes: 3 * symbolSize(protocol.Symbol{Name: "x", Path: "a.js"}),
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	post := func(blobs ...protocol.BlobArg) int {
+		resp := postJSON(t, server.URL+"/blobs", protocol.BlobsArgs{Repo: "r", Blobs: blobs})
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	aborts := testutil.ToFloat64(requestMemoryAborts)
+	if status := post(protocol.BlobArg{Hash: strings.Repeat("a", 40), Path: "a.js"}); status != http.StatusOK {
+		t.Errorf("got status %d for a single blob, want %d", status, http.StatusOK)
+	}
+	if status := post(protocol.BlobArg{Hash: strings.Repeat("a", 40), Path: "a.js"}, protocol.BlobArg{Hash: strings.Repeat("b", 40), Path: "b.js"}); status != http.StatusServiceUnavailable {
+		t.Errorf("got status %d for two blobs, want %d", status, http.StatusServiceUnavailable)
+	}
+	if n := testutil.ToFloat64(requestMemoryAborts) - aborts; n != 1 {
+		t.Errorf("got %v aborts, want 1", n)
+	}
+
+	// A streamed search doesn't accumulate its symbols, so it isn't limited,
+	// unlike the same search grouped by file.
+	resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10})
+	var result protocol.SearchResult
+	err := json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d and error %v for a streamed search, want %d", resp.StatusCode, err, http.StatusOK)
+	}
+	if len(result.Symbols) != 6 || len(result.Truncated) != 0 {
+		t.Errorf("got %d symbols truncated by %v from a streamed search, want all 6", len(result.Symbols), result.Truncated)
+	}
+	resp = postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10, GroupByFile: true})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got status %d for a search grouped by file, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestService_fetchBytesBudget(t *testing.T) {
+	files := map[string]string{"a.js": "var x = 1", "b.js": "var x = 2", "c.js": "x"}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(files)
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x"}, nil
+		},
+		// Smaller than most files, which must still be parsed one at a time.
+		MaxConcurrentFetchTarBytes: 4,
+		NumParserProcesses:         1,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	client := symbolsclient.Client{URL: server.URL}
+	result, err := client.Search(context.Background(), search.SymbolsParameters{Repo: "r", CommitID: "c", First: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Symbols) != len(files) {
+		t.Errorf("got %d symbols, want %d", len(result.Symbols), len(files))
+	}
+	if n := testutil.ToFloat64(fetchBytesInFlight); n != 0 {
+		t.Errorf("got %v fetch bytes in flight after the search, want 0", n)
+	}
+}
+
+func TestService_parseQueueTimeout(t *testing.T) {
+	// The first search holds the only parser for longer than the second
+	// search's file may wait for it.
+	release := make(chan struct{})
+	time.AfterFunc(100*time.Millisecond, func() { close(release) })
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.js": "var x = 1"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return blockingParser(release), nil
+		},
+		NumParserProcesses: 1,
+		ParseQueueTimeout:  10 * time.Millisecond,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	statuses := make(chan int, 2)
+	for _, commit := range []api.CommitID{"c1", "c2"} {
+		body, err := json.Marshal(protocol.SearchArgs{Repo: "r", CommitID: commit, First: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			resp, err := http.Post(server.URL+"/search", "application/json", bytes.NewReader(body))
+			if err != nil {
+				statuses <- 0
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	got := map[int]int{}
+	for i := 0; i < 2; i++ {
+		got[<-statuses]++
+	}
+	if want := map[int]int{http.StatusOK: 1, http.StatusServiceUnavailable: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got statuses %v, want %v", got, want)
+	}
+}
+
+func TestService_maxConcurrentParses(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 8; i++ {
+		files[fmt.Sprintf("%d.js", i)] = "var x = 1"
+	}
+	var running, maxRunning int32
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(files)
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return parserFunc(func(name string, content []byte) ([]ctags.Entry, error) {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					max := atomic.LoadInt32(&maxRunning)
+					if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				return []ctags.Entry{{Name: "x", Kind: "variable", Line: 1}}, nil
+			}), nil
+		},
+		NumParserProcesses:  4,
+		MaxConcurrentParses: 2,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	client := symbolsclient.Client{URL: server.URL}
+	result, err := client.Search(context.Background(), search.SymbolsParameters{Repo: "r", CommitID: "c", First: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Symbols) != len(files) {
+		t.Errorf("got %d symbols, want %d", len(result.Symbols), len(files))
+	}
+	if maxRunning > 2 {
+		t.Errorf("got %d concurrent parses, want at most 2", maxRunning)
+	}
+	if got := service.parseConcurrency(); got != 2 {
+		t.Errorf("got parse concurrency %d, want 2", got)
+	}
+}
+
+func TestService_parseConfig(t *testing.T) {
+	MustRegisterSqlite3WithPcre()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var parses int32
+	searchWith := func(parseConfig string) {
+		t.Helper()
+		service := &Service{
+			FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+				return createTar(map[string]string{"a.js": "var x = 1"})
+			},
+			NewParser: func() (ctags.Parser, error) {
+				return parserFunc(func(name string, content []byte) ([]ctags.Entry, error) {
+					atomic.AddInt32(&parses, 1)
+					return []ctags.Entry{{Name: "x", Kind: "variable", Line: 1}}, nil
+				}), nil
+			},
+			ParseConfig: parseConfig,
+			Path:        dir,
+		}
+		if err := service.Start(); err != nil {
+			t.Fatal(err)
+		}
+		server := httptest.NewServer(service.Handler())
+		defer server.Close()
+		client := symbolsclient.Client{URL: server.URL}
+		if _, err := client.Search(context.Background(), search.SymbolsParameters{Repo: "r", CommitID: "c", First: 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The symbols parsed with one configuration are only reused with the
+	// same configuration, e.g. after a restart.
+	for _, test := range []struct {
+		parseConfig string
+		parses      int32
+	}{
+		{"ctags: 1", 1},
+		{"ctags: 1", 1},
+		{"ctags: 2", 2},
+		{"", 3},
+	} {
+		searchWith(test.parseConfig)
+		if got := atomic.LoadInt32(&parses); got != test.parses {
+			t.Errorf("after a search with config %q: got %d parses, want %d", test.parseConfig, got, test.parses)
+		}
+	}
+}
+
+func TestParseConfigOptions(t *testing.T) {
+	version := func(s *Service) string {
+		if s.GeneratedFilePatterns == nil {
+			s.GeneratedFilePatterns = DefaultGeneratedFilePatterns
+		}
+		return parseConfigVersion(s.parseConfig())
+	}
+	base := version(&Service{ParseConfig: "ctags: 1"})
+
+	// Every option that changes the symbols parsed from a commit changes the
+	// version of the cache keys.
+	for name, s := range map[string]*Service{
+		"skip generated files":    {ParseConfig: "ctags: 1", SkipGeneratedFiles: true},
+		"follow gitignore":        {ParseConfig: "ctags: 1", FollowGitignore: true},
+		"preserve line endings":   {ParseConfig: "ctags: 1", PreserveLineEndings: true},
+		"max files per commit":    {ParseConfig: "ctags: 1", MaxFilesPerCommit: 10},
+		"generated file patterns": {ParseConfig: "ctags: 1", SkipGeneratedFiles: true, GeneratedFilePatterns: []string{"*.pb.go"}},
+	} {
+		v := version(s)
+		if v == base {
+			t.Errorf("%s: got the cache version %s of the default options", name, v)
+		}
+		if name == "generated file patterns" && v == version(&Service{ParseConfig: "ctags: 1", SkipGeneratedFiles: true}) {
+			t.Errorf("%s: got the cache version %s of the default patterns", name, v)
+		}
+	}
+
+	// Options that don't change the symbols parsed don't.
+	if v := version(&Service{ParseConfig: "ctags: 1", NumParserProcesses: 4, MaxCacheSizeBytes: 1}); v != base {
+		t.Errorf("got cache version %s, want %s", v, base)
+	}
+}
+
+func TestService_topLevelAndExported(t *testing.T) {
+	entries := map[string][]ctags.Entry{
+		"a.go": {
+			{Name: "T", Kind: "struct", Language: "Go", Line: 1},
+			{Name: "f", Kind: "field", Language: "Go", Line: 2, Parent: "T", ParentKind: "struct"},
+			{Name: "F", Kind: "field", Language: "Go", Line: 3, Parent: "T", ParentKind: "struct"},
+			{Name: "helper", Kind: "func", Language: "Go", Line: 5},
+		},
+		"b.py": {
+			{Name: "C", Kind: "class", Language: "Python", Line: 1},
+			{Name: "_private", Kind: "member", Language: "Python", Line: 2, Parent: "C", ParentKind: "class"},
+			{Name: "x", Kind: "local", Language: "Python", Line: 3, Parent: "C._private", ParentKind: "member"},
+			{Name: "_helper", Kind: "function", Language: "Python", Line: 5},
+			{Name: "main", Kind: "function", Language: "Python", Line: 7},
+		},
+	}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.go": "package a", "b.py": "class C:"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return &ctagstest.Parser{Entries: entries}, nil
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	client := symbolsclient.Client{URL: server.URL}
+	for _, test := range []struct {
+		args search.SymbolsParameters
+		want []string
+	}{
+		{search.SymbolsParameters{TopLevelOnly: true}, []string{"T", "helper", "C", "_helper", "main"}},
+		{search.SymbolsParameters{ExportedOnly: true}, []string{"T", "F", "C", "main"}},
+		{search.SymbolsParameters{TopLevelOnly: true, ExportedOnly: true}, []string{"T", "C", "main"}},
+	} {
+		test.args.Repo, test.args.CommitID, test.args.First = "r", "c", 100
+		result, err := client.Search(context.Background(), test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, symbol := range result.Symbols {
+			names = append(names, symbol.Name)
+		}
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("%+v: got %v, want %v", test.args, names, test.want)
+		}
+	}
+}
+
+func TestService_authorize(t *testing.T) {
+	var fetches int32
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			atomic.AddInt32(&fetches, 1)
+			return createTar(map[string]string{"a.js": "var x = 1"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x"}, nil
+		},
+		Authorize: func(r *http.Request, repo api.RepoName) bool {
+			return r.Header.Get("X-Token") == "secret" && repo == "public"
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	request := func(method, path, token string, args interface{}) *http.Response {
+		t.Helper()
+		body, err := json.Marshal(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Token", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	for _, test := range []struct {
+		method, path, token string
+		args                interface{}
+	}{
+		{"POST", "/search", "", protocol.SearchArgs{Repo: "public", CommitID: "c", First: 10}},
+		{"POST", "/search", "secret", protocol.SearchArgs{Repo: "private", CommitID: "c", First: 10}},
+		{"POST", "/range", "", protocol.RangeArgs{Repo: "public", CommitID: "c", Path: "a.js", StartLine: 1, EndLine: 1}},
+		{"GET", "/cached?repo=public", "", nil},
+	} {
+		resp := request(test.method, test.path, test.token, test.args)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden || strings.TrimSpace(string(body)) != "forbidden" {
+			t.Errorf("%s %s with token %q: got status %d and body %q, want 403 forbidden", test.method, test.path, test.token, resp.StatusCode, body)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 0 {
+		t.Errorf("got %d fetches for denied requests, want 0", n)
+	}
+
+	resp := request("POST", "/search", "secret", protocol.SearchArgs{Repo: "public", CommitID: "c", First: 10})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d for an authorized search, want 200", resp.StatusCode)
+	}
+}
+
+// startTestService starts service with a temporary cache directory and serves
+// it. The returned cleanup func must be called when done.
+func startTestService(t *testing.T, service *Service) (*httptest.Server, func()) {
+	t.Helper()
+	MustRegisterSqlite3WithPcre()
+
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Path = tmpDir
+	if err := service.Start(); err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(service.Handler())
+	return server, func() {
+		server.Close()
+		os.RemoveAll(tmpDir)
+	}
+}
+
+// postJSON posts payload as JSON to url.
+func postJSON(t *testing.T, url string, payload interface{}) *http.Response {
+	t.Helper()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
 }
 
 func createTar(files map[string]string) (io.ReadCloser, error) {
@@ -195,3 +877,213 @@ func (m mockParser) Parse(name string, content []byte) ([]ctags.Entry, error) {
 }
 
 func (mockParser) Close() {}
+
+// blockingParser is a parser whose Parse blocks until the channel is closed.
+type blockingParser chan struct{}
+
+func (p blockingParser) Parse(name string, content []byte) ([]ctags.Entry, error) {
+	<-p
+	return nil, nil
+}
+
+func (blockingParser) Close() {}
+
+func TestService_kinds(t *testing.T) {
+	listed := 0
+	service := &Service{
+		NewParser: func() (ctags.Parser, error) {
+			return mockParser{"x"}, nil
+		},
+		ListKinds: func() (map[string][]ctags.Kind, error) {
+			listed++
+			return map[string][]ctags.Kind{"Go": {{Letter: "f", Name: "func", Description: "functions"}}}, nil
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	want := protocol.KindsResult{Languages: map[string][]protocol.Kind{"Go": {{Letter: "f", Name: "func", Description: "functions"}}}}
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(server.URL + "/kinds")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got protocol.KindsResult
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+	if listed != 1 {
+		t.Errorf("expected kinds to be listed once, got %d", listed)
+	}
+}
+
+// entriesParser is a parser that returns its entries for every file.
+type entriesParser []ctags.Entry
+
+func (p entriesParser) Parse(name string, content []byte) ([]ctags.Entry, error) {
+	entries := make([]ctags.Entry, len(p))
+	for i, e := range p {
+		e.Path = name
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+func (entriesParser) Close() {}
+
+// parserFunc is a parser that calls the function to parse each file.
+type parserFunc func(name string, content []byte) ([]ctags.Entry, error)
+
+func (f parserFunc) Parse(name string, content []byte) ([]ctags.Entry, error) {
+	return f(name, content)
+}
+
+func (parserFunc) Close() {}
+
+func TestService_sameLineOrdering(t *testing.T) {
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"b.py": "a, b = 1, 2", "a.py": "a, b = 1, 2"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			// Deliberately not in the expected order.
+			return entriesParser{
+				{Name: "b", Line: 1, Kind: "variable"},
+				{Name: "a", Line: 1, Kind: "variable"},
+				{Name: "a", Line: 1, Kind: "member"},
+			}, nil
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	var want []protocol.Symbol
+	for _, path := range []string{"a.py", "b.py"} {
+		want = append(want,
+			protocol.Symbol{Name: "a", Path: path, Line: 1, Kind: "member"},
+			protocol.Symbol{Name: "a", Path: path, Line: 1, Kind: "variable"},
+			protocol.Symbol{Name: "b", Path: path, Line: 1, Kind: "variable"},
+		)
+	}
+	client := symbolsclient.Client{URL: server.URL}
+	result, err := client.Search(context.Background(), search.SymbolsParameters{Repo: "r", CommitID: "c", First: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Symbols, want) {
+		t.Errorf("got %+v, want %+v", result.Symbols, want)
+	}
+
+	hash := strings.Repeat("a", 40)
+	service.FetchBlob = func(ctx context.Context, repo gitserver.Repo, hash string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("a, b = 1, 2")), nil
+	}
+	resp := postJSON(t, server.URL+"/blobs", protocol.BlobsArgs{Repo: "r", Blobs: []protocol.BlobArg{{Hash: hash, Path: "a.py"}}})
+	defer resp.Body.Close()
+	var blobs protocol.BlobsResult
+	if err := json.NewDecoder(resp.Body).Decode(&blobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs.Blobs) != 1 || !reflect.DeepEqual(blobs.Blobs[0].Symbols, want[:3]) {
+		t.Errorf("got blob symbols %+v, want %+v", blobs.Blobs, want[:3])
+	}
+}
+
+func TestService_dropKinds(t *testing.T) {
+	var fetches int
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			fetches++
+			return createTar(map[string]string{"a.py": "def f(x): pass"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return entriesParser{
+				{Name: "f", Line: 1, Kind: "function"},
+				{Name: "x", Line: 1, Kind: "local"},
+			}, nil
+		},
+		DropKinds: []string{"local", "parameter"},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	f := protocol.Symbol{Name: "f", Path: "a.py", Line: 1, Kind: "function"}
+	x := protocol.Symbol{Name: "x", Path: "a.py", Line: 1, Kind: "local"}
+	client := symbolsclient.Client{URL: server.URL}
+	for _, test := range []struct {
+		includeKinds []string
+		want         []protocol.Symbol
+		fetches      int
+	}{
+		{want: []protocol.Symbol{f}, fetches: 1},
+		{includeKinds: []string{"parameter"}, want: []protocol.Symbol{f}, fetches: 2},
+		{includeKinds: []string{"local"}, want: []protocol.Symbol{f, x}, fetches: 3},
+		{want: []protocol.Symbol{f}, fetches: 3}, // cached
+	} {
+		result, err := client.Search(context.Background(), search.SymbolsParameters{Repo: "r", CommitID: "c", IncludeKinds: test.includeKinds, First: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result.Symbols, test.want) {
+			t.Errorf("IncludeKinds %v: got %+v, want %+v", test.includeKinds, result.Symbols, test.want)
+		}
+		if fetches != test.fetches {
+			t.Errorf("IncludeKinds %v: got %d fetches, want %d", test.includeKinds, fetches, test.fetches)
+		}
+	}
+}
+
+func TestService_enclosing(t *testing.T) {
+	entries := []ctags.Entry{
+		{Name: "C", Kind: "class", Language: "Python", Line: 1},
+		{Name: "m", Kind: "member", Language: "Python", Line: 2, Parent: "C", ParentKind: "class"},
+		{Name: "x", Kind: "local", Language: "Python", Line: 3, Parent: "C.m", ParentKind: "member"},
+		{Name: "y", Kind: "local", Language: "Python", Line: 5, Parent: "Missing.Inner", ParentKind: "class"},
+	}
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.py": "class C:"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return &ctagstest.Parser{Default: entries}, nil
+		},
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	client := symbolsclient.Client{URL: server.URL}
+	result, err := client.Search(context.Background(), search.SymbolsParameters{Repo: "r", CommitID: "c", First: 100, IncludeEnclosing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]protocol.EnclosingSymbol{}
+	for _, symbol := range result.Symbols {
+		got[symbol.Name] = symbol.Enclosing
+	}
+	want := map[string][]protocol.EnclosingSymbol{
+		"C": nil,
+		"m": {{Name: "C", Kind: "class", Line: 1}},
+		"x": {{Name: "C", Kind: "class", Line: 1}, {Name: "m", Kind: "member", Line: 2}},
+		"y": {{Name: "Missing"}, {Name: "Inner", Kind: "class"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Enclosing symbols are only looked up if requested.
+	result, err = client.Search(context.Background(), search.SymbolsParameters{Repo: "r", CommitID: "c", First: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, symbol := range result.Symbols {
+		if symbol.Enclosing != nil {
+			t.Errorf("got enclosing %+v of %s, want none", symbol.Enclosing, symbol.Name)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package symbols
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// A cache snapshot (see Service.CacheSnapshot) is a tar archive of symbols
+// databases exported by the export endpoint. Its first file is named
+// snapshotVersionFile and holds the cache version of the service the
+// databases were exported from (the X-Symbols-Cache-Version header of the
+// export responses). It is followed by a file named
+// "<repo>@<commit>.sqlite3.gz" per commit, holding the export of the commit
+// without IncludeKinds.
+const (
+	snapshotVersionFile = "version"
+	snapshotDBSuffix    = ".sqlite3.gz"
+)
+
+// loadCacheSnapshot loads the symbols databases of the CacheSnapshot file into
+// the cache, so that a fresh replica doesn't have to parse popular commits
+// first. Databases already cached are skipped, and loading stops before the
+// cache would exceed MaxCacheSizeBytes. A missing snapshot, or one of another
+// cache version, is skipped; a corrupt database in it is skipped, and loading
+// stops at a corrupt archive. It returns the number of databases loaded.
+func (s *Service) loadCacheSnapshot(ctx context.Context) (loaded int, err error) {
+	f, err := os.Open(s.CacheSnapshot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log15.Info("No symbols cache snapshot to load", "path", s.CacheSnapshot)
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	var size int64
+	if s.MaxCacheSizeBytes > 0 {
+		items, err := s.cache.List()
+		if err != nil {
+			return 0, err
+		}
+		for _, item := range items {
+			size += item.Size
+		}
+	}
+
+	tr := tar.NewReader(f)
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return loaded, nil
+		}
+		if err != nil {
+			return loaded, errors.Wrap(err, "reading snapshot")
+		}
+
+		if i == 0 {
+			if hdr.Name != snapshotVersionFile {
+				return 0, errors.Errorf("snapshot doesn't start with a %s file", snapshotVersionFile)
+			}
+			version, err := ioutil.ReadAll(io.LimitReader(tr, 256))
+			if err != nil {
+				return 0, errors.Wrap(err, "reading snapshot")
+			}
+			if v := strings.TrimSpace(string(version)); v != s.cacheVersion {
+				log15.Warn("Skipping symbols cache snapshot of another cache version", "path", s.CacheSnapshot, "version", v, "want", s.cacheVersion)
+				return 0, nil
+			}
+			continue
+		}
+
+		repo, commitID, ok := parseSnapshotName(hdr.Name)
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			log15.Warn("Skipping unexpected file in symbols cache snapshot", "name", hdr.Name)
+			continue
+		}
+		key := s.searchCacheKey(protocol.SearchArgs{Repo: repo, CommitID: commitID})
+		if s.cache.Exists(key) {
+			continue
+		}
+		if s.MaxCacheSizeBytes > 0 && size+hdr.Size > s.MaxCacheSizeBytes {
+			// The compressed size is a lower bound of the database size, so
+			// no later database is sure to fit either.
+			log15.Info("Stopped loading symbols cache snapshot at the maximum cache size", "loaded", loaded)
+			return loaded, nil
+		}
+
+		var written int64
+		file, err := s.cache.OpenWithPath(ctx, key, func(ctx context.Context, path string) error {
+			written, err = writeSnapshotDB(ctx, tr, path)
+			if err == nil && s.MaxCacheSizeBytes > 0 && size+written > s.MaxCacheSizeBytes {
+				return errSnapshotCacheFull
+			}
+			return err
+		})
+		if errors.Cause(err) == errSnapshotCacheFull {
+			log15.Info("Stopped loading symbols cache snapshot at the maximum cache size", "loaded", loaded)
+			return loaded, nil
+		}
+		if err != nil {
+			snapshotCorruptDBs.Inc()
+			log15.Warn("Skipping corrupt database in symbols cache snapshot", "name", hdr.Name, "error", err)
+			continue
+		}
+		file.File.Close()
+		size += written
+		loaded++
+		snapshotLoadedDBs.Inc()
+	}
+}
+
+// errSnapshotCacheFull is returned by the fetcher of a database of a snapshot
+// that doesn't fit in the cache.
+var errSnapshotCacheFull = errors.New("cache full")
+
+// parseSnapshotName returns the repository and commit of the database named
+// name in a snapshot.
+func parseSnapshotName(name string) (api.RepoName, api.CommitID, bool) {
+	if !strings.HasSuffix(name, snapshotDBSuffix) {
+		return "", "", false
+	}
+	name = strings.TrimSuffix(name, snapshotDBSuffix)
+	i := strings.LastIndex(name, "@")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", false
+	}
+	return api.RepoName(name[:i]), api.CommitID(name[i+1:]), true
+}
+
+// writeSnapshotDB decompresses the database read from r to path and checks
+// that it is intact. It returns the size of the database.
+func writeSnapshotDB(ctx context.Context, r io.Reader, path string) (int64, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, zr)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	db, err := sqlx.Open("sqlite3_with_pcre", path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	var result string
+	if err := db.GetContext(ctx, &result, `PRAGMA quick_check`); err != nil {
+		return 0, err
+	}
+	if result != "ok" {
+		return 0, errors.Errorf("integrity check failed: %s", result)
+	}
+	return n, checkDB(ctx, db)
+}
+
+var (
+	snapshotLoadedDBs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "store",
+		Name:      "snapshot_loaded",
+		Help:      "The total number of symbols databases loaded into the cache from a snapshot.",
+	})
+	snapshotCorruptDBs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "store",
+		Name:      "snapshot_corrupt",
+		Help:      "The total number of corrupt symbols databases skipped when loading a snapshot.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(snapshotLoadedDBs)
+	prometheus.MustRegister(snapshotCorruptDBs)
+}
@@ -0,0 +1,169 @@
+package symbols
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags/ctagstest"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_cacheSnapshot(t *testing.T) {
+	newParser := (&ctagstest.Parser{Default: []ctags.Entry{{Name: "x", Line: 1, Kind: "func"}}}).New
+	exporter := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.go": "x"})
+		},
+		NewParser: newParser,
+	}
+	server, cleanup := startTestService(t, exporter)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "symbols-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// writeSnapshot writes a snapshot of the version and the exports of
+	// commits (of which "corrupt" is corrupt) to a file named name.
+	var exportSize, dbSize int64
+	writeSnapshot := func(name, version string, commits []api.CommitID) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		tw := tar.NewWriter(f)
+		write := func(name string, data []byte) {
+			if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data))}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		write(snapshotVersionFile, []byte(version+"\n"))
+		for _, commit := range commits {
+			if commit == "corrupt" {
+				write("github.com/a/r@corrupt"+snapshotDBSuffix, []byte("not a database"))
+				continue
+			}
+			resp := postJSON(t, server.URL+"/export", protocol.ExportArgs{Repo: "github.com/a/r", CommitID: commit})
+			data, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("exporting %s: status %d, error %v", commit, resp.StatusCode, err)
+			}
+			if got := resp.Header.Get("X-Symbols-Cache-Version"); got != exporter.cacheVersion {
+				t.Fatalf("got X-Symbols-Cache-Version %q, want %q", got, exporter.cacheVersion)
+			}
+			exportSize = int64(len(data))
+			write("github.com/a/r@"+string(commit)+snapshotDBSuffix, data)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	snapshot := writeSnapshot("snapshot.tar", exporter.cacheVersion, []api.CommitID{"c1", "corrupt", "c2"})
+
+	// startFromSnapshot starts a service that can't fetch any commits, and
+	// returns whether it has each of the commits cached.
+	startFromSnapshot := func(service *Service, commits ...api.CommitID) []bool {
+		service.FetchTar = func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return nil, errors.New("unexpected fetch")
+		}
+		service.NewParser = newParser
+		_, cleanup := startTestService(t, service)
+		defer cleanup()
+		var cached []bool
+		for _, commit := range commits {
+			cached = append(cached, service.cache.Exists(service.searchCacheKey(protocol.SearchArgs{Repo: "github.com/a/r", CommitID: commit})))
+		}
+		return cached
+	}
+
+	t.Run("load", func(t *testing.T) {
+		service := &Service{
+			FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+				return nil, errors.New("unexpected fetch")
+			},
+			NewParser:     newParser,
+			CacheSnapshot: snapshot,
+		}
+		_, cleanup := startTestService(t, service)
+		defer cleanup()
+		result, err := service.search(context.Background(), protocol.SearchArgs{Repo: "github.com/a/r", CommitID: "c2", First: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Symbols) != 1 {
+			t.Errorf("got %d symbols from the snapshot, want 1", len(result.Symbols))
+		}
+		items, err := service.cache.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dbSize = items[0].Size
+	})
+
+	t.Run("corrupt database", func(t *testing.T) {
+		got := startFromSnapshot(&Service{CacheSnapshot: snapshot}, "c1", "corrupt", "c2")
+		if !got[0] || got[1] || !got[2] {
+			t.Errorf("got cached %v, want only the intact databases cached", got)
+		}
+	})
+
+	t.Run("maximum cache size", func(t *testing.T) {
+		got := startFromSnapshot(&Service{CacheSnapshot: snapshot, MaxCacheSizeBytes: dbSize + dbSize/2}, "c1", "c2")
+		if !got[0] || got[1] {
+			t.Errorf("got cached %v, want only the first database cached", got)
+		}
+		got = startFromSnapshot(&Service{CacheSnapshot: snapshot, MaxCacheSizeBytes: exportSize}, "c1")
+		if got[0] {
+			t.Error("got a database cached beyond the maximum cache size")
+		}
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		got := startFromSnapshot(&Service{CacheSnapshot: filepath.Join(dir, "absent.tar")}, "c1")
+		if got[0] {
+			t.Error("got a commit cached without a snapshot")
+		}
+	})
+
+	t.Run("other cache version", func(t *testing.T) {
+		other := writeSnapshot("other.tar", "0-other", []api.CommitID{"c1"})
+		got := startFromSnapshot(&Service{CacheSnapshot: other}, "c1")
+		if got[0] {
+			t.Error("got a commit cached from a snapshot of another cache version")
+		}
+	})
+
+	t.Run("corrupt archive", func(t *testing.T) {
+		data, err := ioutil.ReadFile(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		truncated := filepath.Join(dir, "truncated.tar")
+		if err := ioutil.WriteFile(truncated, data[:len(data)-2048-int(exportSize)/2], 0600); err != nil {
+			t.Fatal(err)
+		}
+		got := startFromSnapshot(&Service{CacheSnapshot: truncated}, "c1", "c2")
+		if !got[0] || got[1] {
+			t.Errorf("got cached %v, want the databases before the corruption cached", got)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package symbols
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// parserSpawns tracks the parsers of the pool that failed and the attempts to
+// start new ones in their place. After consecutive failures to start a parser
+// further attempts are delayed with exponential backoff, so that a parser
+// that can't start (e.g. a misconfigured binary or a lack of memory) doesn't
+// get respawned in a tight loop.
+type parserSpawns struct {
+	mu sync.Mutex
+
+	// dead is the number of nil parsers in the pool, which are replaced by
+	// the next receiver.
+	dead int
+
+	// failures is the number of consecutive failures to start a parser, and
+	// lastErr the error of the last one.
+	failures int
+	lastErr  error
+
+	// next is the earliest time at which the next attempt may start.
+	next time.Time
+}
+
+// parserDied records that a failed parser was replaced by nil in the pool.
+func (s *Service) parserDied() {
+	s.spawns.mu.Lock()
+	s.spawns.dead++
+	deadParsers.Set(float64(s.spawns.dead))
+	s.spawns.mu.Unlock()
+}
+
+// spawnParser starts a parser in place of a nil parser received from the
+// pool, once the backoff following previous failures has elapsed. If it fails
+// the caller must return nil to the pool.
+func (s *Service) spawnParser(ctx context.Context) (ctags.Parser, error) {
+	s.spawns.mu.Lock()
+	wait := time.Until(s.spawns.next)
+	s.spawns.mu.Unlock()
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	parser, err := s.NewParser()
+
+	s.spawns.mu.Lock()
+	defer s.spawns.mu.Unlock()
+	if err != nil {
+		s.spawns.failures++
+		s.spawns.lastErr = err
+		backoff := s.ParserSpawnBackoff << uint(s.spawns.failures-1)
+		if backoff > s.MaxParserSpawnBackoff || backoff <= 0 {
+			backoff = s.MaxParserSpawnBackoff
+		}
+		s.spawns.next = time.Now().Add(backoff)
+		parserSpawnFailures.Inc()
+		log15.Error("Failed to start a symbols parser.", "failures", s.spawns.failures, "retryIn", backoff, "error", err)
+		return nil, errors.Wrap(err, "NewParser")
+	}
+	if s.spawns.failures > 0 {
+		log15.Info("Started a symbols parser after failures.", "failures", s.spawns.failures)
+	}
+	s.spawns.failures = 0
+	s.spawns.lastErr = nil
+	s.spawns.next = time.Time{}
+	s.spawns.dead--
+	deadParsers.Set(float64(s.spawns.dead))
+	return parser, nil
+}
+
+// parserPoolHealth returns an error describing why the parser pool is
+// degraded: some of its parsers failed and the last attempt to replace one
+// failed too. Failed parsers that haven't been replaced yet because no
+// request needed them don't degrade it.
+func (s *Service) parserPoolHealth() error {
+	s.spawns.mu.Lock()
+	defer s.spawns.mu.Unlock()
+	if s.spawns.failures == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d parsers unavailable after %d consecutive failures to start one: %s", s.spawns.dead, cap(s.parsers), s.spawns.failures, s.spawns.lastErr)
+}
+
+var (
+	deadParsers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "symbols",
+		Subsystem: "parse",
+		Name:      "dead_parsers",
+		Help:      "The number of parsers of the pool that failed and have not been replaced yet.",
+	})
+	parserSpawnFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "parse",
+		Name:      "parser_spawn_failures",
+		Help:      "The total number of failures to start a parser in place of one that failed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(deadParsers)
+	prometheus.MustRegister(parserSpawnFailures)
+}
@@ -0,0 +1,92 @@
+package symbols
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestService_parserSpawnBackoff(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		spawns []time.Time
+	)
+	// The first parser fails, and the next two attempts to replace it fail
+	// to start.
+	service := &Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.js": "var x = 1"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			spawns = append(spawns, time.Now())
+			switch len(spawns) {
+			case 1:
+				return parserFunc(func(name string, content []byte) ([]ctags.Entry, error) {
+					return nil, errors.New("crashed")
+				}), nil
+			case 2, 3:
+				return nil, errors.New("out of memory")
+			}
+			return mockParser{"x"}, nil
+		},
+		NumParserProcesses: 1,
+		ParserSpawnBackoff: 50 * time.Millisecond,
+	}
+	server, cleanup := startTestService(t, service)
+	defer cleanup()
+
+	health := func() int {
+		resp, err := http.Get(server.URL + "/healthz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	search := func(commitID api.CommitID) {
+		resp := postJSON(t, server.URL+"/search", protocol.SearchArgs{Repo: "r", CommitID: commitID, First: 10})
+		resp.Body.Close()
+	}
+
+	failures := testutil.ToFloat64(parserSpawnFailures)
+	search("c1")
+	if status := health(); status != http.StatusOK {
+		t.Errorf("got health status %d after a parser failed, want %d", status, http.StatusOK)
+	}
+	search("c2")
+	if status := health(); status != http.StatusServiceUnavailable {
+		t.Errorf("got health status %d after a parser failed to start, want %d", status, http.StatusServiceUnavailable)
+	}
+	search("c3")
+	search("c4")
+	if status := health(); status != http.StatusOK {
+		t.Errorf("got health status %d after a parser started, want %d", status, http.StatusOK)
+	}
+	if n := testutil.ToFloat64(parserSpawnFailures) - failures; n != 2 {
+		t.Errorf("got %v spawn failures, want 2", n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(spawns) != 4 {
+		t.Fatalf("got %d parser spawns, want 4", len(spawns))
+	}
+	// The backoff doubles after each consecutive failure.
+	for i, want := range []time.Duration{service.ParserSpawnBackoff, 2 * service.ParserSpawnBackoff} {
+		if d := spawns[i+2].Sub(spawns[i+1]); d < want {
+			t.Errorf("spawn %d came %s after the previous one, want at least %s", i+3, d, want)
+		}
+	}
+}
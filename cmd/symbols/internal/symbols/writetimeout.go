@@ -0,0 +1,102 @@
+package symbols
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+type connKey struct{}
+
+// ConnContext must be the ConnContext of the http.Server serving Handler for
+// WriteTimeout to take effect. It makes the connection of a request
+// available to its handler.
+func (s *Service) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// withWriteTimeout wraps h to fail writes of a response that block for longer
+// than WriteTimeout, because the client stopped reading it. Unlike
+// http.Server.WriteTimeout this bounds each write rather than the whole
+// response, so that a long (streamed) response to a client that keeps reading
+// is not cut off.
+func (s *Service) withWriteTimeout(h http.Handler) http.Handler {
+	if s.WriteTimeout == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, ok := r.Context().Value(connKey{}).(net.Conn)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// Record the repository and commit of the request even if the
+		// access log is disabled, to log them on a timeout.
+		if _, ok := r.Context().Value(accessLogKey{}).(*accessLogEntry); !ok {
+			r = r.WithContext(context.WithValue(r.Context(), accessLogKey{}, &accessLogEntry{}))
+		}
+
+		tw := &timeoutWriter{ResponseWriter: w, conn: conn, timeout: s.WriteTimeout}
+		h.ServeHTTP(tw, r)
+		// The server flushes the rest of the response after the handler
+		// returns, which must neither hang nor hit the deadline of the
+		// handler's last write.
+		tw.extendDeadline()
+
+		if tw.timedOut {
+			e := accessLogFromContext(r.Context())
+			log15.Warn("Abandoned a client that stopped reading the response.", "path", r.URL.Path, "repo", e.Repo, "commit", e.CommitID, "timeout", s.WriteTimeout)
+			writeTimeouts.Inc()
+		}
+	})
+}
+
+// timeoutWriter sets the write deadline of the connection before each write
+// of the response.
+type timeoutWriter struct {
+	http.ResponseWriter
+	conn     net.Conn
+	timeout  time.Duration
+	timedOut bool
+}
+
+func (w *timeoutWriter) extendDeadline() {
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	w.extendDeadline()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.extendDeadline()
+	n, err := w.ResponseWriter.Write(b)
+	if err, ok := err.(net.Error); ok && err.Timeout() {
+		w.timedOut = true
+	}
+	return n, err
+}
+
+func (w *timeoutWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.extendDeadline()
+		f.Flush()
+	}
+}
+
+var writeTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "symbols",
+	Subsystem: "request",
+	Name:      "write_timeouts",
+	Help:      "The total number of responses abandoned because the client did not read them within the write timeout.",
+})
+
+func init() {
+	prometheus.MustRegister(writeTimeouts)
+}
@@ -0,0 +1,82 @@
+package symbols
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestService_writeTimeout(t *testing.T) {
+	service := &Service{WriteTimeout: 100 * time.Millisecond}
+	failed := make(chan error, 1)
+	server := httptest.NewUnstartedServer(service.withWriteTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessLogFromContext(r.Context()).Repo = "r"
+		if r.URL.Path == "/slow" {
+			// Each write is quick, but the whole response takes longer
+			// than the timeout.
+			for i := 0; i < 3; i++ {
+				fmt.Fprintf(w, "%d", i)
+				w.(http.Flusher).Flush()
+				time.Sleep(2 * service.WriteTimeout)
+			}
+			return
+		}
+		chunk := make([]byte, 64*1024)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				failed <- err
+				return
+			}
+		}
+	})))
+	server.Config.ConnContext = service.ConnContext
+	server.Start()
+	defer server.Close()
+
+	// A client reading the response gets all of it.
+	resp, err := http.Get(server.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "012" {
+		t.Errorf("got body %q, want %q", body, "012")
+	}
+
+	// A client that never reads the response is abandoned.
+	timeouts := testutil.ToFloat64(writeTimeouts)
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := fmt.Fprintf(conn, "GET /endless HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-failed:
+		if err, ok := err.(net.Error); !ok || !err.Timeout() {
+			t.Errorf("got write error %v, want a timeout", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the response to a stalled client was not abandoned")
+	}
+	// The timeout is counted once the handler returns.
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(writeTimeouts)-timeouts != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v write timeouts counted, want 1", testutil.ToFloat64(writeTimeouts)-timeouts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"os/signal"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
@@ -20,6 +21,7 @@ import (
 	"github.com/pkg/errors"
 	log15 "gopkg.in/inconshreveable/log15.v2"
 
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/archivestore"
 	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
 	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/symbols"
 	"github.com/sourcegraph/sourcegraph/internal/api"
@@ -35,7 +37,48 @@ func main() {
 	var (
 		cacheDir       = env.Get("CACHE_DIR", "/tmp/symbols-cache", "directory to store cached symbols")
 		cacheSizeMB    = env.Get("SYMBOLS_CACHE_SIZE_MB", "100000", "maximum size of the disk cache in megabytes")
+		cacheTTL       = env.Get("SYMBOLS_CACHE_TTL", "0", "evict cached symbols that have not been used for this duration, regardless of the size of the cache (0 disables)")
+		cacheLockTTL   = env.Get("SYMBOLS_CACHE_LOCK_TIMEOUT", "0", "lock cache items while writing them, so that replicas sharing CACHE_DIR (e.g. on NFS) don't parse the same commit at once; locks not refreshed for this duration are considered stale (0 disables)")
+		cacheSnapshot  = env.Get("SYMBOLS_CACHE_SNAPSHOT", "", "path of a tar archive of exported symbols databases (named <repo>@<commit>.sqlite3.gz, after a file named version holding the X-Symbols-Cache-Version of the exports) to load into the cache at startup, as far as SYMBOLS_CACHE_SIZE_MB allows (empty disables)")
+		archiveBucket  = env.Get("SYMBOLS_ARCHIVE_STORE_BUCKET", "", "S3 bucket of pre-staged tar archives of commits to fetch before falling back to gitserver (empty disables); configured by the usual AWS_* environment variables")
+		archivePrefix  = env.Get("SYMBOLS_ARCHIVE_STORE_PREFIX", "", "prefix of the names of the archives in SYMBOLS_ARCHIVE_STORE_BUCKET, which are <prefix>/<repo>/<commit>.tar")
+		archiveURL     = env.Get("SYMBOLS_ARCHIVE_STORE_ENDPOINT", "", "URL of an S3-compatible object store (such as MinIO) holding SYMBOLS_ARCHIVE_STORE_BUCKET (default AWS S3)")
+		archiveWrite   = env.Get("SYMBOLS_ARCHIVE_STORE_WRITE_BACK", "false", "write the archives fetched from gitserver to SYMBOLS_ARCHIVE_STORE_BUCKET")
 		ctagsProcesses = env.Get("CTAGS_PROCESSES", strconv.Itoa(runtime.GOMAXPROCS(0)), "number of ctags child processes to run")
+		maxParses      = env.Get("SYMBOLS_MAX_CONCURRENT_PARSES", "0", "maximum number of files parsed at once, to throttle parsing below CTAGS_PROCESSES (0 for the number of processes)")
+		parseBatch     = env.Get("SYMBOLS_PARSE_BATCH_SIZE", "1", "maximum number of files of a commit to send to a ctags process at once, saving a round trip per file (1 parses files one at a time)")
+		ctagsNice      = env.Get("CTAGS_NICE", "0", "nice level (-20 to 19) to run ctags child processes at, so that parsing yields to other workloads")
+		fetchBytesMB   = env.Get("SYMBOLS_MAX_FETCH_BYTES_IN_FLIGHT_MB", "0", "maximum megabytes of fetched repository archives to hold in memory waiting to be parsed (0 is unlimited)")
+		requestMemMB   = env.Get("SYMBOLS_MAX_REQUEST_SYMBOLS_MB", "0", "approximate maximum megabytes of symbols a single request may accumulate before it fails with 503; streamed searches in the default format accumulate none (0 is unlimited)")
+		responseMB     = env.Get("SYMBOLS_MAX_RESPONSE_MB", "0", "approximate maximum megabytes of uncompressed symbols a search responds with; searches that find more return those that fit, marked truncated (0 is unlimited)")
+		memoryBudgetMB = env.Get("SYMBOLS_MEMORY_BUDGET_MB", "0", "approximate maximum megabytes of memory for the service, counting CTAGS_MEMORY_LIMIT_MB per ctags process, fetched archives and the symbols held by requests; requests are shed with 503 while over it (0 is unlimited)")
+		ctagsMemoryMB  = env.Get("CTAGS_MEMORY_LIMIT_MB", "0", "maximum megabytes of virtual memory of each ctags child process, on Linux (0 is unlimited)")
+		noFilesStatus  = env.Get("SYMBOLS_NO_PARSEABLE_FILES_STATUS", "0", "HTTP status (400 to 599) to respond to searches of commits without parseable files (such as empty or binary-only commits) with, instead of an empty result marked NoParseableFiles (0 disables)")
+		dropKinds      = env.Get("SYMBOLS_DROP_KINDS", "", "comma separated list of ctags kinds (such as local) to leave out of symbols unless a search re-includes them")
+		skipGenerated  = env.Get("SYMBOLS_SKIP_GENERATED_FILES", "false", "skip generated files (by file name pattern or a \"Code generated ... DO NOT EDIT\" header) when parsing a commit")
+		followIgnore   = env.Get("SYMBOLS_FOLLOW_GITIGNORE", "false", "skip files ignored by .gitignore files when parsing a commit")
+		generatedFiles = env.Get("SYMBOLS_GENERATED_FILE_PATTERNS", "", "comma separated list of file name globs of generated files (default *.pb.go, *.min.js and other common patterns)")
+		backends       = env.Get("SYMBOLS_PARSER_BACKENDS", "", "comma separated list of language=backend pairs (e.g. Python=tree-sitter) choosing the parser for a language; backends are ctags (the default) and tree-sitter")
+		treeSitterCmd  = env.Get("SYMBOLS_TREE_SITTER_COMMAND", "", "tree-sitter tagger command to run for each file of a language using the tree-sitter backend")
+		languages      = env.Get("SYMBOLS_LANGUAGES", "", "comma separated list of languages (e.g. Go,Python) to restrict parsing to; files of other languages have no symbols (default all languages ctags supports)")
+		extLanguages   = env.Get("SYMBOLS_EXTENSION_LANGUAGES", "", "comma separated list of .ext=language pairs (e.g. .tmpl=Go) mapping file extensions to the language to parse them as, overriding ctags' detection")
+		keepEOLs       = env.Get("SYMBOLS_PRESERVE_LINE_ENDINGS", "false", "pass files to ctags with their original line endings instead of normalizing CRLF and CR to LF (which keeps symbol line numbers correct)")
+		extractors     = env.Get("SYMBOLS_CONFIG_EXTRACTORS", "", "comma separated list of extractors of symbols from configuration files to enable: make (Makefile targets), compose (docker-compose services) and bazel (BUILD file targets)")
+		reposAllow     = env.Get("SYMBOLS_REPOS_ALLOW", "", "comma separated list of repository name globs to index (default all)")
+		reposDeny      = env.Get("SYMBOLS_REPOS_DENY", "", "comma separated list of repository name globs to never index")
+		spawnBackoff   = env.Get("SYMBOLS_PARSER_SPAWN_BACKOFF", "1s", "how long to wait before starting a ctags process again after it failed to start; doubles with every consecutive failure")
+		maxBackoff     = env.Get("SYMBOLS_MAX_PARSER_SPAWN_BACKOFF", "1m", "maximum time to wait before starting a ctags process again after consecutive failures to start one")
+		maxQueueDepth  = env.Get("SYMBOLS_MAX_PARSE_QUEUE_DEPTH", "0", "reject searches of uncached commits with 429 when this many files are waiting for a busy parser pool (0 disables)")
+		commitRequests = env.Get("SYMBOLS_MAX_REQUESTS_PER_COMMIT", "32", "reject requests for the symbols of a commit with 429 while this many requests for the same commit are being served (0 disables)")
+		queueTimeout   = env.Get("SYMBOLS_PARSE_QUEUE_TIMEOUT", "5m", "maximum time a file may wait for a busy parser before the search fails with 503 (0 disables)")
+		checkpoint     = env.Get("SYMBOLS_PARSE_CHECKPOINT_FILES", "1000", "save the progress of a commit's parse after this many files, so that a parse interrupted by a restart resumes instead of starting over (0 disables)")
+		maxFiles       = env.Get("SYMBOLS_MAX_FILES_PER_COMMIT", "0", "maximum number of files to parse in a commit; the symbols of larger commits are incomplete (0 is unlimited)")
+		slowParse      = env.Get("SYMBOLS_SLOW_PARSE_THRESHOLD", "1m", "log repository parses that take longer than this duration (0 disables)")
+		pushDebounce   = env.Get("SYMBOLS_PUSH_DEBOUNCE", "10s", "how long to wait for further push notifications for a repository before parsing its newest commit")
+		idleShutdown   = env.Get("SYMBOLS_IDLE_SHUTDOWN", "0", "exit after no requests have been served for this duration (0 disables)")
+		writeTimeout   = env.Get("SYMBOLS_WRITE_TIMEOUT", "1m", "abandon a response when writing it to the client blocks for this duration because the client stopped reading (0 disables)")
+		urlBasePath    = env.Get("SYMBOLS_URL_BASE_PATH", "", "path prefix the frontend is served under (its BASE_PATH), which the URLs of symbols returned to searches with IncludeURL start with")
+		accessLog      = env.Get("SYMBOLS_ACCESS_LOG", "", "write an access log line to stderr for every request, in the format common or json (empty disables)")
 	)
 
 	env.Lock()
@@ -45,34 +88,249 @@ func main() {
 
 	symbols.MustRegisterSqlite3WithPcre()
 
-	go debugserver.Start()
+	var parserOpts ctags.ParserOptions
+	if nice, err := strconv.Atoi(ctagsNice); err != nil {
+		log.Fatalf("Invalid CTAGS_NICE: %s", err)
+	} else if nice < -20 || nice > 19 {
+		log.Fatalf("Invalid CTAGS_NICE: %d is not between -20 and 19", nice)
+	} else {
+		parserOpts.Nice = nice
+	}
+
+	if mb, err := strconv.ParseInt(ctagsMemoryMB, 10, 64); err != nil {
+		log.Fatalf("Invalid CTAGS_MEMORY_LIMIT_MB: %s", err)
+	} else {
+		parserOpts.MemoryLimit = mb * 1000 * 1000
+	}
+
+	extensionLanguages, err := parseExtensionLanguages(extLanguages)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_EXTENSION_LANGUAGES: %s", err)
+	}
+	parserOpts.ExtensionLanguages = extensionLanguages
+
+	parserOpts.Languages, err = parseLanguages(languages)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_LANGUAGES: %s", err)
+	}
+
+	treeSitterLanguages, err := parseTreeSitterLanguages(backends)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_PARSER_BACKENDS: %s", err)
+	}
+	for _, language := range treeSitterLanguages {
+		if len(parserOpts.Languages) > 0 && !containsFold(parserOpts.Languages, language) {
+			log.Fatalf("Invalid SYMBOLS_PARSER_BACKENDS: %s is not one of SYMBOLS_LANGUAGES", language)
+		}
+	}
+	if len(treeSitterLanguages) > 0 && treeSitterCmd == "" {
+		log.Fatalf("Invalid SYMBOLS_TREE_SITTER_COMMAND: must be set to use the tree-sitter backend")
+	}
+
+	configExtractors := strings.FieldsFunc(extractors, func(r rune) bool { return r == ',' || r == ' ' })
+	if _, err := ctags.NewExtractorParser(nil, configExtractors); err != nil {
+		log.Fatalf("Invalid SYMBOLS_CONFIG_EXTRACTORS: %s", err)
+	}
+
+	// Everything that changes the symbols the parsers return, so that cached
+	// symbols are parsed again when it changes (CTAGS_NICE doesn't).
+	ctagsVersion, err := ctags.Version(ctags.GetCommand())
+	if err != nil {
+		log.Fatalf("Failed to get the ctags version: %s", err)
+	}
+	parseConfig := fmt.Sprintf("ctags: %s\nlanguages: %v\nextension languages: %v\ntree-sitter: %v %q\nextractors: %v",
+		ctagsVersion, parserOpts.Languages, parserOpts.ExtensionLanguages, treeSitterLanguages, treeSitterCmd, configExtractors)
 
 	service := symbols.Service{
 		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
 			return gitserver.DefaultClient.Archive(ctx, repo, gitserver.ArchiveOptions{Treeish: string(commit), Format: "tar"})
 		},
+		FetchBlob: func(ctx context.Context, repo gitserver.Repo, hash string) (io.ReadCloser, error) {
+			cmd := gitserver.DefaultClient.Command("git", "cat-file", "blob", hash)
+			cmd.Repo = repo
+			return gitserver.StdoutReader(ctx, cmd)
+		},
+		FetchFile: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, path string) (io.ReadCloser, error) {
+			cmd := gitserver.DefaultClient.Command("git", "show", string(commit)+":"+path)
+			cmd.Repo = repo
+			return gitserver.StdoutReader(ctx, cmd)
+		},
+		ListBlobs: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, paths []string) (map[string]string, error) {
+			cmd := gitserver.DefaultClient.Command("git", append([]string{"ls-tree", "-z", "--full-name", string(commit), "--"}, paths...)...)
+			cmd.Repo = repo
+			out, err := cmd.Output(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return parseLsTreeBlobs(out), nil
+		},
 		NewParser: func() (ctags.Parser, error) {
-			parser, err := ctags.NewParser(ctags.GetCommand())
+			parser, err := ctags.NewParserWithOptions(ctags.GetCommand(), parserOpts)
 			if err != nil {
 				return nil, errors.Wrap(err, fmt.Sprintf("command: %s", ctags.GetCommand()))
 			}
+			if len(treeSitterLanguages) > 0 {
+				parsers := make(map[string]ctags.Parser, len(treeSitterLanguages))
+				for _, language := range treeSitterLanguages {
+					parsers[language] = ctags.NewTreeSitterParser(treeSitterCmd, language)
+				}
+				parser = ctags.NewLanguageParser(parser, parsers, parserOpts.ExtensionLanguages)
+			}
+			if len(configExtractors) > 0 {
+				return ctags.NewExtractorParser(parser, configExtractors)
+			}
 			return parser, nil
 		},
-		Path: cacheDir,
+		ListKinds: func() (map[string][]ctags.Kind, error) {
+			return ctags.ListKinds(ctags.GetCommand())
+		},
+		ParseConfig:   parseConfig,
+		DropKinds:     strings.FieldsFunc(dropKinds, func(r rune) bool { return r == ',' || r == ' ' }),
+		Path:          cacheDir,
+		CacheSnapshot: cacheSnapshot,
+		URLBasePath:   urlBasePath,
 	}
 	if mb, err := strconv.ParseInt(cacheSizeMB, 10, 64); err != nil {
 		log.Fatalf("Invalid SYMBOLS_CACHE_SIZE_MB: %s", err)
 	} else {
 		service.MaxCacheSizeBytes = mb * 1000 * 1000
 	}
-	var err error
+	service.CacheTTL, err = time.ParseDuration(cacheTTL)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_CACHE_TTL: %s", err)
+	}
+	service.CacheLockTimeout, err = time.ParseDuration(cacheLockTTL)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_CACHE_LOCK_TIMEOUT: %s", err)
+	}
+	if mb, err := strconv.ParseInt(fetchBytesMB, 10, 64); err != nil {
+		log.Fatalf("Invalid SYMBOLS_MAX_FETCH_BYTES_IN_FLIGHT_MB: %s", err)
+	} else {
+		service.MaxConcurrentFetchTarBytes = mb * 1000 * 1000
+	}
+	if mb, err := strconv.ParseInt(requestMemMB, 10, 64); err != nil {
+		log.Fatalf("Invalid SYMBOLS_MAX_REQUEST_SYMBOLS_MB: %s", err)
+	} else {
+		service.MaxRequestSymbolBytes = mb * 1000 * 1000
+	}
+	if mb, err := strconv.ParseInt(responseMB, 10, 64); err != nil {
+		log.Fatalf("Invalid SYMBOLS_MAX_RESPONSE_MB: %s", err)
+	} else {
+		service.MaxResponseBytes = mb * 1000 * 1000
+	}
+	if mb, err := strconv.ParseInt(memoryBudgetMB, 10, 64); err != nil {
+		log.Fatalf("Invalid SYMBOLS_MEMORY_BUDGET_MB: %s", err)
+	} else {
+		service.MemoryBudgetBytes = mb * 1000 * 1000
+	}
+	service.ParserMemoryLimitBytes = parserOpts.MemoryLimit
+	if status, err := strconv.Atoi(noFilesStatus); err != nil {
+		log.Fatalf("Invalid SYMBOLS_NO_PARSEABLE_FILES_STATUS: %s", err)
+	} else if status != 0 && (status < 400 || status > 599) {
+		log.Fatalf("Invalid SYMBOLS_NO_PARSEABLE_FILES_STATUS: %d is not between 400 and 599", status)
+	} else {
+		service.NoParseableFilesStatus = status
+	}
+	service.PreserveLineEndings, err = strconv.ParseBool(keepEOLs)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_PRESERVE_LINE_ENDINGS: %s", err)
+	}
+	service.SkipGeneratedFiles, err = strconv.ParseBool(skipGenerated)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_SKIP_GENERATED_FILES: %s", err)
+	}
+	service.FollowGitignore, err = strconv.ParseBool(followIgnore)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_FOLLOW_GITIGNORE: %s", err)
+	}
+	if archiveBucket != "" {
+		writeBack, err := strconv.ParseBool(archiveWrite)
+		if err != nil {
+			log.Fatalf("Invalid SYMBOLS_ARCHIVE_STORE_WRITE_BACK: %s", err)
+		}
+		store, err := archivestore.NewS3Store(archiveBucket, archivePrefix, archiveURL)
+		if err != nil {
+			log.Fatalf("Failed to create the archive store: %s", err)
+		}
+		fetcher := &archivestore.Fetcher{Store: store, Fallback: service.FetchTar, WriteBack: writeBack}
+		service.FetchTar = fetcher.FetchTar
+	}
+	if generatedFiles != "" {
+		service.GeneratedFilePatterns = strings.FieldsFunc(generatedFiles, func(r rune) bool { return r == ',' || r == ' ' })
+	}
 	service.NumParserProcesses, err = strconv.Atoi(ctagsProcesses)
 	if err != nil {
 		log.Fatalf("Invalid CTAGS_PROCESSES: %s", err)
 	}
+	service.MaxConcurrentParses, err = strconv.Atoi(maxParses)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_MAX_CONCURRENT_PARSES: %s", err)
+	}
+	service.ParseBatchSize, err = strconv.Atoi(parseBatch)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_PARSE_BATCH_SIZE: %s", err)
+	}
+	service.ParserSpawnBackoff, err = time.ParseDuration(spawnBackoff)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_PARSER_SPAWN_BACKOFF: %s", err)
+	}
+	service.MaxParserSpawnBackoff, err = time.ParseDuration(maxBackoff)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_MAX_PARSER_SPAWN_BACKOFF: %s", err)
+	}
+	service.MaxParseQueueDepth, err = strconv.Atoi(maxQueueDepth)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_MAX_PARSE_QUEUE_DEPTH: %s", err)
+	}
+	service.MaxRequestsPerCommit, err = strconv.Atoi(commitRequests)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_MAX_REQUESTS_PER_COMMIT: %s", err)
+	}
+	service.ParseQueueTimeout, err = time.ParseDuration(queueTimeout)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_PARSE_QUEUE_TIMEOUT: %s", err)
+	}
+	service.ParseCheckpointFiles, err = strconv.Atoi(checkpoint)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_PARSE_CHECKPOINT_FILES: %s", err)
+	}
+	service.MaxFilesPerCommit, err = strconv.Atoi(maxFiles)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_MAX_FILES_PER_COMMIT: %s", err)
+	}
+	service.SlowParseThreshold, err = time.ParseDuration(slowParse)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_SLOW_PARSE_THRESHOLD: %s", err)
+	}
+	service.PushDebounce, err = time.ParseDuration(pushDebounce)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_PUSH_DEBOUNCE: %s", err)
+	}
+	service.WriteTimeout, err = time.ParseDuration(writeTimeout)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_WRITE_TIMEOUT: %s", err)
+	}
+	service.IdleTimeout, err = time.ParseDuration(idleShutdown)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_IDLE_SHUTDOWN: %s", err)
+	}
+	switch accessLog {
+	case "", symbols.AccessLogCommon, symbols.AccessLogJSON:
+		service.AccessLogFormat = accessLog
+	default:
+		log.Fatalf("Invalid SYMBOLS_ACCESS_LOG: %q is not common or json", accessLog)
+	}
+	repoFilter, err := symbols.NewRepoFilter(symbols.ParseRepoPatterns(reposAllow), symbols.ParseRepoPatterns(reposDeny))
+	if err != nil {
+		log.Fatalf("Invalid SYMBOLS_REPOS_ALLOW or SYMBOLS_REPOS_DENY: %s", err)
+	}
+	service.SetRepoFilter(repoFilter)
 	if err := service.Start(); err != nil {
 		log.Fatalln("Start:", err)
 	}
+
+	go debugserver.Start(service.DebugEndpoints()...)
+
 	handler := nethttp.Middleware(opentracing.GlobalTracer(), service.Handler())
 
 	host := ""
@@ -80,24 +338,126 @@ func main() {
 		host = "127.0.0.1"
 	}
 	addr := net.JoinHostPort(host, port)
-	server := &http.Server{Addr: addr, Handler: handler}
-	go shutdownOnSIGINT(server)
+	server := &http.Server{Addr: addr, Handler: handler, ConnContext: service.ConnContext}
+	stopped := make(chan struct{})
+	go func() {
+		shutdownOnSIGINTOrIdle(server, &service)
+		close(stopped)
+	}()
 
 	log15.Info("symbols: listening", "addr", addr)
 	err = server.ListenAndServe()
 	if err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+	<-stopped
+}
+
+// parseTreeSitterLanguages returns the languages that backends (a comma
+// separated list of language=backend pairs) parses with the tree-sitter
+// backend.
+func parseTreeSitterLanguages(backends string) ([]string, error) {
+	var languages []string
+	for _, pair := range strings.FieldsFunc(backends, func(r rune) bool { return r == ',' || r == ' ' }) {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q is not a language=backend pair", pair)
+		}
+		switch language, backend := pair[:i], pair[i+1:]; backend {
+		case "ctags":
+		case "tree-sitter":
+			languages = append(languages, language)
+		default:
+			return nil, fmt.Errorf("unknown backend %q for %s (must be ctags or tree-sitter)", backend, language)
+		}
+	}
+	return languages, nil
+}
+
+// parseLanguages parses a comma separated list of languages ctags supports
+// into their names in ctags.DefaultLanguages.
+func parseLanguages(list string) ([]string, error) {
+	var languages []string
+	for _, language := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+		name := ctags.SupportedLanguage(language)
+		if name == "" {
+			return nil, fmt.Errorf("%q is not a language supported by ctags", language)
+		}
+		languages = append(languages, name)
+	}
+	return languages, nil
+}
+
+// containsFold reports whether list contains s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, x := range list {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExtensionLanguages parses a comma separated list of .ext=language pairs
+// into a map from lowercase extension to language.
+func parseExtensionLanguages(pairs string) (map[string]string, error) {
+	extensions := map[string]string{}
+	for _, pair := range strings.FieldsFunc(pairs, func(r rune) bool { return r == ',' || r == ' ' }) {
+		i := strings.Index(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("%q is not an .ext=language pair", pair)
+		}
+		ext, language := strings.ToLower(pair[:i]), pair[i+1:]
+		if !strings.HasPrefix(ext, ".") || len(ext) == 1 || strings.ContainsAny(ext, "/=") {
+			return nil, fmt.Errorf("%q is not a file extension (such as .tmpl)", pair[:i])
+		}
+		if strings.Contains(language, "=") {
+			return nil, fmt.Errorf("%q is not a language name", language)
+		}
+		extensions[ext] = language
+	}
+	return extensions, nil
+}
+
+// parseLsTreeBlobs returns the hashes of the blobs listed in the output of
+// git ls-tree -z, by path. Other entries, such as directories and submodules,
+// are left out.
+func parseLsTreeBlobs(out []byte) map[string]string {
+	blobs := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <object> TAB <path>
+		tab := strings.IndexByte(line, '\t')
+		if tab == -1 {
+			continue
+		}
+		fields := strings.Fields(line[:tab])
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		blobs[line[tab+1:]] = fields[2]
+	}
+	return blobs
 }
 
-func shutdownOnSIGINT(s *http.Server) {
+// shutdownOnSIGINTOrIdle gracefully shuts down the server and then the
+// service's parsers on SIGINT, or once the service has been idle for its
+// IdleTimeout.
+func shutdownOnSIGINTOrIdle(s *http.Server, service *symbols.Service) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
-	<-c
+	select {
+	case <-c:
+		log15.Info("symbols: shutting down", "reason", "interrupt")
+	case <-service.Idle():
+		log15.Info("symbols: shutting down", "reason", fmt.Sprintf("no requests for %s", service.IdleTimeout))
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	err := s.Shutdown(ctx)
 	if err != nil {
 		log.Fatal("graceful server shutdown failed, will exit:", err)
 	}
+	if err := service.Stop(ctx); err != nil {
+		log.Println("failed to stop all ctags parsers:", err)
+	}
 }
@@ -35,6 +35,20 @@ type Store struct {
 	// BeforeEvict, when non-nil, is a function to call before evicting a file.
 	// It is passed the path to the file to be evicted.
 	BeforeEvict func(string)
+
+	// RecordKeys if true writes the key of each item to a file next to it, so
+	// that List can return the keys of the cached items. File names alone
+	// don't identify their keys (see EncodeKey).
+	RecordKeys bool
+
+	// LockTimeout if non-zero makes a fetch hold a lock file next to the
+	// item, so that when several processes share Dir (such as replicas with
+	// a cache on NFS) only one of them fetches an item at a time, and the
+	// others wait for it and open the item it fetched. A lock that was not
+	// refreshed for longer than LockTimeout is considered left behind by a
+	// crashed process and broken. The lock of a fetch in progress is
+	// refreshed every third of LockTimeout.
+	LockTimeout time.Duration
 }
 
 // File is an os.File, but includes the Path
@@ -123,7 +137,11 @@ func (s *Store) OpenWithPath(ctx context.Context, key string, fetcher FetcherWit
 			ctx, cancel = context.WithTimeout(context.Background(), s.BackgroundTimeout)
 			defer cancel()
 		}
-		f, err := doFetch(ctx, path, fetcher)
+		recordedKey := ""
+		if s.RecordKeys {
+			recordedKey = key
+		}
+		f, err := doFetch(ctx, path, recordedKey, s.LockTimeout, fetcher)
 		ch <- result{f, err}
 	}(ctx)
 
@@ -138,15 +156,66 @@ func (s *Store) OpenWithPath(ctx context.Context, key string, fetcher FetcherWit
 	}
 }
 
+// Exists reports whether an item for key is currently in the cache. It does
+// not fetch missing items.
+func (s *Store) Exists(key string) bool {
+	_, err := os.Stat(s.path(key))
+	return err == nil
+}
+
+// Remove removes the item for key from the cache, for example because it
+// turned out to be corrupt, so that the next Open fetches it again. Removing a
+// missing item is not an error.
+func (s *Store) Remove(key string) error {
+	path := s.path(key)
+	urlMu := urlMu(path)
+	urlMu.Lock()
+	defer urlMu.Unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	removeKeyFile(path)
+	return nil
+}
+
 // path returns the path for key.
 func (s *Store) path(key string) string {
-	// path uses a sha256 hash of the key since we want to use it for the
-	// disk name.
+	return filepath.Join(s.Dir, EncodeKey(key)) + ".zip"
+}
+
+// maxReadableKeyLen is the maximum length of the readable part of the names
+// returned by EncodeKey, which keeps names well below the usual 255 byte
+// limit of file systems.
+const maxReadableKeyLen = 64
+
+// EncodeKey returns the file name (without an extension) under which the
+// item with key is stored. Keys such as repository names may contain
+// characters that are unsafe or awkward in file names (slashes, "..",
+// unicode), so the name is the hex encoded SHA-256 hash of the key, which
+// keeps distinct keys apart, followed by a dash and a readable version of
+// the key for people looking at the cache: the first maxReadableKeyLen
+// bytes of the key with every byte other than an ASCII letter, digit, "-",
+// "_" or "@" replaced by "_". The readable part is lossy and never used to
+// look items up.
+func EncodeKey(key string) string {
 	h := sha256.Sum256([]byte(key))
-	return filepath.Join(s.Dir, hex.EncodeToString(h[:])) + ".zip"
+	readable := []byte(key)
+	if len(readable) > maxReadableKeyLen {
+		readable = readable[:maxReadableKeyLen]
+	}
+	for i, c := range readable {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '@') {
+			readable[i] = '_'
+		}
+	}
+	return hex.EncodeToString(h[:]) + "-" + string(readable)
 }
 
-func doFetch(ctx context.Context, path string, fetcher FetcherWithPath) (file *File, err error) {
+// doFetch fetches the item at path, unless another fetch did already. If key
+// is non-empty it is recorded next to the item (see Store.RecordKeys). If
+// lockTimeout is non-zero the fetch holds the item's lock file (see
+// Store.LockTimeout).
+func doFetch(ctx context.Context, path, key string, lockTimeout time.Duration, fetcher FetcherWithPath) (file *File, err error) {
 	// We have to grab the lock for this key, so we can fetch or wait for
 	// someone else to finish fetching.
 	urlMu := urlMu(path)
@@ -164,6 +233,24 @@ func doFetch(ctx context.Context, path string, fetcher FetcherWithPath) (file *F
 	if err == nil {
 		return &File{File: f, Path: path}, nil
 	}
+
+	if lockTimeout > 0 {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, errors.Wrap(err, "could not create archive cache dir")
+		}
+		unlock, err := lockItem(ctx, path, lockTimeout)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to lock cache item")
+		}
+		defer unlock()
+
+		// Another process may have fetched the item while we waited.
+		f, err := os.Open(path)
+		if err == nil {
+			return &File{File: f, Path: path}, nil
+		}
+	}
+
 	// Just in case we failed due to something bad on the FS, remove
 	_ = os.Remove(path)
 
@@ -201,6 +288,14 @@ func doFetch(ctx context.Context, path string, fetcher FetcherWithPath) (file *F
 		return nil, errors.Wrap(err, "failed to put cache item in place")
 	}
 
+	if key != "" {
+		// Best effort: an item without a recorded key is only left out of
+		// List.
+		if err := ioutil.WriteFile(keyFilePath(path), []byte(key), 0600); err != nil {
+			log.Printf("failed to record the key of %s: %s", path, err)
+		}
+	}
+
 	// Sync the directory. We need to ensure the rename is recorded to disk.
 	if err := fsync(filepath.Dir(path)); err != nil {
 		return nil, errors.Wrap(err, "failed to sync cache directory to disk")
@@ -213,6 +308,45 @@ func doFetch(ctx context.Context, path string, fetcher FetcherWithPath) (file *F
 	return &File{File: f, Path: path}, nil
 }
 
+// RemoveTempFiles removes partially written cache items left behind in Dir,
+// for example by a crash in the middle of a fetch. This includes any files
+// created alongside the temporary item by the fetcher, such as sqlite
+// journals. It must only be called before the Store is used, since it does
+// not coordinate with in-progress fetches of this process. With LockTimeout
+// set, the files of fetches holding a lock (of other processes sharing Dir)
+// are kept.
+func (s *Store) RemoveTempFiles() (removed int, err error) {
+	list, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.Wrapf(err, "failed to ReadDir %s", s.Dir)
+	}
+
+	for _, fi := range list {
+		if !isTempFile(fi.Name()) {
+			continue
+		}
+		path := filepath.Join(s.Dir, fi.Name())
+		if s.LockTimeout > 0 && lockedByOther(path, s.LockTimeout) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("failed to remove %s: %s", path, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// isTempFile reports whether name is a temporary file written by doFetch (or
+// by a fetcher next to it) rather than a complete cache item.
+func isTempFile(name string) bool {
+	return strings.HasSuffix(name, ".part") || strings.Contains(name, ".part-")
+}
+
 // EvictStats is information gathered during Evict.
 type EvictStats struct {
 	// CacheSize is the size of the cache before evicting.
@@ -275,6 +409,7 @@ func (s *Store) Evict(maxCacheSizeBytes int64) (stats EvictStats, err error) {
 			log.Printf("failed to remove %s: %s", path, err)
 			continue
 		}
+		removeKeyFile(path)
 		stats.Evicted++
 		size -= fi.Size()
 	}
@@ -282,6 +417,93 @@ func (s *Store) Evict(maxCacheSizeBytes int64) (stats EvictStats, err error) {
 	return stats, nil
 }
 
+// EvictExpired removes the files in Store.Dir that have not been opened for
+// longer than maxAge, regardless of the size of the cache. Opening an item
+// updates its modification time, so items that are still used are kept.
+func (s *Store) EvictExpired(maxAge time.Duration) (stats EvictStats, err error) {
+	list, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return stats, errors.Wrapf(err, "failed to ReadDir %s", s.Dir)
+	}
+
+	expiry := time.Now().Add(-maxAge)
+	for _, fi := range list {
+		if !strings.HasSuffix(fi.Name(), ".zip") {
+			continue
+		}
+		stats.CacheSize += fi.Size()
+		if !fi.ModTime().Before(expiry) {
+			continue
+		}
+		path := filepath.Join(s.Dir, fi.Name())
+		if s.BeforeEvict != nil {
+			s.BeforeEvict(path)
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("failed to remove %s: %s", path, err)
+			continue
+		}
+		removeKeyFile(path)
+		stats.Evicted++
+	}
+	return stats, nil
+}
+
+// Item describes an item in the cache.
+type Item struct {
+	Key  string
+	Path string
+	Size int64
+
+	// ModTime is when the item was last opened.
+	ModTime time.Time
+}
+
+// List returns the items in the cache whose keys were recorded (see
+// RecordKeys). Items evicted while listing are left out.
+func (s *Store) List() ([]Item, error) {
+	list, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to ReadDir %s", s.Dir)
+	}
+
+	var items []Item
+	for _, fi := range list {
+		if !strings.HasSuffix(fi.Name(), ".zip") {
+			continue
+		}
+		path := filepath.Join(s.Dir, fi.Name())
+		key, err := ioutil.ReadFile(keyFilePath(path))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // not recorded, or just evicted
+			}
+			return nil, err
+		}
+		items = append(items, Item{Key: string(key), Path: path, Size: fi.Size(), ModTime: fi.ModTime()})
+	}
+	return items, nil
+}
+
+// keyFilePath returns the path of the file recording the key of the item at
+// path.
+func keyFilePath(path string) string {
+	return path + ".key"
+}
+
+// removeKeyFile removes the recorded key of the item at path, if any.
+func removeKeyFile(path string) {
+	if err := os.Remove(keyFilePath(path)); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove %s: %s", keyFilePath(path), err)
+	}
+}
+
 func copyAndClose(dst io.WriteCloser, src io.ReadCloser) error {
 	_, err := io.Copy(dst, src)
 	if err1 := src.Close(); err == nil {
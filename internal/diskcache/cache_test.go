@@ -6,7 +6,10 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestOpen(t *testing.T) {
@@ -60,4 +63,250 @@ func TestOpen(t *testing.T) {
 	if usedCache {
 		t.Fatal("Item was not properly evicted")
 	}
+
+	// Remove, then we should not use the cache either
+	if err := store.Remove("key"); err != nil {
+		t.Fatal(err)
+	}
+	if store.Exists("key") {
+		t.Fatal("Item was not properly removed")
+	}
+	_, usedCache = do()
+	if usedCache {
+		t.Fatal("Expected fetcher to be called after Remove")
+	}
+	if err := store.Remove("missing"); err != nil {
+		t.Fatalf("Remove of a missing item failed: %s", err)
+	}
+}
+
+func TestRemoveTempFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskcache_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &Store{Dir: dir}
+
+	keep := []string{"a.zip", "b.zip"}
+	remove := []string{"c.zip.part", "c.zip.part-journal", "d.zip.part-wal"}
+	for _, name := range append(keep, remove...) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := store.RemoveTempFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != len(remove) {
+		t.Errorf("got %d removed, want %d", removed, len(remove))
+	}
+	for _, name := range keep {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to be kept: %s", name, err)
+		}
+	}
+	for _, name := range remove {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+}
+
+func TestEncodeKey(t *testing.T) {
+	keys := []string{
+		"github.com/a/b",
+		"github.com/a_b",
+		"github.com/a/b/../c",
+		"gitlab.com/日本語/リポジトリ",
+		"repo with spaces and \x00 nul",
+		"x.part-journal",
+		strings.Repeat("long/", 100) + "a",
+		strings.Repeat("long/", 100) + "b",
+		"",
+	}
+	seen := map[string]string{}
+	for _, key := range keys {
+		name := EncodeKey(key)
+		if other, ok := seen[name]; ok {
+			t.Errorf("keys %q and %q are both encoded as %q", other, key, name)
+		}
+		seen[name] = key
+
+		if name != EncodeKey(key) {
+			t.Errorf("%q: encoding is not deterministic", key)
+		}
+		if len(name) > 200 {
+			t.Errorf("%q: got a %d byte name, want at most 200", key, len(name))
+		}
+		for _, c := range name {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '@') {
+				t.Errorf("%q: name %q contains %q", key, name, c)
+				break
+			}
+		}
+		if isTempFile(name + ".zip") {
+			t.Errorf("%q: name %q looks like a temporary file", key, name)
+		}
+	}
+
+	if got, want := EncodeKey("5-github.com/a/b@deadbeef"), "-5-github_com_a_b@deadbeef"; !strings.HasSuffix(got, want) {
+		t.Errorf("got %q, want it to end with %q", got, want)
+	}
+}
+
+func TestEvictExpired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskcache_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &Store{Dir: dir}
+
+	old := time.Now().Add(-2 * time.Hour)
+	for name, modTime := range map[string]time.Time{
+		"fresh.zip":    time.Now(),
+		"old.zip":      old,
+		"old.zip.part": old,
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := store.EvictExpired(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (EvictStats{CacheSize: 2, Evicted: 1}); stats != want {
+		t.Errorf("got stats %+v, want %+v", stats, want)
+	}
+	for name, wantKept := range map[string]bool{"fresh.zip": true, "old.zip": false, "old.zip.part": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != wantKept {
+			t.Errorf("%s: got kept %v, want %v", name, err == nil, wantKept)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskcache_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	open := func(store *Store, key string) {
+		f, err := store.Open(context.Background(), key, func(ctx context.Context) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("x")), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	open(&Store{Dir: dir}, "unrecorded")
+	store := &Store{Dir: dir, RecordKeys: true}
+	open(store, "a/b@c")
+
+	items, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Key != "a/b@c" || items[0].Size != 1 || items[0].Path != store.path("a/b@c") {
+		t.Fatalf("got items %+v, want only a/b@c", items)
+	}
+
+	if err := store.Remove("a/b@c"); err != nil {
+		t.Fatal(err)
+	}
+	if items, err := store.List(); err != nil || len(items) != 0 {
+		t.Errorf("got items %+v (error %v) after Remove, want none", items, err)
+	}
+	if _, err := os.Stat(keyFilePath(store.path("a/b@c"))); !os.IsNotExist(err) {
+		t.Errorf("expected the recorded key to be removed with the item")
+	}
+}
+
+func TestOpen_lockTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskcache_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &Store{Dir: dir, LockTimeout: time.Minute}
+	open := func(want string) (fetched bool) {
+		t.Helper()
+		f, err := store.Open(context.Background(), "key", func(ctx context.Context) (io.ReadCloser, error) {
+			fetched = true
+			return ioutil.NopCloser(strings.NewReader(want)), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		got, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+		return fetched
+	}
+
+	// Another process holds the lock of the item, and puts the item in
+	// place before releasing it. Open waits for it instead of fetching.
+	path := store.path("key")
+	lockPath := lockFilePath(path)
+	if err := ioutil.WriteFile(lockPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(2 * lockPollInterval)
+		if err := ioutil.WriteFile(path, []byte("other"), 0600); err != nil {
+			t.Error(err)
+		}
+		os.Remove(lockPath)
+	}()
+	if open("other") {
+		t.Error("fetched the item another process was fetching")
+	}
+
+	// A lock left behind by a crashed process is broken.
+	if err := store.Remove("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(lockPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(lockPath, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if !open("mine") {
+		t.Error("did not fetch the item despite a stale lock")
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("expected the lock to be released, got %v", err)
+	}
+
+	// The temporary files of a fetch holding a lock are kept.
+	if err := ioutil.WriteFile(path+".part", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(lockPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := store.RemoveTempFiles(); err != nil || removed != 0 {
+		t.Errorf("got %d removed (error %v), want the locked temporary file kept", removed, err)
+	}
 }
@@ -0,0 +1,92 @@
+package diskcache
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// When several processes share Dir (such as replicas with a cache on NFS),
+// urlMu doesn't keep them from fetching the same item at once and writing the
+// same temporary file. With Store.LockTimeout set, a fetch also holds a lock
+// file next to the item. Lock files are created with O_EXCL, which unlike
+// flock is atomic on NFS too.
+
+// lockPollInterval is how often a lock held by another process is tried
+// again.
+var lockPollInterval = 100 * time.Millisecond
+
+// lockFilePath returns the path of the lock file of the item at path.
+func lockFilePath(path string) string {
+	return path + ".lock"
+}
+
+// lockItem takes the lock of the item at path, waiting for another process
+// holding it until ctx is done. A lock that was not refreshed for longer than
+// timeout was left behind by a crashed process, and is broken. While the lock
+// is held it is refreshed regularly, so that a long fetch is not mistaken for
+// a crashed one. unlock releases it.
+func lockItem(ctx context.Context, path string, timeout time.Duration) (unlock func(), err error) {
+	lockPath := lockFilePath(path)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if fi, err := os.Stat(lockPath); err == nil && time.Since(fi.ModTime()) > timeout {
+			// Two processes breaking the same stale lock at once may
+			// both end up fetching the item, which is no worse than
+			// not locking at all.
+			log.Printf("breaking stale cache lock %s, last refreshed at %s", lockPath, fi.ModTime())
+			if err := os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(timeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				touch(lockPath)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		if err := os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to remove cache lock %s: %s", lockPath, err)
+		}
+	}, nil
+}
+
+// lockedByOther reports whether the temporary file at tempPath belongs to a
+// fetch that holds a lock which is not stale, most likely in another process
+// sharing the cache directory.
+func lockedByOther(tempPath string, timeout time.Duration) bool {
+	i := strings.Index(tempPath, ".part")
+	if i < 0 {
+		return false
+	}
+	fi, err := os.Stat(lockFilePath(tempPath[:i]))
+	return err == nil && time.Since(fi.ModTime()) <= timeout
+}
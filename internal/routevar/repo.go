@@ -21,6 +21,12 @@ var (
 	Rev  = `{Rev:` + namedToNonCapturingGroups(RevPattern) + `}`
 
 	RepoRevSuffix = `{Rev:` + namedToNonCapturingGroups(`(?:@`+RevPattern+`)?`) + `}`
+
+	// BaseRepo and BaseRevSuffix are like Repo and RepoRevSuffix, for routes
+	// that refer to a second (base) repository, such as a comparison of a
+	// fork against its upstream.
+	BaseRepo      = `{BaseRepo:` + namedToNonCapturingGroups(RepoPattern) + `}`
+	BaseRevSuffix = `{BaseRev:` + namedToNonCapturingGroups(`(?:@`+RevPattern+`)?`) + `}`
 )
 
 const (
@@ -88,3 +94,26 @@ func RepoRevRouteVars(s RepoRev) map[string]string {
 	m["Rev"] = rev
 	return m
 }
+
+// ToBaseRepoRev is like ToRepoRev, for the BaseRepo and BaseRev route
+// variables.
+func ToBaseRepoRev(routeVars map[string]string) RepoRev {
+	return ToRepoRev(map[string]string{"Repo": routeVars["BaseRepo"], "Rev": routeVars["BaseRev"]})
+}
+
+// BaseRepoRevRouteVars is like RepoRevRouteVars, for the BaseRepo and BaseRev
+// route variables.
+func BaseRepoRevRouteVars(s RepoRev) map[string]string {
+	m := RepoRevRouteVars(s)
+	return map[string]string{"BaseRepo": m["Repo"], "BaseRev": m["Rev"]}
+}
+
+// TreeEntryPath returns the path of the page of the file or directory at path
+// in repo at rev (with or without an "@" prefix; empty for the default
+// branch), relative to the base path the app is served under.
+func TreeEntryPath(repo api.RepoName, rev, path string) string {
+	if rev != "" && !strings.HasPrefix(rev, "@") {
+		rev = "@" + rev
+	}
+	return "/" + string(repo) + rev + "/" + RepoPathDelim + "/tree/" + path
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/gorilla/mux"
+	"github.com/sourcegraph/sourcegraph/internal/api"
 )
 
 func TestRepoPattern(t *testing.T) {
@@ -191,3 +192,40 @@ func TestRepoRevSpec(t *testing.T) {
 		}
 	}
 }
+
+func TestBaseRepoRevSpec(t *testing.T) {
+	tests := []struct {
+		spec      RepoRev
+		routeVars map[string]string
+	}{
+		{RepoRev{Repo: "a.com/x", Rev: "r"}, map[string]string{"BaseRepo": "a.com/x", "BaseRev": "@r"}},
+		{RepoRev{Repo: "x"}, map[string]string{"BaseRepo": "x", "BaseRev": ""}},
+	}
+
+	for _, test := range tests {
+		routeVars := BaseRepoRevRouteVars(test.spec)
+		if !reflect.DeepEqual(routeVars, test.routeVars) {
+			t.Errorf("got route vars %+v, want %+v", routeVars, test.routeVars)
+		}
+		spec := ToBaseRepoRev(routeVars)
+		if spec != test.spec {
+			t.Errorf("got spec %+v from route vars %+v, want %+v", spec, routeVars, test.spec)
+		}
+	}
+}
+
+func TestTreeEntryPath(t *testing.T) {
+	for _, test := range []struct {
+		repo      api.RepoName
+		rev, path string
+		want      string
+	}{
+		{"a.com/x", "", "b/c.go", "/a.com/x/-/tree/b/c.go"},
+		{"a.com/x", "r", "b/c.go", "/a.com/x@r/-/tree/b/c.go"},
+		{"a.com/x", "@r", "", "/a.com/x@r/-/tree/"},
+	} {
+		if got := TreeEntryPath(test.repo, test.rev, test.path); got != test.want {
+			t.Errorf("TreeEntryPath(%q, %q, %q) = %q, want %q", test.repo, test.rev, test.path, got, test.want)
+		}
+	}
+}
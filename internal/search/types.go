@@ -63,6 +63,33 @@ type SymbolsParameters struct {
 
 	// First indicates that only the first n symbols should be returned.
 	First int
+
+	// IncludeSource if true will set the Source of each returned symbol.
+	IncludeSource bool
+
+	// IncludeKinds are kinds of symbols to return even though the symbols
+	// service is configured to drop them.
+	IncludeKinds []string
+
+	// Name is an optional filter on symbol names, matched according to
+	// NameMatch (see protocol.SearchArgs).
+	Name string
+
+	// NameMatch is how Name is matched: "exact" (the default), "prefix" or
+	// "regex".
+	NameMatch string
+
+	// NameCaseSensitive if false will ignore the case of Name when finding
+	// matches.
+	NameCaseSensitive bool
+
+	// TopLevelOnly and ExportedOnly if true limit the search to top level
+	// and exported symbols (see protocol.SearchArgs).
+	TopLevelOnly, ExportedOnly bool
+
+	// IncludeEnclosing if true will set the Enclosing symbols of each
+	// returned symbol.
+	IncludeEnclosing bool
 }
 
 // TextParameters are the parameters passed to a search backend. It contains the Pattern
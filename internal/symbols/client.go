@@ -75,7 +75,59 @@ func (c *Client) url(key key) (string, error) {
 
 // Search performs a symbol search on the symbols service.
 func (c *Client) Search(ctx context.Context, args search.SymbolsParameters) (result *protocol.SearchResult, err error) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, "symbols.Client.Search")
+	err = c.postSearch(ctx, "Search", args, args, &result)
+	return result, err
+}
+
+// Count returns the number of symbols matching args (ignoring args.First) on
+// the symbols service.
+func (c *Client) Count(ctx context.Context, args search.SymbolsParameters) (result *protocol.SearchCount, err error) {
+	payload := struct {
+		search.SymbolsParameters
+		Count bool
+	}{args, true}
+	err = c.postSearch(ctx, "Count", args, payload, &result)
+	return result, err
+}
+
+// SearchByFile performs a symbol search on the symbols service and returns
+// the matching symbols grouped by file.
+func (c *Client) SearchByFile(ctx context.Context, args search.SymbolsParameters) (result *protocol.SearchFilesResult, err error) {
+	payload := struct {
+		search.SymbolsParameters
+		GroupByFile bool
+	}{args, true}
+	err = c.postSearch(ctx, "SearchByFile", args, payload, &result)
+	return result, err
+}
+
+// SearchDocumentSymbols performs a symbol search on the symbols service and
+// returns the matching symbols as LSP DocumentSymbols grouped by file.
+func (c *Client) SearchDocumentSymbols(ctx context.Context, args search.SymbolsParameters) (result *protocol.SearchDocumentSymbolsResult, err error) {
+	payload := struct {
+		search.SymbolsParameters
+		Format string
+	}{args, protocol.FormatLSP}
+	err = c.postSearch(ctx, "SearchDocumentSymbols", args, payload, &result)
+	return result, err
+}
+
+// SearchTree performs a symbol search on the symbols service and returns the
+// matching symbols nested by scope and grouped by file.
+func (c *Client) SearchTree(ctx context.Context, args search.SymbolsParameters) (result *protocol.SearchTreeResult, err error) {
+	payload := struct {
+		search.SymbolsParameters
+		Format string
+	}{args, protocol.FormatTree}
+	err = c.postSearch(ctx, "SearchTree", args, payload, &result)
+	return result, err
+}
+
+// postSearch posts payload, args or a variant of it, to the search endpoint of
+// the symbols service and decodes the response into result. name is the name
+// of the calling method, used in the trace span and errors.
+func (c *Client) postSearch(ctx context.Context, name string, args search.SymbolsParameters, payload, result interface{}) (err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "symbols.Client."+name)
 	defer func() {
 		if err != nil {
 			ext.Error.Set(span, true)
@@ -86,20 +138,19 @@ func (c *Client) Search(ctx context.Context, args search.SymbolsParameters) (res
 	span.SetTag("Repo", string(args.Repo))
 	span.SetTag("CommitID", string(args.CommitID))
 
-	resp, err := c.httpPost(ctx, "search", key{repo: args.Repo, commitID: args.CommitID}, args)
+	resp, err := c.httpPost(ctx, "search", key{repo: args.Repo, commitID: args.CommitID}, payload)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		// best-effort inclusion of body in error message
 		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 200))
-		return nil, errors.Errorf("Symbol.Search http status %d for %+v: %s", resp.StatusCode, resp.StatusCode, string(body))
+		return errors.Errorf("Symbol.%s http status %d for %+v: %s", name, resp.StatusCode, args, string(body))
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	return result, err
+	return json.NewDecoder(resp.Body).Decode(result)
 }
 
 func (c *Client) httpPost(ctx context.Context, method string, key key, payload interface{}) (resp *http.Response, err error) {
@@ -0,0 +1,216 @@
+package protocol
+
+import (
+	"strings"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+// SearchDocumentSymbolsResult is the result of a search with SearchArgs.Format
+// set to FormatLSP.
+type SearchDocumentSymbolsResult struct {
+	// Files are the files with matching symbols, ordered by path.
+	Files []FileDocumentSymbols `json:"files"`
+
+	// SkippedFiles is as in SearchResult.
+	SkippedFiles int `json:"skippedFiles,omitempty"`
+
+	// Truncated is as in SearchResult.
+	Truncated []string `json:"truncated,omitempty"`
+
+	// NoParseableFiles is as in SearchResult.
+	NoParseableFiles bool `json:"noParseableFiles,omitempty"`
+}
+
+// SetTruncation is as in SearchFilesResult.
+func (r *SearchDocumentSymbolsResult) SetTruncation(result SearchResult) {
+	r.SkippedFiles, r.Truncated, r.NoParseableFiles = result.SkippedFiles, result.Truncated, result.NoParseableFiles
+}
+
+// FileDocumentSymbols are the symbols of a single file, in the shape of the
+// response to an LSP textDocument/documentSymbol request.
+type FileDocumentSymbols struct {
+	Path    string           `json:"path"`
+	Symbols []DocumentSymbol `json:"symbols"`
+}
+
+// DocumentSymbol is an LSP DocumentSymbol. Symbols defined in the scope of
+// another symbol are its children.
+type DocumentSymbol struct {
+	Name   string         `json:"name"`
+	Detail string         `json:"detail,omitempty"`
+	Kind   lsp.SymbolKind `json:"kind"`
+
+	// Range spans the lines from the symbol to its last child, since ctags
+	// doesn't report where a symbol ends.
+	Range lsp.Range `json:"range"`
+
+	// SelectionRange is the range of the symbol's name.
+	SelectionRange lsp.Range `json:"selectionRange"`
+
+	Children []DocumentSymbol `json:"children,omitempty"`
+}
+
+// DocumentSymbols converts symbols, ordered by path and line, to LSP
+// DocumentSymbols grouped by file. A symbol is nested under the nearest
+// preceding symbol in the same file named like its Parent (and of its
+// ParentKind, if set); symbols whose parent isn't among symbols are top level.
+func DocumentSymbols(symbols []Symbol) SearchDocumentSymbolsResult {
+	var result SearchDocumentSymbolsResult
+	for start := 0; start < len(symbols); {
+		end := start + 1
+		for end < len(symbols) && symbols[end].Path == symbols[start].Path {
+			end++
+		}
+		result.Files = append(result.Files, FileDocumentSymbols{
+			Path:    symbols[start].Path,
+			Symbols: fileDocumentSymbols(symbols[start:end]),
+		})
+		start = end
+	}
+	return result
+}
+
+// fileDocumentSymbols converts the symbols of a single file.
+func fileDocumentSymbols(symbols []Symbol) []DocumentSymbol {
+	roots, children := nest(symbols)
+	var build func(i int) DocumentSymbol
+	build = func(i int) DocumentSymbol {
+		s := symbols[i]
+		ds := DocumentSymbol{
+			Name:           s.Name,
+			Detail:         s.Signature,
+			Kind:           LSPSymbolKind(s.Kind),
+			Range:          s.LSPRange(),
+			SelectionRange: s.LSPRange(),
+		}
+		for _, c := range children[i] {
+			child := build(c)
+			if child.Range.End.Line > ds.Range.End.Line ||
+				(child.Range.End.Line == ds.Range.End.Line && child.Range.End.Character > ds.Range.End.Character) {
+				ds.Range.End = child.Range.End
+			}
+			ds.Children = append(ds.Children, child)
+		}
+		return ds
+	}
+	result := make([]DocumentSymbol, 0, len(roots))
+	for _, i := range roots {
+		result = append(result, build(i))
+	}
+	return result
+}
+
+// nest returns the indexes of the top level symbols of a single file, and of
+// the children of each symbol. A symbol is nested under the nearest preceding
+// symbol that isParent of it; if there isn't one (the scope is missing or
+// wasn't parsed), it is top level.
+func nest(symbols []Symbol) (roots []int, children [][]int) {
+	children = make([][]int, len(symbols))
+	for i, s := range symbols {
+		parent := -1
+		if s.Parent != "" {
+			for j := i - 1; j >= 0; j-- {
+				if isParent(symbols[j], s) {
+					parent = j
+					break
+				}
+			}
+		}
+		if parent >= 0 {
+			children[parent] = append(children[parent], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+	return roots, children
+}
+
+// isParent reports whether p is the symbol whose scope s is defined in. The
+// parent's name may be qualified (such as "Outer.Inner" or "ns::Class").
+func isParent(p, s Symbol) bool {
+	if s.ParentKind != "" && p.Kind != s.ParentKind {
+		return false
+	}
+	name := s.Parent
+	if i := strings.LastIndexAny(name, ".:"); i >= 0 {
+		name = name[i+1:]
+	}
+	return p.Name == s.Parent || p.Name == name
+}
+
+// LSPRange returns the range of the name of s. ctags only reports the symbol's
+// line, so the character is guessed from its Pattern.
+func (s Symbol) LSPRange() lsp.Range {
+	ch := 0
+	if s.Pattern != "" {
+		if i := strings.Index(strings.TrimPrefix(s.Pattern, "/^"), s.Name); i >= 0 {
+			ch = i
+		}
+	}
+	return lsp.Range{
+		Start: lsp.Position{Line: s.Line - 1, Character: ch},
+		End:   lsp.Position{Line: s.Line - 1, Character: ch + len(s.Name)},
+	}
+}
+
+// LSPSymbolKind returns the LSP symbol kind of a ctags kind, or 0 if there is
+// no corresponding LSP kind.
+func LSPSymbolKind(kind string) lsp.SymbolKind {
+	// Ctags kinds are determined by the parser and do not (in general) match LSP symbol kinds.
+	switch strings.ToLower(kind) {
+	case "file":
+		return lsp.SKFile
+	case "module":
+		return lsp.SKModule
+	case "namespace":
+		return lsp.SKNamespace
+	case "package", "packagename", "subprogspec":
+		return lsp.SKPackage
+	case "class", "type", "service", "typedef", "union", "section", "subtype", "component":
+		return lsp.SKClass
+	case "method", "methodspec":
+		return lsp.SKMethod
+	case "property":
+		return lsp.SKProperty
+	case "field", "member", "anonmember", "recordfield":
+		return lsp.SKField
+	case "constructor":
+		return lsp.SKConstructor
+	case "enum", "enumerator":
+		return lsp.SKEnum
+	case "interface":
+		return lsp.SKInterface
+	case "function", "func", "subroutine", "macro", "subprogram", "procedure", "command", "singletonmethod":
+		return lsp.SKFunction
+	case "variable", "var", "functionvar", "define", "alias", "val":
+		return lsp.SKVariable
+	case "constant", "const":
+		return lsp.SKConstant
+	case "string", "message", "heredoc":
+		return lsp.SKString
+	case "number":
+		return lsp.SKNumber
+	case "bool", "boolean":
+		return lsp.SKBoolean
+	case "array":
+		return lsp.SKArray
+	case "object", "literal", "map":
+		return lsp.SKObject
+	case "key", "label", "target", "selector", "id", "tag":
+		return lsp.SKKey
+	case "null":
+		return lsp.SKNull
+	case "enum member", "enumconstant":
+		return lsp.SKEnumMember
+	case "struct":
+		return lsp.SKStruct
+	case "event":
+		return lsp.SKEvent
+	case "operator":
+		return lsp.SKOperator
+	case "type parameter", "annotation":
+		return lsp.SKTypeParameter
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestDocumentSymbols(t *testing.T) {
+	symbols := []Symbol{
+		{Path: "a.go", Name: "T", Kind: "struct", Line: 1, Pattern: "/^type T struct {$/"},
+		{Path: "a.go", Name: "f", Kind: "field", Line: 2, Parent: "T", ParentKind: "struct"},
+		{Path: "a.go", Name: "M", Kind: "method", Line: 5, Parent: "pkg.T", Signature: "()"},
+		{Path: "a.go", Name: "orphan", Kind: "func", Line: 9, Parent: "Missing"},
+		{Path: "b.go", Name: "g", Kind: "func", Line: 3},
+	}
+	rng := func(line, ch, n int) lsp.Range {
+		return lsp.Range{Start: lsp.Position{Line: line, Character: ch}, End: lsp.Position{Line: line, Character: ch + n}}
+	}
+	want := SearchDocumentSymbolsResult{Files: []FileDocumentSymbols{
+		{Path: "a.go", Symbols: []DocumentSymbol{
+			{
+				Name:           "T",
+				Kind:           lsp.SKStruct,
+				Range:          lsp.Range{Start: lsp.Position{Line: 0, Character: 5}, End: lsp.Position{Line: 4, Character: 1}},
+				SelectionRange: rng(0, 5, 1),
+				Children: []DocumentSymbol{
+					{Name: "f", Kind: lsp.SKField, Range: rng(1, 0, 1), SelectionRange: rng(1, 0, 1)},
+					{Name: "M", Detail: "()", Kind: lsp.SKMethod, Range: rng(4, 0, 1), SelectionRange: rng(4, 0, 1)},
+				},
+			},
+			{Name: "orphan", Kind: lsp.SKFunction, Range: rng(8, 0, 6), SelectionRange: rng(8, 0, 6)},
+		}},
+		{Path: "b.go", Symbols: []DocumentSymbol{
+			{Name: "g", Kind: lsp.SKFunction, Range: rng(2, 0, 1), SelectionRange: rng(2, 0, 1)},
+		}},
+	}}
+	if got := DocumentSymbols(symbols); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
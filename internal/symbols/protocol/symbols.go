@@ -1,6 +1,48 @@
 package protocol
 
-import "github.com/sourcegraph/sourcegraph/internal/api"
+import (
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// Formats for SearchArgs.Format.
+const (
+	FormatLSP  = "lsp"  // LSP DocumentSymbols, nested by scope
+	FormatTree = "tree" // Symbols nested by scope
+)
+
+// Modes for SearchArgs.NameMatch.
+const (
+	NameMatchExact  = "exact"  // the symbol name equals Name
+	NameMatchPrefix = "prefix" // the symbol name starts with Name
+	NameMatchRegex  = "regex"  // the symbol name matches the regular expression Name
+)
+
+// Reasons for a result to be incomplete, listed in SearchResult.Truncated.
+const (
+	// TruncatedLimit is when more symbols match than were returned, because
+	// of SearchArgs.First (or the maximum number of results).
+	TruncatedLimit = "limit"
+
+	// TruncatedFileCount is when some files of the commit were not parsed
+	// because it has more files than the symbols service parses per commit
+	// (see SearchResult.SkippedFiles).
+	TruncatedFileCount = "file count"
+
+	// TruncatedFileSize is when some files of the commit were not parsed
+	// because they are larger than the symbols service parses.
+	TruncatedFileSize = "file size"
+
+	// TruncatedTimeout is when the search ran out of time, so only the
+	// symbols found until then were returned.
+	TruncatedTimeout = "timeout"
+
+	// TruncatedResponseSize is when the symbols found would exceed the
+	// maximum size of a response of the symbols service, so only those that
+	// fit were returned. Narrowing the search returns the rest.
+	TruncatedResponseSize = "response size"
+)
 
 // SearchArgs are the arguments to perform a search on the symbols service.
 type SearchArgs struct {
@@ -35,11 +77,207 @@ type SearchArgs struct {
 
 	// First indicates that only the first n symbols should be returned.
 	First int
+
+	// IncludeSource if true will set the Source of each returned symbol.
+	IncludeSource bool
+
+	// Name is an optional filter on symbol names, matched according to
+	// NameMatch. It applies in addition to Query.
+	Name string
+
+	// NameMatch is how Name is matched against symbol names: NameMatchExact
+	// (the default), NameMatchPrefix or NameMatchRegex.
+	NameMatch string
+
+	// NameCaseSensitive if false will ignore the case of Name when finding
+	// matches.
+	NameCaseSensitive bool
+
+	// IncludeKinds are kinds of symbols to return even though the symbols
+	// service is configured to drop them. Searches that set it may be slower,
+	// because the commit has to be parsed separately.
+	IncludeKinds []string
+
+	// GroupByFile if true will respond with a SearchFilesResult, which has
+	// the matching symbols grouped by file, instead of a SearchResult.
+	GroupByFile bool
+
+	// Format is the format of the response: empty for a SearchResult (or
+	// the result selected by GroupByFile), FormatLSP for a
+	// SearchDocumentSymbolsResult, or FormatTree for a SearchTreeResult.
+	Format string
+
+	// Count if true will respond with a SearchCount of the matching symbols
+	// (ignoring First) instead of the symbols themselves.
+	Count bool
+
+	// MaxDepth if positive limits the search to files at most MaxDepth
+	// directory levels deep: 1 is only the files at the root of the
+	// repository, 2 also those in its top level directories, and so on.
+	// Deeper files are skipped before parsing, so an overview of a large
+	// repository is quicker to compute; its symbols are cached separately
+	// from those of the whole commit.
+	MaxDepth int
+
+	// TopLevelOnly if true limits the search to symbols that are not defined
+	// in the scope of another symbol (those without a Parent).
+	TopLevelOnly bool
+
+	// ExportedOnly if true limits the search to symbols that code in other
+	// files or packages can refer to. Whether a symbol is exported is
+	// guessed by the conventions of its language, since ctags doesn't report
+	// it:
+	//
+	//	all languages: locals, parameters and labels are not exported
+	//	Go: names starting with an upper case (ASCII) letter are exported
+	//	Python: names starting with an underscore are not exported
+	//
+	// All other symbols are considered exported.
+	ExportedOnly bool
+
+	// IncludeEnclosing if true will set the Enclosing symbols of each
+	// returned symbol. It makes the search slower, because the scope of each
+	// symbol is looked up separately.
+	IncludeEnclosing bool
+
+	// IncludeURL if true will set the URL of each returned symbol.
+	IncludeURL bool
+
+	// Async if true will not wait for an uncached commit to be parsed.
+	// Instead the service responds with 202 Accepted and a SearchPending
+	// body, and parses the commit in the background.
+	Async bool
+
+	// PageSize if positive pages through the matching symbols, ordered by
+	// path, line, name and kind: the result has at most PageSize symbols
+	// (instead of First), and its NextPageToken continues after them. It is
+	// only supported for a SearchResult (not with GroupByFile, Format or
+	// Count).
+	PageSize int
+
+	// PageToken is the NextPageToken of the previous page of the same
+	// search, or empty for the first page.
+	PageToken string
+}
+
+// SearchPending is returned (with status 202 Accepted) by an asynchronous
+// search of an uncached commit.
+type SearchPending struct {
+	// Token identifies the background parse. Pass it to the status endpoint
+	// to learn when the commit's symbols are ready.
+	Token string
+}
+
+// SearchStatus is the status of a background parse started by an
+// asynchronous search.
+type SearchStatus struct {
+	// Ready is true once the symbols are cached. A search for the same
+	// repo@commit will then be answered quickly.
+	Ready bool
+
+	// Error is non-empty if the background parse failed.
+	Error string
 }
 
 // SearchResult is the result of a search on the symbols service.
 type SearchResult struct {
 	Symbols []Symbol // code symbols
+
+	// SkippedFiles is the number of files of the commit that were not
+	// parsed because it has more files than the symbols service parses per
+	// commit. If it is non-zero the result is incomplete.
+	SkippedFiles int `json:",omitempty"`
+
+	// Truncated lists the reasons the result is incomplete (such as
+	// TruncatedLimit), if it is. Clients can rely on it being empty only if
+	// they got all the symbols matching the search.
+	Truncated []string `json:",omitempty"`
+
+	// NoParseableFiles is true if the commit has no files the symbols service
+	// parses (it is empty, or only has binary, too large or otherwise skipped
+	// files). It tells such a commit apart from one whose files were parsed
+	// but have no symbols.
+	NoParseableFiles bool `json:",omitempty"`
+
+	// NextPageToken is the SearchArgs.PageToken of the next page of a paged
+	// search, or empty if this is the last page. A token stays valid for the
+	// same search of the same commit.
+	NextPageToken string `json:",omitempty"`
+}
+
+// SearchFilesResult is the result of a search with SearchArgs.GroupByFile
+// set.
+type SearchFilesResult struct {
+	// Files are the files with matching symbols, ordered by path.
+	Files []FileSymbols
+
+	// SkippedFiles is as in SearchResult.
+	SkippedFiles int `json:",omitempty"`
+
+	// Truncated is as in SearchResult.
+	Truncated []string `json:",omitempty"`
+
+	// NoParseableFiles is as in SearchResult.
+	NoParseableFiles bool `json:",omitempty"`
+}
+
+// SetTruncation sets the fields of r that tell whether it is complete from
+// those of result.
+func (r *SearchFilesResult) SetTruncation(result SearchResult) {
+	r.SkippedFiles, r.Truncated, r.NoParseableFiles = result.SkippedFiles, result.Truncated, result.NoParseableFiles
+}
+
+// SearchCount is the result of a search with SearchArgs.Count set.
+type SearchCount struct {
+	// Count is the number of matching symbols.
+	Count int
+
+	// Kinds is the number of matching symbols of each kind.
+	Kinds map[string]int
+
+	// SkippedFiles is as in SearchResult.
+	SkippedFiles int `json:",omitempty"`
+
+	// Truncated is as in SearchResult.
+	Truncated []string `json:",omitempty"`
+
+	// NoParseableFiles is as in SearchResult.
+	NoParseableFiles bool `json:",omitempty"`
+}
+
+// BlobsArgs are the arguments to get the symbols of individual blobs.
+type BlobsArgs struct {
+	// Repo is the name of the repository containing the blobs.
+	Repo api.RepoName `json:"repo"`
+
+	// Blobs are the blobs to get symbols for.
+	Blobs []BlobArg
+}
+
+// BlobArg identifies a blob to get symbols for.
+type BlobArg struct {
+	// Hash is the Git object ID of the blob.
+	Hash string
+
+	// Path is a file name for the blob. It is only used to detect the
+	// blob's language, and is returned as the path of its symbols.
+	Path string
+}
+
+// BlobsResult is the result of getting the symbols of individual blobs.
+type BlobsResult struct {
+	// Blobs are in the same order as the requested blobs.
+	Blobs []BlobSymbols
+}
+
+// BlobSymbols are the symbols in a single blob.
+type BlobSymbols struct {
+	Hash    string
+	Path    string
+	Symbols []Symbol
+
+	// Error is non-empty if the blob could not be fetched or parsed.
+	Error string `json:",omitempty"`
 }
 
 // Symbol is a code symbol.
@@ -54,5 +292,219 @@ type Symbol struct {
 	Signature  string
 	Pattern    string
 
+	// Source is the (trimmed and possibly truncated) source line the
+	// symbol is defined on. It is only set if requested with
+	// SearchArgs.IncludeSource.
+	Source string `json:",omitempty"`
+
 	FileLimited bool
+
+	// Enclosing are the symbols whose scope the symbol is defined in,
+	// outermost first, such as the class and the method of a local
+	// variable. It is only set if requested with SearchArgs.IncludeEnclosing.
+	Enclosing []EnclosingSymbol `json:",omitempty"`
+
+	// URL is the URL of the symbol's line in the app, relative to the app's
+	// host, such as "/github.com/a/b@c/-/tree/d.go#L12". It is only set if
+	// requested with SearchArgs.IncludeURL.
+	URL string `json:",omitempty"`
+}
+
+// EnclosingSymbol is a symbol in whose scope another symbol is defined.
+type EnclosingSymbol struct {
+	Name string
+
+	// Kind and Line are the kind and line of the symbol. They are only
+	// known if the symbol was found, rather than only named by the scope of
+	// the symbol it encloses: Line is 0 if it wasn't, and Kind is the kind
+	// of scope ctags reported, if any.
+	Kind string `json:",omitempty"`
+	Line int    `json:",omitempty"`
+}
+
+// PatchArgs are the arguments to get the symbols of the files changed by a
+// patch.
+type PatchArgs struct {
+	// Repo is the name of the repository the patch applies to.
+	Repo api.RepoName `json:"repo"`
+
+	// CommitID is the base commit the patch applies to.
+	CommitID api.CommitID `json:"commitID"`
+
+	// Patch is a unified diff, such as the output of git diff.
+	Patch string
+}
+
+// PatchResult is the symbols of the files changed by a patch.
+type PatchResult struct {
+	// Files are the files resulting from the patch, excluding deleted files.
+	Files []FileSymbols
+}
+
+// FilesArgs are the arguments to get the symbols of some files of a commit,
+// such as the files a commit changed.
+type FilesArgs struct {
+	// Repo is the name of the repository containing the files.
+	Repo api.RepoName `json:"repo"`
+
+	// CommitID is the commit to get the files from.
+	CommitID api.CommitID `json:"commitID"`
+
+	// Paths are the paths of the files to get symbols for.
+	Paths []string
+}
+
+// FilesResult is the symbols of some files of a commit.
+type FilesResult struct {
+	// Files are the requested files that exist, in the order requested.
+	Files []FileSymbols
+
+	// Missing are the requested paths that are not files in the commit.
+	Missing []string `json:",omitempty"`
+}
+
+// FileSymbols are the symbols of a single file.
+type FileSymbols struct {
+	Path    string
+	Symbols []Symbol
+}
+
+// CachedCommitsResult is the commits of a repository whose symbols are
+// cached.
+type CachedCommitsResult struct {
+	// Commits are sorted by LastAccess, most recent first. A commit is listed
+	// once for every variant of its symbols that is cached.
+	Commits []CachedCommit
+}
+
+// CachedCommit is the cached symbols of a commit.
+type CachedCommit struct {
+	CommitID api.CommitID `json:"commitID"`
+
+	// Variant is empty for the symbols of the whole commit as configured.
+	// Otherwise it describes how they differ, such as "drop-local" for
+	// symbols of a search with IncludeKinds or "depth-2" for a search with
+	// MaxDepth.
+	Variant string `json:",omitempty"`
+
+	// Size is the size of the cached symbols in bytes.
+	Size int64
+
+	// LastAccess is when the symbols were last used.
+	LastAccess time.Time
+}
+
+// KindsResult is the kinds of symbols of each language, which lets clients
+// show a human readable name for a symbol's Kind.
+type KindsResult struct {
+	// Languages maps a language (as in Symbol.Language) to its kinds.
+	Languages map[string][]Kind
+}
+
+// Kind is a kind of symbol.
+type Kind struct {
+	// Letter is the single letter abbreviation of the kind.
+	Letter string
+
+	// Name is the full name of the kind.
+	Name string
+
+	Description string
+}
+
+// PushArgs notify the symbols service that a repository has a new commit, so
+// that it can parse the commit before it is searched.
+type PushArgs struct {
+	// Repo is the name of the repository that was pushed to.
+	Repo api.RepoName `json:"repo"`
+
+	// CommitID is the new commit.
+	CommitID api.CommitID `json:"commitID"`
+}
+
+// RangeArgs are the arguments to get the symbols defined in a range of lines
+// of a file.
+type RangeArgs struct {
+	// Repo is the name of the repository the file is in.
+	Repo api.RepoName `json:"repo"`
+
+	// CommitID is the commit of the file.
+	CommitID api.CommitID `json:"commitID"`
+
+	// Path is the path of the file.
+	Path string
+
+	// StartLine and EndLine are the first and last line of the range
+	// (1-indexed and inclusive), as in Symbol.Line.
+	StartLine, EndLine int
+
+	// IncludeKinds are as in SearchArgs.
+	IncludeKinds []string
+
+	// IncludeSource if true will set the Source of each returned symbol.
+	IncludeSource bool
+}
+
+// DefinitionArgs are the arguments to find where a symbol is defined.
+type DefinitionArgs struct {
+	// Repo is the name of the repository to search.
+	Repo api.RepoName `json:"repo"`
+
+	// CommitID is the commit to search.
+	CommitID api.CommitID `json:"commitID"`
+
+	// Name is the exact (case sensitive) name of the symbol.
+	Name string
+
+	// Kind if non-empty is the kind of the symbol (as in Symbol.Kind).
+	Kind string
+
+	// IncludeKinds are as in SearchArgs.
+	IncludeKinds []string
+
+	// IncludeSource if true will set the Source of each returned symbol.
+	IncludeSource bool
+}
+
+// ExportArgs are the arguments to export the symbols database of a commit.
+type ExportArgs struct {
+	// Repo is the name of the repository to export.
+	Repo api.RepoName `json:"repo"`
+
+	// CommitID is the commit to export.
+	CommitID api.CommitID `json:"commitID"`
+
+	// IncludeKinds are as in SearchArgs.
+	IncludeKinds []string
+}
+
+// FingerprintArgs are the arguments to get the fingerprint of the symbols of
+// a commit.
+type FingerprintArgs struct {
+	// Repo is the name of the repository.
+	Repo api.RepoName `json:"repo"`
+
+	// CommitID is the commit.
+	CommitID api.CommitID `json:"commitID"`
+
+	// IncludeKinds are as in SearchArgs.
+	IncludeKinds []string
+}
+
+// FingerprintResult is the fingerprint of the symbols of a commit.
+type FingerprintResult struct {
+	// Fingerprint is a hash of all the symbols of the commit. It doesn't
+	// depend on the order the symbols were parsed in, so two commits have the
+	// same fingerprint if (and, barring hash collisions, only if) they have
+	// the same symbols.
+	Fingerprint string
+
+	// Symbols is the number of symbols.
+	Symbols int
+
+	// SkippedFiles is as in SearchResult.
+	SkippedFiles int `json:",omitempty"`
+
+	// Truncated is as in SearchResult.
+	Truncated []string `json:",omitempty"`
 }
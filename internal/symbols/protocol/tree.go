@@ -0,0 +1,72 @@
+package protocol
+
+// SearchTreeResult is the result of a search with SearchArgs.Format set to
+// FormatTree.
+type SearchTreeResult struct {
+	// Files are the files with matching symbols, ordered by path.
+	Files []FileSymbolTree
+
+	// SkippedFiles is as in SearchResult.
+	SkippedFiles int `json:",omitempty"`
+
+	// Truncated is as in SearchResult.
+	Truncated []string `json:",omitempty"`
+
+	// NoParseableFiles is as in SearchResult.
+	NoParseableFiles bool `json:",omitempty"`
+}
+
+// SetTruncation is as in SearchFilesResult.
+func (r *SearchTreeResult) SetTruncation(result SearchResult) {
+	r.SkippedFiles, r.Truncated, r.NoParseableFiles = result.SkippedFiles, result.Truncated, result.NoParseableFiles
+}
+
+// FileSymbolTree is the symbols of a single file, nested by scope.
+type FileSymbolTree struct {
+	Path    string
+	Symbols []SymbolNode
+}
+
+// SymbolNode is a symbol and the symbols defined in its scope, such as the
+// methods of a class.
+type SymbolNode struct {
+	Symbol
+	Children []SymbolNode `json:",omitempty"`
+}
+
+// SymbolTree nests symbols, ordered by path and line, by scope and groups
+// them by file, as in DocumentSymbols. Symbols whose parent isn't among
+// symbols (or that have no scope) are top level, so none are left out.
+func SymbolTree(symbols []Symbol) SearchTreeResult {
+	var result SearchTreeResult
+	for start := 0; start < len(symbols); {
+		end := start + 1
+		for end < len(symbols) && symbols[end].Path == symbols[start].Path {
+			end++
+		}
+		result.Files = append(result.Files, FileSymbolTree{
+			Path:    symbols[start].Path,
+			Symbols: fileSymbolTree(symbols[start:end]),
+		})
+		start = end
+	}
+	return result
+}
+
+// fileSymbolTree nests the symbols of a single file.
+func fileSymbolTree(symbols []Symbol) []SymbolNode {
+	roots, children := nest(symbols)
+	var build func(i int) SymbolNode
+	build = func(i int) SymbolNode {
+		node := SymbolNode{Symbol: symbols[i]}
+		for _, c := range children[i] {
+			node.Children = append(node.Children, build(c))
+		}
+		return node
+	}
+	result := make([]SymbolNode, 0, len(roots))
+	for _, i := range roots {
+		result = append(result, build(i))
+	}
+	return result
+}
@@ -0,0 +1,29 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSymbolTree(t *testing.T) {
+	var (
+		class  = Symbol{Path: "a.py", Name: "C", Kind: "class", Line: 1}
+		method = Symbol{Path: "a.py", Name: "m", Kind: "member", Line: 2, Parent: "C", ParentKind: "class"}
+		nested = Symbol{Path: "a.py", Name: "f", Kind: "function", Line: 3, Parent: "C.m", ParentKind: "member"}
+		orphan = Symbol{Path: "a.py", Name: "g", Kind: "function", Line: 7, Parent: "Missing"}
+		other  = Symbol{Path: "b.py", Name: "h", Kind: "function", Line: 1}
+	)
+	got := SymbolTree([]Symbol{class, method, nested, orphan, other})
+	want := SearchTreeResult{Files: []FileSymbolTree{
+		{Path: "a.py", Symbols: []SymbolNode{
+			{Symbol: class, Children: []SymbolNode{
+				{Symbol: method, Children: []SymbolNode{{Symbol: nested}}},
+			}},
+			{Symbol: orphan},
+		}},
+		{Path: "b.py", Symbols: []SymbolNode{{Symbol: other}}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}